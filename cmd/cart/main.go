@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/ispringteam/go-patterns/infrastructure/jsonlog"
 	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -19,15 +21,27 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/ilya-shikhaleev/arch-course/pkg/cart/app/cart"
+	"github.com/ilya-shikhaleev/arch-course/pkg/cart/infrastructure/handler"
 	"github.com/ilya-shikhaleev/arch-course/pkg/cart/infrastructure/postgres"
 	"github.com/ilya-shikhaleev/arch-course/pkg/cart/infrastructure/transport"
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/amqp"
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/jwt"
 )
 
+// userDomainEventsQueueName is not shared with other services, each of them gets all user events
+const userDomainEventsQueueName = "cart_user_domain_event"
+
+// userDomainEventRetryDelay keeps failed event from being retried in a busy loop while the database is unavailable
+const userDomainEventRetryDelay = 5 * time.Second
+
 var db *sql.DB
 var readyDBCh chan *sql.DB
+var amqpConnection *amqp.Connection
+var readyUserDomainEventChannelCh chan amqp.Channel
 
 func main() {
 	readyDBCh = make(chan *sql.DB)
+	readyUserDomainEventChannelCh = make(chan amqp.Channel)
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{})
 	logger.Print("Starting the service...")
@@ -37,6 +51,15 @@ func main() {
 		logger.Fatal("Port is not set.")
 	}
 
+	go func() {
+		amqpConnection = initRabbitMQ(logger)
+	}()
+	defer func() {
+		if amqpConnection != nil {
+			_ = amqpConnection.Close()
+		}
+	}()
+
 	go func() {
 		db = initDB(logger)
 	}()
@@ -85,7 +108,33 @@ func startServer(serverUrl string, logger *logrus.Logger) *http.Server {
 		serverErrorLogger := &serverErrorLogger{logger}
 		repo := postgres.NewCartRepository(db)
 		service := cart.NewService(repo)
-		m.Handle("/api/v1/", transport.MakeHandler(service, repo, serverErrorLogger))
+
+		go func() {
+			userDomainEventChannel := <-readyUserDomainEventChannelCh
+			logger.Print("Rabbit connected")
+			for delivery := range userDomainEventChannel.Deliveries() {
+				var req handler.OnUserDeletedRequest
+				if err := json.Unmarshal([]byte(delivery.Body), &req); err != nil {
+					// malformed event fails the same way on each attempt, so it is dropped
+					logger.Error(err, "invalid user deleted event")
+					_ = delivery.Ack()
+					continue
+				}
+				if err := handler.OnUserDeleted(req, service); err != nil {
+					logger.Error(err, "can't process user deleted event")
+					time.Sleep(userDomainEventRetryDelay)
+					_ = delivery.Reject()
+					continue
+				}
+				_ = delivery.Ack()
+			}
+		}()
+
+		handler, err := jwt.MiddlewareFromEnv(transport.MakeHandler(service, repo, serverErrorLogger))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		m.Handle("/api/v1/", handler)
 	}()
 
 	go func() {
@@ -222,6 +271,34 @@ func initDB(logger *logrus.Logger) *sql.DB {
 	}
 }
 
+func initRabbitMQ(logger *logrus.Logger) *amqp.Connection {
+	host := os.Getenv("RABBITMQ_HOST")
+	user := os.Getenv("RABBITMQ_USER")
+	password := os.Getenv("RABBITMQ_PASSWORD")
+	if host == "" || user == "" || password == "" {
+		logger.Fatal("rabbitmq env is not set.")
+	}
+	l := jsonlog.NewLogger(&jsonlog.Config{
+		Level:   jsonlog.InfoLevel,
+		AppName: "cart",
+	})
+
+	for {
+		amqpConnection := amqp.NewAMQPConnection(&amqp.Config{Host: host, User: user, Password: password}, l)
+		ch := amqp.NewUserDomainEventsChannel(userDomainEventsQueueName)
+		amqpConnection.AddChannel(ch)
+		err := amqpConnection.Start()
+		if err != nil {
+			logger.Info(errors.Wrap(err, "can't open connection to amqp"))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		readyUserDomainEventChannelCh <- ch
+		return amqpConnection
+	}
+}
+
 type serverErrorLogger struct {
 	*logrus.Logger
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -20,19 +21,29 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/ilya-shikhaleev/arch-course/pkg/common/amqp"
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/jwt"
 	"github.com/ilya-shikhaleev/arch-course/pkg/order/app/order"
+	"github.com/ilya-shikhaleev/arch-course/pkg/order/infrastructure/handler"
 	"github.com/ilya-shikhaleev/arch-course/pkg/order/infrastructure/postgres"
 	"github.com/ilya-shikhaleev/arch-course/pkg/order/infrastructure/transport"
 )
 
+// userDomainEventsQueueName is not shared with other services, each of them gets all user events
+const userDomainEventsQueueName = "order_user_domain_event"
+
+// userDomainEventRetryDelay keeps failed event from being retried in a busy loop while the database is unavailable
+const userDomainEventRetryDelay = 5 * time.Second
+
 var db *sql.DB
 var readyDBCh chan *sql.DB
 var amqpConnection *amqp.Connection
 var readyOrderDomainEventChannelCh chan amqp.Channel
+var readyUserDomainEventChannelCh chan amqp.Channel
 
 func main() {
 	readyDBCh = make(chan *sql.DB)
 	readyOrderDomainEventChannelCh = make(chan amqp.Channel)
+	readyUserDomainEventChannelCh = make(chan amqp.Channel)
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{})
 	logger.Print("Starting the service...")
@@ -100,8 +111,33 @@ func startServer(serverUrl string, logger *logrus.Logger) *http.Server {
 		logger.Print("Rabbit connected")
 		serverErrorLogger := &serverErrorLogger{logger}
 		repo := postgres.NewOrderRepository(db)
-		service := order.NewService(repo, transport.NewProductsRetriever())
-		m.Handle("/api/v1/", transport.MakeHandler(service, repo, serverErrorLogger, orderDomainEventChannel))
+		service := order.NewService(repo, transport.NewProductsRetriever(), transport.NewAddressProvider(), transport.NewStockReserver())
+
+		go func() {
+			userDomainEventChannel := <-readyUserDomainEventChannelCh
+			for delivery := range userDomainEventChannel.Deliveries() {
+				var req handler.OnUserDeletedRequest
+				if err := json.Unmarshal([]byte(delivery.Body), &req); err != nil {
+					// malformed event fails the same way on each attempt, so it is dropped
+					logger.Error(err, "invalid user deleted event")
+					_ = delivery.Ack()
+					continue
+				}
+				if err := handler.OnUserDeleted(req, service); err != nil {
+					logger.Error(err, "can't process user deleted event")
+					time.Sleep(userDomainEventRetryDelay)
+					_ = delivery.Reject()
+					continue
+				}
+				_ = delivery.Ack()
+			}
+		}()
+
+		handler, err := jwt.MiddlewareFromEnv(transport.MakeHandler(service, repo, serverErrorLogger, orderDomainEventChannel))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		m.Handle("/api/v1/", handler)
 	}()
 
 	go func() {
@@ -255,6 +291,8 @@ func initRabbitMQ(logger *logrus.Logger) *amqp.Connection {
 		amqpConnection := amqp.NewAMQPConnection(&amqp.Config{Host: host, User: user, Password: password}, l)
 		ch := amqp.NewOrderDomainEventsChannel(false)
 		amqpConnection.AddChannel(ch)
+		userCh := amqp.NewUserDomainEventsChannel(userDomainEventsQueueName)
+		amqpConnection.AddChannel(userCh)
 		err := amqpConnection.Start()
 		if err != nil {
 			logger.Info(errors.Wrap(err, "can't open connection to amqp"))
@@ -263,6 +301,7 @@ func initRabbitMQ(logger *logrus.Logger) *amqp.Connection {
 		}
 
 		readyOrderDomainEventChannelCh <- ch
+		readyUserDomainEventChannelCh <- userCh
 		return amqpConnection
 	}
 }
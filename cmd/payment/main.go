@@ -16,6 +16,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/jwt"
 	"github.com/ilya-shikhaleev/arch-course/pkg/payment/infrastructure/transport"
 )
 
@@ -61,7 +62,11 @@ func startServer(serverUrl string, logger *logrus.Logger) *http.Server {
 		WriteTimeout: 15 * time.Second,
 	}
 	serverErrorLogger := &serverErrorLogger{logger}
-	m.Handle("/api/v1/", transport.MakeHandler(serverErrorLogger))
+	handler, err := jwt.MiddlewareFromEnv(transport.MakeHandler(serverErrorLogger))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	m.Handle("/api/v1/", handler)
 
 	go func() {
 		logger.Fatal(srv.ListenAndServe())
@@ -18,10 +18,21 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/jwt"
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/catalog"
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/inventory"
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
 	"github.com/ilya-shikhaleev/arch-course/pkg/product/infrastructure/postgres"
 	"github.com/ilya-shikhaleev/arch-course/pkg/product/infrastructure/transport"
 )
 
+const (
+	// reservationTTL is time given to pay the order, then its items are returned to stock
+	reservationTTL = 30 * time.Minute
+	// expiredReservationsCheckInterval limits how long stock of abandoned orders stays unavailable after TTL
+	expiredReservationsCheckInterval = time.Minute
+)
+
 var db *sql.DB
 var readyDBCh chan *sql.DB
 
@@ -81,7 +92,22 @@ func startServer(serverUrl string, logger *logrus.Logger) *http.Server {
 		db := <-readyDBCh
 		serverErrorLogger := &serverErrorLogger{logger}
 		repo := postgres.NewProductRepository(db)
-		m.Handle("/api/v1/", transport.MakeHandler(repo, serverErrorLogger))
+		catalogService := catalog.NewService(postgres.NewCatalogRepository(db))
+		inventoryService := inventory.NewService(postgres.NewInventoryRepository(db), reservationTTL)
+
+		go func() {
+			for range time.Tick(expiredReservationsCheckInterval) {
+				if err := inventoryService.ReleaseExpired(); err != nil {
+					logger.Error(err, "can't release expired reservations")
+				}
+			}
+		}()
+
+		handler, err := jwt.MiddlewareFromEnv(transport.MakeHandler(repo, product.NewService(repo), catalogService, inventoryService, serverErrorLogger))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		m.Handle("/api/v1/", handler)
 	}()
 
 	go func() {
@@ -11,25 +11,77 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
+	"github.com/ispringteam/go-patterns/infrastructure/jsonlog"
 	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
-
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/amqp"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/address"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/apikey"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/attempt"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/export"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/oauth"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/reset"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/token"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/totp"
 	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/verification"
 	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/auth"
 	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/encoding"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/notification"
 	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/postgres"
+	redisinfrastructure "github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/redis"
 	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/transport"
 )
 
+const (
+	// session expires after sessionIdleTTL without activity, but can't be renewed longer than sessionMaxTTL
+	sessionIdleTTL = 15 * time.Minute
+	sessionMaxTTL  = 7 * 24 * time.Hour
+
+	tokenIssuer           = "http://user-user-chart.arch-course.svc.cluster.local:9000"
+	accessTokenTTL        = 5 * time.Minute
+	signingKeyRotationTTL = 24 * time.Hour
+
+	passwordResetTokenTTL     = time.Hour
+	emailVerificationTokenTTL = 24 * time.Hour
+
+	totpIssuer = "arch-course"
+	// loginChallengeTTL is time given to enter the second factor code
+	loginChallengeTTL = 5 * time.Minute
+
+	authorizationCodeTTL = time.Minute
+
+	// userEventsRelayInterval is the delay of events queued when the previous batch is published
+	userEventsRelayInterval = time.Second
+)
+
+var (
+	usernameAttemptPolicy = attempt.Policy{FreeAttempts: 5, BaseLockout: 30 * time.Second, MaxLockout: 15 * time.Minute}
+	// many users may be behind the same NAT, so IP limit is looser
+	ipAttemptPolicy = attempt.Policy{FreeAttempts: 20, BaseLockout: 30 * time.Second, MaxLockout: time.Hour}
+)
+
 var db *sql.DB
 var readyDBCh chan *sql.DB
 
+var redisClient *redis.Client
+
+var amqpConnection *amqp.Connection
+var readyUserDomainEventChannelCh chan amqp.Channel
+
 func main() {
 	readyDBCh = make(chan *sql.DB)
+	readyUserDomainEventChannelCh = make(chan amqp.Channel)
 
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{})
@@ -40,6 +92,15 @@ func main() {
 		logger.Fatal("Port is not set.")
 	}
 
+	go func() {
+		amqpConnection = initRabbitMQ(logger)
+	}()
+	defer func() {
+		if amqpConnection != nil {
+			_ = amqpConnection.Close()
+		}
+	}()
+
 	go func() {
 		db = initDB(logger)
 	}()
@@ -49,6 +110,11 @@ func main() {
 			_ = db.Close()
 		}
 	}()
+	defer func() {
+		if redisClient != nil {
+			_ = redisClient.Close()
+		}
+	}()
 
 	logger.Print("The service is ready to listen and serve.")
 	killSignalChan := getKillSignalChan()
@@ -89,6 +155,140 @@ func initDB(logger *logrus.Logger) *sql.DB {
 	}
 }
 
+// initSessionRepository selects storage shared between service replicas, memory storage is suitable for single replica only
+func initSessionRepository(db *sql.DB, logger *logrus.Logger) session.Repository {
+	switch storage := os.Getenv("SESSION_STORAGE"); storage {
+	case "", "postgres":
+		return postgres.NewSessionRepository(db)
+	case "redis":
+		if redisClient == nil {
+			redisClient = initRedis(logger)
+		}
+		return redisinfrastructure.NewSessionRepository(redisClient)
+	case "memory":
+		return memory.NewSessionRepository()
+	default:
+		logger.Fatal("Unknown session storage " + storage)
+		return nil
+	}
+}
+
+// initAttemptStore uses the same storage as sessions, login attempts must be counted across replicas too
+func initAttemptStore(db *sql.DB, logger *logrus.Logger) attempt.Store {
+	switch storage := os.Getenv("SESSION_STORAGE"); storage {
+	case "", "postgres":
+		return postgres.NewAttemptStore(db)
+	case "redis":
+		if redisClient == nil {
+			redisClient = initRedis(logger)
+		}
+		return redisinfrastructure.NewAttemptStore(redisClient)
+	case "memory":
+		return memory.NewAttemptStore()
+	default:
+		logger.Fatal("Unknown session storage " + storage)
+		return nil
+	}
+}
+
+// initNotifier selects how messages reach users, log and file notifiers are for local development
+func initNotifier(logger *logrus.Logger) user.Notifier {
+	switch notifier := os.Getenv("NOTIFIER"); notifier {
+	case "", "discard":
+		return notification.NewDiscardNotifier(logger)
+	case "log":
+		return notification.NewLogNotifier(logger)
+	case "file":
+		path := os.Getenv("NOTIFICATION_FILE")
+		if path == "" {
+			logger.Fatal("Notification file env is not set.")
+		}
+		return notification.NewFileNotifier(path)
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		from := os.Getenv("SMTP_FROM")
+		if addr == "" || from == "" {
+			logger.Fatal("SMTP env is not set.")
+		}
+		return notification.NewSMTPNotifier(addr, from, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	default:
+		logger.Fatal("Unknown notifier " + notifier)
+		return nil
+	}
+}
+
+// publicURL is the ingress address, without it discovery document points to the service inside the cluster
+func publicURL() string {
+	if url := os.Getenv("PUBLIC_URL"); url != "" {
+		return url
+	}
+	return tokenIssuer
+}
+
+// serviceURL is the address of another service inside the cluster, export can't work without it
+func serviceURL(env string, logger *logrus.Logger) string {
+	url := os.Getenv(env)
+	if url == "" {
+		logger.Fatal(env + " env is not set.")
+	}
+	return url
+}
+
+func initRabbitMQ(logger *logrus.Logger) *amqp.Connection {
+	host := os.Getenv("RABBITMQ_HOST")
+	rabbitmqUser := os.Getenv("RABBITMQ_USER")
+	password := os.Getenv("RABBITMQ_PASSWORD")
+	// user events wait in the queue of postgres until the broker is configured
+	if host == "" || rabbitmqUser == "" || password == "" {
+		logger.Info("rabbitmq env is not set, user events are not published.")
+		return nil
+	}
+	l := jsonlog.NewLogger(&jsonlog.Config{
+		Level:   jsonlog.InfoLevel,
+		AppName: "user",
+	})
+
+	for {
+		amqpConnection := amqp.NewAMQPConnection(&amqp.Config{Host: host, User: rabbitmqUser, Password: password}, l)
+		ch := amqp.NewUserDomainEventsChannel("")
+		amqpConnection.AddChannel(ch)
+		err := amqpConnection.Start()
+		if err != nil {
+			logger.Info(errors.Wrap(err, "can't open connection to amqp"))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		readyUserDomainEventChannelCh <- ch
+		return amqpConnection
+	}
+}
+
+func initRedis(logger *logrus.Logger) *redis.Client {
+	host := os.Getenv("REDIS_HOST")
+	port := os.Getenv("REDIS_PORT")
+	password := os.Getenv("REDIS_PASSWORD")
+	if host == "" || port == "" || password == "" {
+		logger.Fatal("Redis env is not set.")
+	}
+
+	for {
+		source := fmt.Sprintf("%s:%v", host, port)
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     source,
+			Password: password,
+		})
+		_, err := redisClient.Ping().Result()
+		if err != nil {
+			logger.Info(errors.Wrap(err, "can't ping to "+source))
+			_ = redisClient.Close()
+			time.Sleep(time.Second)
+			continue
+		}
+		return redisClient
+	}
+}
+
 func startServer(serverUrl string, logger *logrus.Logger) *http.Server {
 	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "app_request_latency_seconds",
@@ -103,6 +303,11 @@ func startServer(serverUrl string, logger *logrus.Logger) *http.Server {
 	}, []string{"endpoint", "method", "status"})
 	// Registering the defined metric with Prometheus
 	_ = prometheus.Register(counter)
+	failedLoginCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "app_failed_login_count",
+		Help: "Failed Login Count.",
+	}, []string{"reason"})
+	_ = prometheus.Register(failedLoginCounter)
 
 	m := serveMux()
 	router := metricsMiddleware(logMiddleware(m, logger), histogram, counter)
@@ -119,17 +324,51 @@ func startServer(serverUrl string, logger *logrus.Logger) *http.Server {
 	go func() {
 		db := <-readyDBCh
 		serverErrorLogger := &serverErrorLogger{logger}
-		userService := user.NewService(postgres.NewUserRepository(db), encoding.MD5Encoder())
-		m.Handle("/api/v1/", transport.MakeHandler(userService, serverErrorLogger))
+		go func() {
+			userDomainEventChannel := <-readyUserDomainEventChannelCh
+			transport.RelayUserEvents(postgres.NewUserEventQueue(db), userDomainEventChannel, userEventsRelayInterval, serverErrorLogger)
+		}()
+		passEncoder := encoding.NewPassEncoder(encoding.BcryptEncoder(bcrypt.DefaultCost), encoding.MD5Encoder())
+		userService := user.NewService(postgres.NewUserRepository(db), passEncoder)
+		userSessionService := session.NewService(initSessionRepository(db, logger), sessionIdleTTL, sessionMaxTTL)
+		notifier := initNotifier(logger)
+		resetService := reset.NewService(postgres.NewResetTokenRepository(db), userService, userSessionService, notifier, passwordResetTokenTTL)
+		verificationService := verification.NewService(postgres.NewVerificationTokenRepository(db), userService, userSessionService, notifier, emailVerificationTokenTTL)
+		totpService := totp.NewService(postgres.NewTOTPRepository(db), postgres.NewChallengeRepository(db), totpIssuer, loginChallengeTTL)
+		apiKeyService := apikey.NewService(postgres.NewAPIKeyRepository(db), userService)
+		auditService := audit.NewService(postgres.NewAuditRepository(db))
+		addressService := address.NewService(postgres.NewAddressRepository(db))
+		// popular service keeps only aggregated buy counts of products, there is no personal data to export
+		exportService := export.NewService(userService, userSessionService,
+			transport.NewAddressExportSource(addressService),
+			transport.NewServiceExportSource("cart", serviceURL("CART_SERVICE_URL", logger)+"/api/v1/internal/users/%s/cart"),
+			transport.NewServiceExportSource("orders", serviceURL("ORDER_SERVICE_URL", logger)+"/api/v1/internal/users/%s/orders"),
+		)
 
 		router := mux.NewRouter()
-		sessionService := auth.NewSessionService(postgres.NewUserRepository(db), encoding.MD5Encoder())
+		tokenService := token.NewService(postgres.NewKeyRepository(db), tokenIssuer, accessTokenTTL, signingKeyRotationTTL)
+		attemptService := attempt.NewService(initAttemptStore(db, logger), usernameAttemptPolicy, ipAttemptPolicy)
+		sessionService := auth.NewSessionService(userService, userSessionService, tokenService, attemptService, totpService, apiKeyService, auditService, failedLoginCounter)
 		router.HandleFunc("/auth", sessionService.AuthHandler)
 		router.HandleFunc("/login", sessionService.LoginHandler).Methods(http.MethodPost)
+		router.HandleFunc("/login/2fa", sessionService.SecondFactorHandler).Methods(http.MethodPost)
 		router.HandleFunc("/logout", sessionService.LogoutHandler).Methods(http.MethodPost)
+		router.HandleFunc("/token/refresh", sessionService.RefreshHandler).Methods(http.MethodPost)
+		router.HandleFunc("/.well-known/jwks.json", sessionService.JWKSHandler).Methods(http.MethodGet)
+		oauthService := oauth.NewService(postgres.NewOAuthClientRepository(db), postgres.NewAuthorizationCodeRepository(db), userService, userSessionService, tokenService, authorizationCodeTTL)
+		oauthServer := auth.NewOAuthService(sessionService, oauthService, publicURL())
+		router.HandleFunc("/oauth/authorize", oauthServer.AuthorizeHandler).Methods(http.MethodGet, http.MethodPost)
+		router.HandleFunc("/oauth/token", oauthServer.TokenHandler).Methods(http.MethodPost)
+		router.HandleFunc("/oauth/userinfo", oauthServer.UserInfoHandler).Methods(http.MethodGet, http.MethodPost)
+		router.HandleFunc("/.well-known/openid-configuration", oauthServer.DiscoveryHandler).Methods(http.MethodGet)
 		m.Handle("/auth", router)
 		m.Handle("/login", router)
+		m.Handle("/login/", router)
 		m.Handle("/logout", router)
+		m.Handle("/token/", router)
+		m.Handle("/.well-known/", router)
+		m.Handle("/oauth/", router)
+		m.Handle("/api/v1/", transport.MakeHandler(userService, userSessionService, resetService, verificationService, totpService, apiKeyService, exportService, auditService, addressService, oauthService, serverErrorLogger))
 	}()
 
 	return srv
@@ -65,4 +65,8 @@ Create the name of the service account to use
 {{- define "postgresql.fullname" -}}
 {{- printf "%s-%s" "user" "postgresql" | trunc 63 | trimSuffix "-" -}}
 {{/*{{- printf "%s-%s" .Release.Name "postgresql" | trunc 63 | trimSuffix "-" -}}*/}}
+{{- end -}}
+
+{{- define "rabbitmq.fullname" -}}
+{{- printf "%s-%s" "user" "rabbitmq" | trunc 63 | trimSuffix "-" -}}
 {{- end -}}
\ No newline at end of file
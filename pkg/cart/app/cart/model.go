@@ -16,6 +16,7 @@ type Repository interface {
 	FindByID(id ID) (*Cart, error)
 	FindByUserID(userID string) (*Cart, error)
 	Store(cart *Cart) error
+	RemoveByUserID(userID string) error
 	NextID() (ID, error)
 }
 
@@ -27,6 +27,11 @@ func (s *Service) AddProductToCart(userID, productID string) (err error) {
 	return s.repo.Store(c)
 }
 
+// DeleteCart removes cart of deleted user, user may have no cart
+func (s *Service) DeleteCart(userID string) error {
+	return s.repo.RemoveByUserID(userID)
+}
+
 func (s *Service) ClearCart(userID string) (err error) {
 	c, err := s.repo.FindByUserID(userID)
 	if err != nil {
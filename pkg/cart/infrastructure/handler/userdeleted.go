@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/cart/app/cart"
+)
+
+type OnUserDeletedRequest struct {
+	UserID string `json:"userId"`
+}
+
+var errEmptyUserID = errors.New("user id is empty")
+
+func OnUserDeleted(req OnUserDeletedRequest, service *cart.Service) error {
+	if req.UserID == "" {
+		return errEmptyUserID
+	}
+	return service.DeleteCart(req.UserID)
+}
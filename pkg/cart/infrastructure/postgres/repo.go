@@ -44,6 +44,15 @@ func (repo *repository) Store(cart *cart.Cart) error {
 	return err
 }
 
+func (repo *repository) RemoveByUserID(userID string) error {
+	_, err := repo.db.Exec("DELETE FROM carts_products WHERE cart_id IN (SELECT id FROM carts WHERE user_id = $1);", userID)
+	if err != nil {
+		return err
+	}
+	_, err = repo.db.Exec("DELETE FROM carts WHERE user_id = $1;", userID)
+	return err
+}
+
 func (repo *repository) NextID() (cart.ID, error) {
 	id, err := uuid.NewUUID()
 	if err != nil {
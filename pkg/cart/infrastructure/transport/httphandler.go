@@ -13,6 +13,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ilya-shikhaleev/arch-course/pkg/cart/app/cart"
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
 )
 
 func MakeHandler(service *cart.Service, repo cart.Repository, logger httplog.Logger) http.Handler {
@@ -20,6 +21,7 @@ func MakeHandler(service *cart.Service, repo cart.Repository, logger httplog.Log
 	opts := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(authz.ServerBefore),
 	}
 
 	readCartHandler := httptransport.NewServer(
@@ -43,19 +45,46 @@ func MakeHandler(service *cart.Service, repo cart.Repository, logger httplog.Log
 		opts...,
 	)
 
+	exportCartHandler := httptransport.NewServer(
+		makeReadCartEndpoint(repo),
+		decodeExportCartRequest,
+		encodeResponse,
+		opts...,
+	)
+
 	r.Handle("/api/v1/cart", readCartHandler).Methods(http.MethodGet)
 	r.Handle("/api/v1/cart", clearCartHandler).Methods(http.MethodDelete)
 	r.Handle("/api/v1/cart/product", addProductToCartHandler).Methods(http.MethodPut)
+	r.Handle("/api/v1/internal/users/{userId}/cart", exportCartHandler).Methods(http.MethodGet)
 
 	return r
 }
 
-func decodeReadCartRequest(_ context.Context, r *http.Request) (interface{}, error) {
+func decodeReadCartRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	userID := r.Header.Get("X-User-Id")
 	if userID == "" {
 		return nil, newErrUnauthorized(fmt.Sprintf("can read only self user cart (%s)", r.Header.Get("X-User-Id")))
 	}
 
+	// support staff reads data of other users
+	if requestedUserID := r.URL.Query().Get("userId"); requestedUserID != "" && requestedUserID != userID {
+		if !authz.HasPermission(ctx, authz.ReadAnyCart) {
+			return nil, authz.ErrForbidden
+		}
+		userID = requestedUserID
+	}
+
+	req := readCartRequest{UserID: userID}
+	return req, nil
+}
+
+// decodeExportCartRequest serves personal data export of the user service, the user is not the caller
+func decodeExportCartRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID, ok := mux.Vars(r)["userId"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "user id required for export cart request")
+	}
+
 	req := readCartRequest{UserID: userID}
 	return req, nil
 }
@@ -111,6 +140,8 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 		switch err {
 		case cart.ErrCartNotFound:
 			w.WriteHeader(http.StatusNotFound)
+		case authz.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -26,6 +26,7 @@ type Channel interface {
 	Name() string
 	Send(msgBody string, eventType string) error
 	Receive() chan string
+	Deliveries() chan Delivery
 	Connect(conn *amqp.Connection) error
 }
 
@@ -8,39 +8,71 @@ import (
 )
 
 const (
+	domainEventsExchangeName = "domain_event"
+	domainEventsExchangeType = "topic"
+
 	orderDomainEventsQueueName     = "order_domain_event"
-	orderDomainEventsExchangeName  = "domain_event"
-	orderDomainEventsExchangeType  = "topic"
-	orderDomainEventsRoutingKey    = "#"
+	orderDomainEventsRoutingKey    = "order.#"
 	orderDomainEventsRoutingPrefix = "order."
+	// orderDomainEventsLegacyRoutingKey was bound before user events shared the exchange, it must not deliver them to order queue
+	orderDomainEventsLegacyRoutingKey = "#"
+
+	userDomainEventsRoutingKey    = "user.#"
+	userDomainEventsRoutingPrefix = "user."
 )
 
+// Delivery must be acknowledged by the consumer after the event is processed,
+// rejected delivery is returned to the queue and consumed again
+type Delivery struct {
+	Body     string
+	delivery amqp.Delivery
+}
+
+func (d Delivery) Ack() error {
+	return d.delivery.Ack(false)
+}
+
+func (d Delivery) Reject() error {
+	return d.delivery.Nack(false, true)
+}
+
+// channel publishes events of one domain to the shared exchange,
+// channel with queue also consumes events of the domain from the queue
 type channel struct {
-	conn               *amqp.Connection
-	writeChannel       *amqp.Channel
-	messageReceiveChan chan string
-	forRetrieve        bool
+	conn                *amqp.Connection
+	writeChannel        *amqp.Channel
+	messageReceiveChan  chan string
+	deliveryReceiveChan chan Delivery
+	queueName           string
+	routingKey          string
+	routingPrefix       string
+	obsoleteRoutingKeys []string
 }
 
 func (c *channel) Name() string {
-	return orderDomainEventsExchangeName
+	return domainEventsExchangeName
 }
 
 func (c *channel) Send(msgBody string, eventType string) error {
-	log.Println("sent", msgBody, " to", orderDomainEventsRoutingPrefix+eventType)
+	log.Println("sent", msgBody, " to", c.routingPrefix+eventType)
 	msg := amqp.Publishing{
 		DeliveryMode: amqp.Persistent,
 		ContentType:  jsonrpc.ContentType,
 		Body:         []byte(msgBody),
 	}
-	routingKey := orderDomainEventsRoutingPrefix + eventType
-	return c.writeChannel.Publish(orderDomainEventsExchangeName, routingKey, false, false, msg)
+	routingKey := c.routingPrefix + eventType
+	return c.writeChannel.Publish(domainEventsExchangeName, routingKey, false, false, msg)
 }
 
 func (c *channel) Receive() chan string {
 	return c.messageReceiveChan
 }
 
+// Deliveries returns events of channel with manual acknowledgement, Receive gets nothing from such channel
+func (c *channel) Deliveries() chan Delivery {
+	return c.deliveryReceiveChan
+}
+
 func (c *channel) Connect(conn *amqp.Connection) error {
 	c.writeChannel = nil
 
@@ -52,35 +84,73 @@ func (c *channel) Connect(conn *amqp.Connection) error {
 	}
 	c.writeChannel = channel
 
-	if c.forRetrieve {
-		err = channel.ExchangeDeclare(orderDomainEventsExchangeName, orderDomainEventsExchangeType, true, false, false, false, nil)
+	// publishing to undeclared exchange closes the channel, so senders declare it too
+	err = channel.ExchangeDeclare(domainEventsExchangeName, domainEventsExchangeType, true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.queueName != "" {
+		readQueue, err := channel.QueueDeclare(c.queueName, true, false, false, false, nil)
 		if err != nil {
 			return err
 		}
 
-		readQueue, err := channel.QueueDeclare(orderDomainEventsQueueName, true, false, false, false, nil)
+		err = channel.QueueBind(readQueue.Name, c.routingKey, domainEventsExchangeName, false, nil)
 		if err != nil {
 			return err
 		}
+		for _, routingKey := range c.obsoleteRoutingKeys {
+			if err = channel.QueueUnbind(readQueue.Name, routingKey, domainEventsExchangeName, nil); err != nil {
+				return err
+			}
+		}
 
-		err = channel.QueueBind(readQueue.Name, orderDomainEventsRoutingKey, orderDomainEventsExchangeName, false, nil)
+		manualAck := c.deliveryReceiveChan != nil
+		if manualAck {
+			// unacknowledged events are not piled up in the consumer, they stay in the queue
+			if err = channel.Qos(1, 0, false); err != nil {
+				return err
+			}
+		}
+		readChan, err := channel.Consume(readQueue.Name, "", !manualAck, false, false, false, nil)
 		if err != nil {
 			return err
 		}
 
-		readChan, err := channel.Consume(readQueue.Name, "", true, false, false, false, nil)
-
 		go func() {
 			for msg := range readChan {
 				log.Println("read message from rabbit", string(msg.Body))
-				c.messageReceiveChan <- string(msg.Body)
+				if manualAck {
+					c.deliveryReceiveChan <- Delivery{Body: string(msg.Body), delivery: msg}
+				} else {
+					c.messageReceiveChan <- string(msg.Body)
+				}
 			}
 		}()
 	}
 
-	return err
+	return nil
 }
 
 func NewOrderDomainEventsChannel(forRetrieve bool) *channel {
-	return &channel{messageReceiveChan: make(chan string), forRetrieve: forRetrieve}
+	c := &channel{messageReceiveChan: make(chan string), routingKey: orderDomainEventsRoutingKey, routingPrefix: orderDomainEventsRoutingPrefix}
+	if forRetrieve {
+		c.queueName = orderDomainEventsQueueName
+		c.obsoleteRoutingKeys = []string{orderDomainEventsLegacyRoutingKey}
+	}
+	return c
+}
+
+// NewUserDomainEventsChannel consumes user events from queueName, every consuming service needs its own queue.
+// Events are acknowledged by the consumer via Deliveries, so failed erasure is retried.
+// Channel with empty queueName only sends events
+func NewUserDomainEventsChannel(queueName string) *channel {
+	return &channel{
+		messageReceiveChan:  make(chan string),
+		deliveryReceiveChan: make(chan Delivery),
+		queueName:           queueName,
+		routingKey:          userDomainEventsRoutingKey,
+		routingPrefix:       userDomainEventsRoutingPrefix,
+	}
 }
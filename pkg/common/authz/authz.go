@@ -0,0 +1,132 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+const (
+	userIDHeader    = "X-User-Id"
+	userRolesHeader = "X-User-Roles"
+	apiKeyIDHeader  = "X-Api-Key-Id"
+	rolesSeparator  = ","
+)
+
+type Role string
+
+const RoleAdmin Role = "admin"
+
+type Permission string
+
+const (
+	ReadAnyUser  Permission = "users:read:any"
+	ManageRoles  Permission = "users:roles:manage"
+	ReadAuditLog Permission = "users:audit:read"
+	ReadAnyOrder Permission = "orders:read:any"
+	ReadAnyCart  Permission = "carts:read:any"
+	// ManageCatalog allows to create, change and remove products
+	ManageCatalog Permission = "products:manage"
+	// ManageOAuthClients allows to register applications that log users in with OAuth
+	ManageOAuthClients Permission = "users:oauth-clients:manage"
+)
+
+// rolePermissions is shared by all services, so the role means the same everywhere
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {ReadAnyUser, ManageRoles, ReadAuditLog, ReadAnyOrder, ReadAnyCart, ManageCatalog, ManageOAuthClients},
+}
+
+// KnownRole reports whether role is defined, unknown roles grant nothing
+func KnownRole(role Role) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Identity is the authenticated caller of the request
+type Identity struct {
+	UserID string
+	Roles  []Role
+	// APIKeyID is set when the caller is authenticated with api key of the user
+	APIKeyID string
+}
+
+func (i Identity) HasPermission(permission Permission) bool {
+	for _, role := range i.Roles {
+		for _, p := range rolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var ErrForbidden = errors.New("permission denied")
+
+type identityKey struct{}
+
+// ServerBefore reads identity set by the ingress forward auth or jwt middleware,
+// use it as go-kit httptransport.ServerBefore option
+func ServerBefore(ctx context.Context, r *http.Request) context.Context {
+	return WithIdentity(ctx, Identity{
+		UserID:   r.Header.Get(userIDHeader),
+		Roles:    ParseRoles(r.Header.Get(userRolesHeader)),
+		APIKeyID: r.Header.Get(apiKeyIDHeader),
+	})
+}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+func IdentityFrom(ctx context.Context) Identity {
+	identity, _ := ctx.Value(identityKey{}).(Identity)
+	return identity
+}
+
+func HasPermission(ctx context.Context, permission Permission) bool {
+	return IdentityFrom(ctx).HasPermission(permission)
+}
+
+// Require declares permission needed to call the endpoint
+func Require(permission Permission) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if !HasPermission(ctx, permission) {
+				return nil, ErrForbidden
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// RejectAPIKeys protects credentials of the user, leaked api key must not be able to take over the account
+func RejectAPIKeys(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if IdentityFrom(ctx).APIKeyID != "" {
+			return nil, ErrForbidden
+		}
+		return next(ctx, request)
+	}
+}
+
+func ParseRoles(header string) []Role {
+	var roles []Role
+	for _, role := range strings.Split(header, rolesSeparator) {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, Role(role))
+		}
+	}
+	return roles
+}
+
+func FormatRoles(roles []Role) string {
+	values := make([]string, 0, len(roles))
+	for _, role := range roles {
+		values = append(values, string(role))
+	}
+	return strings.Join(values, rolesSeparator)
+}
@@ -0,0 +1,51 @@
+package authz
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerBefore(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/orders", nil)
+	r.Header.Set("X-User-Id", "1")
+	r.Header.Set("X-User-Roles", "admin, unknown,")
+
+	identity := IdentityFrom(ServerBefore(context.Background(), r))
+	assert.Equal(t, "1", identity.UserID)
+	assert.Equal(t, []Role{RoleAdmin, "unknown"}, identity.Roles)
+	assert.True(t, identity.HasPermission(ReadAnyOrder))
+}
+
+func TestRequire(t *testing.T) {
+	endpoint := Require(ReadAnyUser)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+
+	_, err := endpoint(context.Background(), nil)
+	assert.Equal(t, ErrForbidden, err)
+	_, err = endpoint(WithIdentity(context.Background(), Identity{UserID: "1", Roles: []Role{"unknown"}}), nil)
+	assert.Equal(t, ErrForbidden, err)
+
+	response, err := endpoint(WithIdentity(context.Background(), Identity{UserID: "1", Roles: []Role{RoleAdmin}}), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", response)
+}
+
+func TestRejectAPIKeys(t *testing.T) {
+	endpoint := RejectAPIKeys(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+
+	r := httptest.NewRequest("DELETE", "/api/v1/users/me/2fa", nil)
+	r.Header.Set("X-User-Id", "1")
+	r.Header.Set("X-Api-Key-Id", "key")
+	_, err := endpoint(ServerBefore(context.Background(), r), nil)
+	assert.Equal(t, ErrForbidden, err)
+
+	response, err := endpoint(WithIdentity(context.Background(), Identity{UserID: "1"}), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", response)
+}
@@ -0,0 +1,120 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JSONWebKey is a public RSA key in RFC 7517 format
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+func NewJSONWebKey(keyID string, key *rsa.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: algorithmRS256,
+		KeyID:     keyID,
+		Modulus:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func (k JSONWebKey) PublicKey() (*rsa.PublicKey, error) {
+	if k.KeyType != "RSA" {
+		return nil, errors.Errorf("unsupported key type %s", k.KeyType)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.Modulus)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.Exponent)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func (s JSONWebKeySet) PublicKey(keyID string) (*rsa.PublicKey, error) {
+	for _, key := range s.Keys {
+		if key.KeyID == keyID {
+			return key.PublicKey()
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+const (
+	remoteKeySetMaxAge          = 10 * time.Minute
+	remoteKeySetMinFetchTimeout = 30 * time.Second
+)
+
+// NewRemoteKeySource caches key set published by the issuer, the set is fetched again when it is outdated
+// or when token is signed with unknown key after rotation
+func NewRemoteKeySource(url string) KeySource {
+	return &remoteKeySource{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+type remoteKeySource struct {
+	url       string
+	client    *http.Client
+	mu        sync.Mutex
+	keySet    JSONWebKeySet
+	fetchedAt time.Time
+}
+
+func (s *remoteKeySource) PublicKey(keyID string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.fetchedAt) > remoteKeySetMaxAge {
+		if err := s.fetch(); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := s.keySet.PublicKey(keyID)
+	if err == ErrUnknownKey && time.Since(s.fetchedAt) > remoteKeySetMinFetchTimeout {
+		if err = s.fetch(); err != nil {
+			return nil, err
+		}
+		key, err = s.keySet.PublicKey(keyID)
+	}
+	return key, err
+}
+
+func (s *remoteKeySource) fetch() error {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return errors.Wrap(err, "can't fetch key set")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("can't fetch key set, status %d", resp.StatusCode)
+	}
+
+	var keySet JSONWebKeySet
+	if err = json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+		return errors.Wrap(err, "invalid key set")
+	}
+	s.keySet = keySet
+	s.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,138 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	algorithmRS256 = "RS256"
+	tokenType      = "JWT"
+
+	// AccessTokenUse marks tokens which grant access to the api, id tokens and others must not be accepted instead
+	AccessTokenUse = "access"
+	// IDTokenUse marks OpenID Connect id tokens, they are issued to clients and describe the user only
+	IDTokenUse = "id"
+)
+
+// leeway tolerates clock skew between replicas of different services
+const leeway = 30 * time.Second
+
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	TokenUse  string `json:"token_use,omitempty"`
+	Login     string `json:"preferred_username,omitempty"`
+	Email     string `json:"email,omitempty"`
+	// EmailVerified is not omitted, absent claim would be ambiguous
+	EmailVerified bool     `json:"email_verified"`
+	FirstName     string   `json:"given_name,omitempty"`
+	LastName      string   `json:"family_name,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	Scope         string   `json:"scope,omitempty"`
+	Nonce         string   `json:"nonce,omitempty"`
+}
+
+type SigningKey struct {
+	ID         string
+	PrivateKey *rsa.PrivateKey
+}
+
+// KeySource resolves public key by "kid" header of the token
+type KeySource interface {
+	PublicKey(keyID string) (*rsa.PublicKey, error)
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token is expired")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+func Sign(claims Claims, key SigningKey) (string, error) {
+	headerSegment, err := encodeSegment(header{Algorithm: algorithmRS256, Type: tokenType, KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	claimsSegment, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := headerSegment + "." + claimsSegment
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key.PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify checks signature and lifetime of the token, caller is responsible for checking token use and audience
+func Verify(token string, keys KeySource, now time.Time) (*Claims, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := decodeSegment(segments[0], &h); err != nil || h.Algorithm != algorithmRS256 {
+		return nil, ErrInvalidToken
+	}
+
+	publicKey, err := keys.PublicKey(h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	digest := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+	if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err = decodeSegment(segments[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.ExpiresAt == 0 || now.Add(-leeway).Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
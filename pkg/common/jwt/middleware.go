@@ -0,0 +1,96 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	authorizationHeader = "Authorization"
+	bearerPrefix        = "Bearer "
+	internalPathPrefix  = "/api/v1/internal/"
+	// APIKeyPrefix tells api keys apart from access tokens, keys are resolved only by the ingress forward auth
+	APIKeyPrefix = "ak_"
+)
+
+// identityHeaders are emitted by the user service auth handler through the ingress
+var identityHeaders = []string{"X-User-Id", "X-Login", "X-Email", "X-Email-Verified", "X-First-Name", "X-Last-Name", "X-User-Roles", "X-Api-Key-Id"}
+
+// Middleware verifies bearer access token locally and replaces identity headers with its claims.
+// When token is not required, requests without it keep identity headers set by the ingress forward auth.
+// Requests with api key always keep them, the key can't be verified locally and the forward auth has already checked it.
+// Internal api is called by other services directly and is not checked
+func Middleware(h http.Handler, keys KeySource, issuer string, required bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, internalPathPrefix) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		authorization := r.Header.Get(authorizationHeader)
+		if !strings.HasPrefix(authorization, bearerPrefix) {
+			if required {
+				writeUnauthorized(w, "access token required")
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		bearer := strings.TrimPrefix(authorization, bearerPrefix)
+		if strings.HasPrefix(bearer, APIKeyPrefix) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := Verify(bearer, keys, time.Now())
+		if err != nil {
+			writeUnauthorized(w, err.Error())
+			return
+		}
+		if claims.TokenUse != AccessTokenUse || claims.Issuer != issuer {
+			writeUnauthorized(w, ErrInvalidToken.Error())
+			return
+		}
+
+		for _, header := range identityHeaders {
+			r.Header.Del(header)
+		}
+		r.Header.Set("X-User-Id", claims.Subject)
+		r.Header.Set("X-Login", claims.Login)
+		r.Header.Set("X-Email", claims.Email)
+		r.Header.Set("X-Email-Verified", strconv.FormatBool(claims.EmailVerified))
+		r.Header.Set("X-First-Name", claims.FirstName)
+		r.Header.Set("X-Last-Name", claims.LastName)
+		r.Header.Set("X-User-Roles", strings.Join(claims.Roles, ","))
+		h.ServeHTTP(w, r)
+	})
+}
+
+// MiddlewareFromEnv verifies access tokens issued by the user service when its key set url is configured in JWKS_URL,
+// tokens of other issuers than JWT_ISSUER are rejected. JWT_REQUIRED=true rejects requests without token
+func MiddlewareFromEnv(h http.Handler) (http.Handler, error) {
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		return h, nil
+	}
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		return nil, errors.New("JWT_ISSUER env is not set")
+	}
+	return Middleware(h, NewRemoteKeySource(jwksURL), issuer, os.Getenv("JWT_REQUIRED") == "true"), nil
+}
+
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": message,
+	})
+}
@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware_APIKey(t *testing.T) {
+	for _, required := range []bool{false, true} {
+		var identity http.Header
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity = r.Header
+		}), JSONWebKeySet{}, "issuer", required)
+
+		// the ingress forward auth has resolved the key before the request reaches another service
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+		r.Header.Set("Authorization", "Bearer "+APIKeyPrefix+"id_secret")
+		r.Header.Set("X-User-Id", "user")
+		r.Header.Set("X-Api-Key-Id", "id")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "user", identity.Get("X-User-Id"))
+		assert.Equal(t, "id", identity.Get("X-Api-Key-Id"))
+	}
+}
+
+func TestMiddleware_AccessToken(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	keys := JSONWebKeySet{Keys: []JSONWebKey{NewJSONWebKey("key", &privateKey.PublicKey)}}
+	token, err := Sign(Claims{
+		Subject:   "user",
+		Issuer:    "issuer",
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		TokenUse:  AccessTokenUse,
+		Roles:     []string{"admin"},
+	}, SigningKey{ID: "key", PrivateKey: privateKey})
+	assert.Nil(t, err)
+
+	var identity http.Header
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = r.Header
+	}), keys, "issuer", true)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("X-User-Id", "other")
+	r.Header.Set("X-Api-Key-Id", "id")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user", identity.Get("X-User-Id"))
+	assert.Equal(t, "admin", identity.Get("X-User-Roles"))
+	assert.Empty(t, identity.Get("X-Api-Key-Id"))
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	otherIssuerToken, err := Sign(Claims{
+		Subject:   "user",
+		Issuer:    "other",
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		TokenUse:  AccessTokenUse,
+	}, SigningKey{ID: "key", PrivateKey: privateKey})
+	assert.Nil(t, err)
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil)
+	r.Header.Set("Authorization", "Bearer "+otherIssuerToken)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
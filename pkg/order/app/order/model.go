@@ -2,6 +2,7 @@ package order
 
 import (
 	"errors"
+	"strings"
 )
 
 type ID string
@@ -11,13 +12,30 @@ type Status int
 const (
 	PendingPayment Status = iota
 	Completed
+	Cancelled
 )
 
+// AnonymousUserID replaces owner of orders of deleted user, orders are kept for accounting
+const AnonymousUserID = ""
+
 type Order struct {
 	ID       ID
 	UserID   string
 	Status   Status
 	Products []Product
+	// ShippingAddress is a copy, later changes of the user address book don't affect the order
+	ShippingAddress *Address
+}
+
+type Address struct {
+	Recipient  string
+	Phone      string
+	Country    string
+	Region     string
+	City       string
+	PostalCode string
+	Line1      string
+	Line2      string
 }
 
 type Product struct {
@@ -42,3 +60,15 @@ type Repository interface {
 
 var ErrOrderNotFound = errors.New("order not found")
 var ErrEmptyCart = errors.New("cart is empty")
+var ErrAddressNotFound = errors.New("shipping address not found")
+var ErrOrderNotPending = errors.New("order is not pending payment")
+var ErrReservationExpired = errors.New("order reservation expired, products may be sold out")
+
+// OutOfStockError lists products of the cart which can't be ordered
+type OutOfStockError struct {
+	ProductIDs []string
+}
+
+func (e *OutOfStockError) Error() string {
+	return "products are out of stock: " + strings.Join(e.ProductIDs, ", ")
+}
@@ -1,12 +1,14 @@
 package order
 
-func NewService(repo Repository, productsRetriever ProductsRetriever) *Service {
-	return &Service{repo, productsRetriever}
+func NewService(repo Repository, productsRetriever ProductsRetriever, addresses AddressProvider, stock StockReserver) *Service {
+	return &Service{repo, productsRetriever, addresses, stock}
 }
 
 type Service struct {
 	repo              Repository
 	productsRetriever ProductsRetriever
+	addresses         AddressProvider
+	stock             StockReserver
 }
 
 type ProductsRetriever interface {
@@ -14,12 +16,34 @@ type ProductsRetriever interface {
 	RestoreProducts(userID string, products []Product) error
 }
 
-func (s *Service) CreateOrder(userID string) (orderID ID, err error) {
+// AddressProvider finds address in the user address book, empty addressID means the default address.
+// Nil address without error is returned when user has no default address
+type AddressProvider interface {
+	Address(userID, addressID string) (*Address, error)
+}
+
+// StockReserver holds products of the order until it is paid or cancelled, reservation id is the order id.
+// Reserve returns *OutOfStockError when some products are missing, Commit returns ErrReservationExpired
+// when the order wasn't paid in time
+type StockReserver interface {
+	Reserve(orderID ID, products []Product) error
+	Commit(orderID ID) error
+	Release(orderID ID) error
+}
+
+// CreateOrder ships to the default address of the user when addressID is empty
+func (s *Service) CreateOrder(userID, addressID string) (orderID ID, err error) {
 	orderID, err = s.repo.NextID()
 	if err != nil {
 		return orderID, err
 	}
 
+	// address is checked before the cart is cleared, so wrong address doesn't lose the products
+	shippingAddress, err := s.addresses.Address(userID, addressID)
+	if err != nil {
+		return orderID, err
+	}
+
 	products, err := s.productsRetriever.OrderProducts(userID)
 	if err != nil {
 		return orderID, err
@@ -29,14 +53,22 @@ func (s *Service) CreateOrder(userID string) (orderID ID, err error) {
 		return orderID, ErrEmptyCart
 	}
 
+	if err = s.stock.Reserve(orderID, products); err != nil {
+		_ = s.productsRetriever.RestoreProducts(userID, products)
+		return orderID, err
+	}
+
 	o := &Order{
 		ID:       orderID,
 		UserID:   userID,
 		Status:   PendingPayment,
 		Products: products,
+
+		ShippingAddress: shippingAddress,
 	}
 	err = s.repo.Store(o)
 	if err != nil {
+		_ = s.stock.Release(orderID)
 		_ = s.productsRetriever.RestoreProducts(userID, products)
 		return orderID, err
 	}
@@ -45,12 +77,55 @@ func (s *Service) CreateOrder(userID string) (orderID ID, err error) {
 	return orderID, nil
 }
 
+// AnonymizeUserOrders unlinks orders from deleted user and drops their shipping addresses
+func (s *Service) AnonymizeUserOrders(userID string) error {
+	orders, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return err
+	}
+	for i := range orders {
+		orders[i].UserID = AnonymousUserID
+		orders[i].ShippingAddress = nil
+		if err = s.repo.Store(&orders[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PayOrder sells reserved products, order can't be paid when its reservation is expired
 func (s *Service) PayOrder(orderID string) error {
 	o, err := s.repo.FindByID(ID(orderID))
 	if err != nil {
 		return err
 	}
+	if o.Status == Cancelled {
+		return ErrOrderNotPending
+	}
 
+	if err = s.stock.Commit(o.ID); err != nil {
+		return err
+	}
 	o.Status = Completed
 	return s.repo.Store(o)
 }
+
+// CancelOrder returns products of unpaid order to stock, order of another user is reported as not found
+func (s *Service) CancelOrder(userID, orderID string) error {
+	o, err := s.repo.FindByID(ID(orderID))
+	if err != nil {
+		return err
+	}
+	if o.UserID != userID {
+		return ErrOrderNotFound
+	}
+	if o.Status != PendingPayment {
+		return ErrOrderNotPending
+	}
+
+	if err = s.stock.Release(o.ID); err != nil {
+		return err
+	}
+	o.Status = Cancelled
+	return s.repo.Store(o)
+}
@@ -0,0 +1,188 @@
+package order
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderService_CreateOrder(t *testing.T) {
+	repo, products, stock := newMockRepo(), &mockProducts{carts: map[string][]Product{"user": cartProducts()}}, newMockStock()
+	service := NewService(repo, products, mockAddresses{}, stock)
+
+	orderID, err := service.CreateOrder("user", "")
+	assert.Nil(t, err)
+	o, err := repo.FindByID(orderID)
+	assert.Nil(t, err)
+	assert.Equal(t, PendingPayment, o.Status)
+	assert.Equal(t, cartProducts(), o.Products)
+	assert.Equal(t, "Ivan Ivanov", o.ShippingAddress.Recipient)
+	assert.Equal(t, cartProducts(), stock.reserved[orderID], "reservation id is the order id")
+	assert.Empty(t, products.carts["user"])
+
+	_, err = service.CreateOrder("user", "")
+	assert.Equal(t, ErrEmptyCart, err)
+}
+
+func TestOrderService_CreateOrderOutOfStock(t *testing.T) {
+	repo, products, stock := newMockRepo(), &mockProducts{carts: map[string][]Product{"user": cartProducts()}}, newMockStock()
+	stock.reserveErr = &OutOfStockError{ProductIDs: []string{"gopher"}}
+	service := NewService(repo, products, mockAddresses{}, stock)
+
+	_, err := service.CreateOrder("user", "")
+	assert.Equal(t, stock.reserveErr, err)
+	assert.Equal(t, cartProducts(), products.carts["user"], "products are returned to the cart")
+	assert.Empty(t, repo.orders)
+}
+
+func TestOrderService_CreateOrderReleasesStockOnFailure(t *testing.T) {
+	repo, products, stock := newMockRepo(), &mockProducts{carts: map[string][]Product{"user": cartProducts()}}, newMockStock()
+	repo.storeErr = errors.New("database is unavailable")
+	service := NewService(repo, products, mockAddresses{}, stock)
+
+	orderID, err := service.CreateOrder("user", "")
+	assert.Equal(t, repo.storeErr, err)
+	assert.Equal(t, []ID{orderID}, stock.released)
+	assert.Equal(t, cartProducts(), products.carts["user"])
+}
+
+func TestOrderService_PayOrder(t *testing.T) {
+	repo, stock := newMockRepo(), newMockStock()
+	service := NewService(repo, &mockProducts{carts: map[string][]Product{"user": cartProducts()}}, mockAddresses{}, stock)
+
+	orderID, err := service.CreateOrder("user", "")
+	assert.Nil(t, err)
+	stock.commitErr = ErrReservationExpired
+	assert.Equal(t, ErrReservationExpired, service.PayOrder(string(orderID)))
+	o, _ := repo.FindByID(orderID)
+	assert.Equal(t, PendingPayment, o.Status, "order of expired reservation is not completed")
+
+	stock.commitErr = nil
+	assert.Nil(t, service.PayOrder(string(orderID)))
+	o, _ = repo.FindByID(orderID)
+	assert.Equal(t, Completed, o.Status)
+	assert.Equal(t, []ID{orderID, orderID}, stock.committed)
+
+	assert.Equal(t, ErrOrderNotFound, service.PayOrder("unknown"))
+}
+
+func TestOrderService_CancelOrder(t *testing.T) {
+	repo, stock := newMockRepo(), newMockStock()
+	products := &mockProducts{carts: map[string][]Product{"user": cartProducts()}}
+	service := NewService(repo, products, mockAddresses{}, stock)
+
+	orderID, err := service.CreateOrder("user", "")
+	assert.Nil(t, err)
+	assert.Equal(t, ErrOrderNotFound, service.CancelOrder("other", string(orderID)))
+	assert.Empty(t, stock.released)
+
+	assert.Nil(t, service.CancelOrder("user", string(orderID)))
+	o, _ := repo.FindByID(orderID)
+	assert.Equal(t, Cancelled, o.Status)
+	assert.Equal(t, []ID{orderID}, stock.released)
+	assert.Equal(t, ErrOrderNotPending, service.CancelOrder("user", string(orderID)))
+	assert.Equal(t, ErrOrderNotPending, service.PayOrder(string(orderID)), "cancelled order can't be paid")
+
+	products.carts["user"] = cartProducts()
+	paidID, err := service.CreateOrder("user", "")
+	assert.Nil(t, err)
+	assert.Nil(t, service.PayOrder(string(paidID)))
+	assert.Equal(t, ErrOrderNotPending, service.CancelOrder("user", string(paidID)))
+	assert.Equal(t, []ID{orderID}, stock.released, "paid order keeps its products")
+}
+
+func cartProducts() []Product {
+	return []Product{{ProductID: "gopher", Price: 10}, {ProductID: "crab", Price: 20}}
+}
+
+type mockRepo struct {
+	orders   map[ID]Order
+	storeErr error
+}
+
+func newMockRepo() *mockRepo {
+	return &mockRepo{orders: make(map[ID]Order)}
+}
+
+func (repo *mockRepo) FindByID(id ID) (*Order, error) {
+	o, ok := repo.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return &o, nil
+}
+
+func (repo *mockRepo) FindByUserID(userID string) ([]Order, error) {
+	var orders []Order
+	for _, o := range repo.orders {
+		if o.UserID == userID {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+func (repo *mockRepo) Store(o *Order) error {
+	if repo.storeErr != nil {
+		return repo.storeErr
+	}
+	repo.orders[o.ID] = *o
+	return nil
+}
+
+func (repo *mockRepo) NextID() (ID, error) {
+	return ID(uuid.New().String()), nil
+}
+
+type mockProducts struct {
+	carts map[string][]Product
+}
+
+func (p *mockProducts) OrderProducts(userID string) ([]Product, error) {
+	products := p.carts[userID]
+	delete(p.carts, userID)
+	return products, nil
+}
+
+func (p *mockProducts) RestoreProducts(userID string, products []Product) error {
+	p.carts[userID] = append(p.carts[userID], products...)
+	return nil
+}
+
+type mockAddresses struct{}
+
+func (mockAddresses) Address(string, string) (*Address, error) {
+	return &Address{Recipient: "Ivan Ivanov", Country: "RU", City: "Moscow", Line1: "Tverskaya st., 1"}, nil
+}
+
+type mockStock struct {
+	reserved   map[ID][]Product
+	committed  []ID
+	released   []ID
+	reserveErr error
+	commitErr  error
+}
+
+func newMockStock() *mockStock {
+	return &mockStock{reserved: make(map[ID][]Product)}
+}
+
+func (s *mockStock) Reserve(orderID ID, products []Product) error {
+	if s.reserveErr != nil {
+		return s.reserveErr
+	}
+	s.reserved[orderID] = products
+	return nil
+}
+
+func (s *mockStock) Commit(orderID ID) error {
+	s.committed = append(s.committed, orderID)
+	return s.commitErr
+}
+
+func (s *mockStock) Release(orderID ID) error {
+	s.released = append(s.released, orderID)
+	return nil
+}
@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/order/app/order"
+)
+
+type OnUserDeletedRequest struct {
+	UserID string `json:"userId"`
+}
+
+var errEmptyUserID = errors.New("user id is empty")
+
+func OnUserDeleted(req OnUserDeletedRequest, service *order.Service) error {
+	if req.UserID == "" {
+		return errEmptyUserID
+	}
+	return service.AnonymizeUserOrders(req.UserID)
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"database/sql"
+	"encoding/json"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -18,12 +19,17 @@ type repository struct {
 }
 
 func (repo *repository) Store(order *order.Order) error {
+	shippingAddress, err := encodeAddress(order.ShippingAddress)
+	if err != nil {
+		return err
+	}
+
 	sqlStatement := `
-		INSERT INTO orders (id, user_id, status)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (id) DO UPDATE SET user_id = EXCLUDED.user_id, status = EXCLUDED.status;
+		INSERT INTO orders (id, user_id, status, shipping_address)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET user_id = EXCLUDED.user_id, status = EXCLUDED.status, shipping_address = EXCLUDED.shipping_address;
 `
-	_, err := repo.db.Exec(sqlStatement, string(order.ID), order.UserID, order.Status)
+	_, err = repo.db.Exec(sqlStatement, string(order.ID), order.UserID, order.Status, shippingAddress)
 	if err != nil {
 		return err
 	}
@@ -53,15 +59,20 @@ func (repo *repository) NextID() (order.ID, error) {
 }
 
 func (repo *repository) FindByID(id order.ID) (*order.Order, error) {
-	sqlStatement := `SELECT id, user_id, status
+	sqlStatement := `SELECT id, user_id, status, shipping_address
 						FROM orders
 						WHERE id=$1;`
 	var o order.Order
+	var shippingAddress []byte
 	row := repo.db.QueryRow(sqlStatement, string(id))
-	switch err := row.Scan(&o.ID, &o.UserID, &o.Status); err {
+	switch err := row.Scan(&o.ID, &o.UserID, &o.Status, &shippingAddress); err {
 	case sql.ErrNoRows:
 		return nil, order.ErrOrderNotFound
 	case nil:
+		o.ShippingAddress, err = decodeAddress(shippingAddress)
+		if err != nil {
+			return nil, err
+		}
 		o.Products, err = repo.findProductsByID(id)
 		if err != nil {
 			return nil, err
@@ -73,7 +84,7 @@ func (repo *repository) FindByID(id order.ID) (*order.Order, error) {
 }
 
 func (repo *repository) FindByUserID(userID string) ([]order.Order, error) {
-	sqlStatement := `SELECT id, user_id, status
+	sqlStatement := `SELECT id, user_id, status, shipping_address
 						FROM orders
 						WHERE user_id=$1;`
 	var orders []order.Order
@@ -83,10 +94,15 @@ func (repo *repository) FindByUserID(userID string) ([]order.Order, error) {
 	}
 	for rows.Next() {
 		var o order.Order
-		err = rows.Scan(&o.ID, &o.UserID, &o.Status)
+		var shippingAddress []byte
+		err = rows.Scan(&o.ID, &o.UserID, &o.Status, &shippingAddress)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
+		o.ShippingAddress, err = decodeAddress(shippingAddress)
+		if err != nil {
+			return nil, err
+		}
 		o.Products, err = repo.findProductsByID(o.ID)
 		if err != nil {
 			return nil, errors.WithStack(err)
@@ -115,3 +131,26 @@ func (repo *repository) findProductsByID(id order.ID) ([]order.Product, error) {
 	}
 	return products, errors.WithStack(err)
 }
+
+// encodeAddress keeps order without address as NULL
+func encodeAddress(a *order.Address) (interface{}, error) {
+	if a == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return data, nil
+}
+
+func decodeAddress(data []byte) (*order.Address, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var a order.Address
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &a, nil
+}
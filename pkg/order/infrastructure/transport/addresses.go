@@ -0,0 +1,76 @@
+package transport
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/order/app/order"
+)
+
+func NewAddressProvider() *AddressProvider {
+	return &AddressProvider{}
+}
+
+// AddressProvider reads the address book of user service by internal api
+type AddressProvider struct {
+}
+
+func (p *AddressProvider) Address(userID, addressID string) (*order.Address, error) {
+	const userHost = "http://user-user-chart.arch-course.svc.cluster.local:9000" // TODO: use env variable here
+	explicit := addressID != ""
+	if !explicit {
+		addressID = "default"
+	}
+	req, err := http.NewRequest(http.MethodGet, userHost+"/api/v1/internal/users/"+url.PathEscape(userID)+"/addresses/"+url.PathEscape(addressID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("X-User-Id", userID)
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && explicit:
+		return nil, order.ErrAddressNotFound
+	case resp.StatusCode == http.StatusNotFound:
+		// order without address is allowed until user fills the address book
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.Errorf("unexpected status %d of address lookup", resp.StatusCode)
+	}
+
+	var readAddressResponse struct {
+		Recipient  string `json:"recipient"`
+		Phone      string `json:"phone"`
+		Country    string `json:"country"`
+		Region     string `json:"region"`
+		City       string `json:"city"`
+		PostalCode string `json:"postalCode"`
+		Line1      string `json:"line1"`
+		Line2      string `json:"line2"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&readAddressResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	return &order.Address{
+		Recipient:  readAddressResponse.Recipient,
+		Phone:      readAddressResponse.Phone,
+		Country:    readAddressResponse.Country,
+		Region:     readAddressResponse.Region,
+		City:       readAddressResponse.City,
+		PostalCode: readAddressResponse.PostalCode,
+		Line1:      readAddressResponse.Line1,
+		Line2:      readAddressResponse.Line2,
+	}, nil
+}
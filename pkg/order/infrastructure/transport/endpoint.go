@@ -20,9 +20,21 @@ type readOrdersResponse struct {
 }
 
 type Order struct {
-	OrderID  string    `json:"orderID,omitempty"`
-	Status   string    `json:"status,omitempty"`
-	Products []Product `json:"products,omitempty"`
+	OrderID         string    `json:"orderID,omitempty"`
+	Status          string    `json:"status,omitempty"`
+	Products        []Product `json:"products,omitempty"`
+	ShippingAddress *Address  `json:"shippingAddress,omitempty"`
+}
+
+type Address struct {
+	Recipient  string `json:"recipient"`
+	Phone      string `json:"phone,omitempty"`
+	Country    string `json:"country"`
+	Region     string `json:"region,omitempty"`
+	City       string `json:"city"`
+	PostalCode string `json:"postalCode"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
 }
 
 type Product struct {
@@ -44,6 +56,8 @@ func makeReadOrdersEndpoint(repo order.Repository) endpoint.Endpoint {
 					status = "pending"
 				case order.Completed:
 					status = "completed"
+				case order.Cancelled:
+					status = "cancelled"
 				}
 
 				var products []Product
@@ -53,10 +67,24 @@ func makeReadOrdersEndpoint(repo order.Repository) endpoint.Endpoint {
 						ProductID: p.ProductID,
 					})
 				}
+				var shippingAddress *Address
+				if a := o.ShippingAddress; a != nil {
+					shippingAddress = &Address{
+						Recipient:  a.Recipient,
+						Phone:      a.Phone,
+						Country:    a.Country,
+						Region:     a.Region,
+						City:       a.City,
+						PostalCode: a.PostalCode,
+						Line1:      a.Line1,
+						Line2:      a.Line2,
+					}
+				}
 				responseOrders = append(responseOrders, Order{
-					OrderID:  string(o.ID),
-					Status:   status,
-					Products: products,
+					OrderID:         string(o.ID),
+					Status:          status,
+					Products:        products,
+					ShippingAddress: shippingAddress,
 				})
 			}
 
@@ -66,7 +94,8 @@ func makeReadOrdersEndpoint(repo order.Repository) endpoint.Endpoint {
 }
 
 type createOrderRequest struct {
-	UserID string
+	UserID    string
+	AddressID string
 }
 
 type createOrderResponse struct {
@@ -76,7 +105,7 @@ type createOrderResponse struct {
 func makeCreateOrderEndpoint(service *order.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(createOrderRequest)
-		if id, err := service.CreateOrder(req.UserID); err != nil {
+		if id, err := service.CreateOrder(req.UserID, req.AddressID); err != nil {
 			return createOrderResponse{}, err
 		} else {
 			return createOrderResponse{OrderID: string(id)}, nil
@@ -84,6 +113,21 @@ func makeCreateOrderEndpoint(service *order.Service) endpoint.Endpoint {
 	}
 }
 
+type cancelOrderRequest struct {
+	UserID  string
+	OrderID string
+}
+
+type cancelOrderResponse struct{}
+
+func makeCancelOrderEndpoint(service *order.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(cancelOrderRequest)
+		err := service.CancelOrder(req.UserID, req.OrderID)
+		return cancelOrderResponse{}, err
+	}
+}
+
 type payOrderRequest struct {
 	OrderID string
 }
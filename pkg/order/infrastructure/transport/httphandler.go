@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 
 	httplog "github.com/go-kit/kit/log"
@@ -13,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ilya-shikhaleev/arch-course/pkg/common/amqp"
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
 	"github.com/ilya-shikhaleev/arch-course/pkg/order/app/order"
 )
 
@@ -21,6 +23,7 @@ func MakeHandler(service *order.Service, repo order.Repository, logger httplog.L
 	opts := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(authz.ServerBefore),
 	}
 
 	readOrderHandler := httptransport.NewServer(
@@ -44,19 +47,54 @@ func MakeHandler(service *order.Service, repo order.Repository, logger httplog.L
 		opts...,
 	)
 
+	cancelOrderHandler := httptransport.NewServer(
+		makeCancelOrderEndpoint(service),
+		decodeCancelOrderRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	exportOrdersHandler := httptransport.NewServer(
+		makeReadOrdersEndpoint(repo),
+		decodeExportOrdersRequest,
+		encodeResponse,
+		opts...,
+	)
+
 	r.Handle("/api/v1/orders", readOrderHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/orders/{id}/cancel", cancelOrderHandler).Methods(http.MethodPost)
 	r.Handle("/api/v1/internal/orders/{id}", payOrderHandler).Methods(http.MethodPatch)
 	r.Handle("/api/v1/orders", createOrderHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/internal/users/{userId}/orders", exportOrdersHandler).Methods(http.MethodGet)
 
 	return r
 }
 
-func decodeReadOrdersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+func decodeReadOrdersRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	userID := r.Header.Get("X-User-Id")
 	if userID == "" {
 		return nil, newErrUnauthorized(fmt.Sprintf("can read only self user order (%s)", r.Header.Get("X-User-Id")))
 	}
 
+	// support staff reads data of other users
+	if requestedUserID := r.URL.Query().Get("userId"); requestedUserID != "" && requestedUserID != userID {
+		if !authz.HasPermission(ctx, authz.ReadAnyOrder) {
+			return nil, authz.ErrForbidden
+		}
+		userID = requestedUserID
+	}
+
+	req := readOrdersRequest{UserID: userID}
+	return req, nil
+}
+
+// decodeExportOrdersRequest serves personal data export of the user service, the user is not the caller
+func decodeExportOrdersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID, ok := mux.Vars(r)["userId"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "user id required for export orders request")
+	}
+
 	req := readOrdersRequest{UserID: userID}
 	return req, nil
 }
@@ -82,7 +120,36 @@ func decodeCreateOrderRequest(_ context.Context, r *http.Request) (interface{},
 	if userID == "" {
 		return nil, newErrUnauthorized(fmt.Sprintf("can read only self user order (%s)", r.Header.Get("X-User-Id")))
 	}
-	req := createOrderRequest{UserID: userID}
+	// unverified users can browse and fill the cart, but can't order, absent header is not trusted either
+	if r.Header.Get("X-Email-Verified") != "true" {
+		return nil, newErrForbidden("email must be verified to create order")
+	}
+
+	// body is optional, order without address id ships to the default address
+	var body struct {
+		AddressID string `json:"addressId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		return nil, newErrInvalidRequest(err, "invalid create order request")
+	}
+
+	req := createOrderRequest{UserID: userID, AddressID: body.AddressID}
+	return req, nil
+}
+
+func decodeCancelOrderRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for cancel order request")
+	}
+
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for cancel order request")
+	}
+
+	req := cancelOrderRequest{UserID: userID, OrderID: id}
 	return req, nil
 }
 
@@ -99,18 +166,34 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
+	if outOfStockErr, ok := err.(*order.OutOfStockError); ok {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":      outOfStockErr.Error(),
+			"productIds": outOfStockErr.ProductIDs,
+		})
+		return
+	}
+
 	if invalidRequestErr, ok := err.(*errInvalidRequest); ok {
 		w.WriteHeader(http.StatusBadRequest)
 		err = errors.New(invalidRequestErr.message)
 	} else if unauthorizedErr, ok := err.(*errUnauthorized); ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		err = errors.New(unauthorizedErr.message)
+	} else if forbiddenErr, ok := err.(*errForbidden); ok {
+		w.WriteHeader(http.StatusForbidden)
+		err = errors.New(forbiddenErr.message)
 	} else {
-		switch err {
+		switch errors.Cause(err) {
 		case order.ErrOrderNotFound:
 			w.WriteHeader(http.StatusNotFound)
-		case order.ErrEmptyCart:
+		case authz.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+		case order.ErrEmptyCart, order.ErrAddressNotFound:
 			w.WriteHeader(http.StatusBadRequest)
+		case order.ErrOrderNotPending, order.ErrReservationExpired:
+			w.WriteHeader(http.StatusConflict)
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -157,3 +240,17 @@ func newErrUnauthorized(message string) *errUnauthorized {
 func (e *errUnauthorized) Error() string {
 	return e.message
 }
+
+type errForbidden struct {
+	message string
+}
+
+func newErrForbidden(message string) *errForbidden {
+	return &errForbidden{
+		message: message,
+	}
+}
+
+func (e *errForbidden) Error() string {
+	return e.message
+}
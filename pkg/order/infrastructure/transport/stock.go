@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/order/app/order"
+)
+
+const productHost = "http://product-product-chart.arch-course.svc.cluster.local:9000" // TODO: use env variable here
+
+func NewStockReserver() *StockReserver {
+	return &StockReserver{}
+}
+
+// StockReserver holds products of orders in the product service inventory
+type StockReserver struct {
+}
+
+func (s *StockReserver) Reserve(orderID order.ID, products []order.Product) error {
+	type item struct {
+		ProductID string `json:"productId"`
+		Quantity  int    `json:"quantity"`
+	}
+	var body struct {
+		ID    string `json:"id"`
+		Items []item `json:"items"`
+	}
+	body.ID = string(orderID)
+	for _, p := range products {
+		body.Items = append(body.Items, item{ProductID: p.ProductID, Quantity: 1})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, productHost+"/api/v1/internal/reservations", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		var outOfStockResponse struct {
+			ProductIDs []string `json:"productIds"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&outOfStockResponse); err != nil {
+			return err
+		}
+		return &order.OutOfStockError{ProductIDs: outOfStockResponse.ProductIDs}
+	default:
+		return errors.Errorf("unexpected status %d of stock reservation", resp.StatusCode)
+	}
+}
+
+func (s *StockReserver) Commit(orderID order.ID) error {
+	return closeReservation(orderID, "commit", order.ErrReservationExpired)
+}
+
+func (s *StockReserver) Release(orderID order.ID) error {
+	// reservation conflicts on release only when it is committed by payment
+	return closeReservation(orderID, "release", order.ErrOrderNotPending)
+}
+
+// closeReservation ignores missing reservation, orders created before inventory was introduced have none
+func closeReservation(orderID order.ID, action string, conflictErr error) error {
+	req, err := http.NewRequest(http.MethodPost, productHost+"/api/v1/internal/reservations/"+string(orderID)+"/"+action, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusConflict:
+		return conflictErr
+	default:
+		return errors.Errorf("unexpected status %d of stock reservation %s", resp.StatusCode, action)
+	}
+}
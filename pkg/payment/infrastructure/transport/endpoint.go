@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
 )
 
 type payOrderRequest struct {
@@ -27,7 +28,22 @@ func makePayOrderEndpoint() endpoint.Endpoint {
 
 		httpReq.Header.Add("X-User-Id", req.UserID)
 		client := &http.Client{}
-		_, err = client.Do(httpReq)
-		return payOrderResponse{}, err
+		resp, err := client.Do(httpReq)
+		if err != nil {
+			return payOrderResponse{}, err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return payOrderResponse{}, nil
+		case http.StatusConflict:
+			return payOrderResponse{}, errOrderNotPayable
+		default:
+			return payOrderResponse{}, errors.Errorf("unexpected status %d of order payment", resp.StatusCode)
+		}
 	}
 }
+
+// errOrderNotPayable is returned for cancelled order or order with expired stock reservation
+var errOrderNotPayable = errors.New("order can't be paid, it is cancelled or its products are not reserved anymore")
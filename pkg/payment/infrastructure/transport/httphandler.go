@@ -68,6 +68,8 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	} else if unauthorizedErr, ok := err.(*errUnauthorized); ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		err = errors.New(unauthorizedErr.message)
+	} else if err == errOrderNotPayable {
+		w.WriteHeader(http.StatusConflict)
 	} else {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -0,0 +1,57 @@
+package catalog
+
+import (
+	"errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+// MetaProduct is a catalog item, customers buy its variants
+type MetaProduct struct {
+	ID          product.MetaProductID
+	Title       string
+	Description string
+	Material    product.Material
+	Variants    []Variant
+}
+
+type Variant struct {
+	ID     product.ID
+	Height *int
+	Color  *string
+	Price  float32
+}
+
+// PriceRange returns the lowest and the highest price of variants, ok is false for meta product without variants
+func (m MetaProduct) PriceRange() (min, max float32, ok bool) {
+	for i, v := range m.Variants {
+		if i == 0 || v.Price < min {
+			min = v.Price
+		}
+		if i == 0 || v.Price > max {
+			max = v.Price
+		}
+	}
+	return min, max, len(m.Variants) > 0
+}
+
+// Repository changes meta product and its variants atomically, so concurrent admin requests don't lose changes.
+// New variant gets empty stock, stock of removed variant is removed with it.
+// Missing meta product or variant is reported by ErrMetaProductNotFound and ErrVariantNotFound
+type Repository interface {
+	Find(product.MetaProductID) (*MetaProduct, error)
+	// Create stores new meta product together with its variants
+	Create(*MetaProduct) error
+	// Update changes fields of meta product and reads its variants in the same transaction, variants are not changed
+	Update(*MetaProduct) error
+	// Remove deletes meta product together with its variants
+	Remove(product.MetaProductID) error
+	AddVariant(product.MetaProductID, *Variant) error
+	UpdateVariant(product.MetaProductID, *Variant) error
+	RemoveVariant(product.MetaProductID, product.ID) error
+	NextMetaProductID() (product.MetaProductID, error)
+	NextVariantID() (product.ID, error)
+}
+
+var ErrMetaProductNotFound = errors.New("meta product not found")
+var ErrVariantNotFound = errors.New("product variant not found")
@@ -0,0 +1,24 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaProduct_PriceRange(t *testing.T) {
+	m := MetaProduct{Variants: []Variant{{Price: 20}, {Price: 10.5}, {Price: 30}, {Price: 20}}}
+	min, max, ok := m.PriceRange()
+	assert.True(t, ok)
+	assert.Equal(t, float32(10.5), min)
+	assert.Equal(t, float32(30), max)
+
+	m = MetaProduct{Variants: []Variant{{Price: 15}}}
+	min, max, ok = m.PriceRange()
+	assert.True(t, ok)
+	assert.Equal(t, float32(15), min)
+	assert.Equal(t, float32(15), max)
+
+	_, _, ok = MetaProduct{}.PriceRange()
+	assert.False(t, ok, "meta product without variants has no price range")
+}
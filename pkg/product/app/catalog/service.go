@@ -0,0 +1,97 @@
+package catalog
+
+import (
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// Service manages the catalog, product.Repository reads it for customers
+type Service struct {
+	repo Repository
+}
+
+func (s *Service) MetaProduct(id product.MetaProductID) (*MetaProduct, error) {
+	return s.repo.Find(id)
+}
+
+// CreateMetaProduct creates meta product with variants, ids of passed variants are ignored
+func (s *Service) CreateMetaProduct(title, description string, material product.Material, variants []Variant) (*MetaProduct, error) {
+	m := &MetaProduct{
+		Title:       title,
+		Description: description,
+		Material:    material,
+		Variants:    append([]Variant(nil), variants...),
+	}
+	if err := validateMetaProduct(m); err != nil {
+		return nil, err
+	}
+
+	id, err := s.repo.NextMetaProductID()
+	if err != nil {
+		return nil, err
+	}
+	m.ID = id
+	for i := range m.Variants {
+		if m.Variants[i].ID, err = s.repo.NextVariantID(); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.repo.Create(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// UpdateMetaProduct changes fields shared by all variants
+func (s *Service) UpdateMetaProduct(id product.MetaProductID, title, description string, material product.Material) (*MetaProduct, error) {
+	m := &MetaProduct{
+		ID:          id,
+		Title:       title,
+		Description: description,
+		Material:    material,
+	}
+	if err := validateMetaProduct(m); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *Service) RemoveMetaProduct(id product.MetaProductID) error {
+	return s.repo.Remove(id)
+}
+
+func (s *Service) AddVariant(metaProductID product.MetaProductID, v Variant) (*Variant, error) {
+	if err := validateVariant(&v); err != nil {
+		return nil, err
+	}
+	id, err := s.repo.NextVariantID()
+	if err != nil {
+		return nil, err
+	}
+	v.ID = id
+	if err = s.repo.AddVariant(metaProductID, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (s *Service) UpdateVariant(metaProductID product.MetaProductID, id product.ID, v Variant) (*Variant, error) {
+	if err := validateVariant(&v); err != nil {
+		return nil, err
+	}
+	v.ID = id
+	if err := s.repo.UpdateVariant(metaProductID, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (s *Service) RemoveVariant(metaProductID product.MetaProductID, id product.ID) error {
+	return s.repo.RemoveVariant(metaProductID, id)
+}
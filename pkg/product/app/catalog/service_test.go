@@ -0,0 +1,170 @@
+package catalog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+func TestCatalogService_CreateMetaProduct(t *testing.T) {
+	repo := newMockRepo()
+	service := NewService(repo)
+
+	m, err := service.CreateMetaProduct(" Gopher ", "", product.Paper, []Variant{{ID: "ignored", Price: 10}, {Price: 20}})
+	assert.Nil(t, err)
+	assert.Equal(t, product.MetaProductID("m1"), m.ID)
+	assert.Equal(t, "Gopher", m.Title)
+	assert.Equal(t, []product.ID{"v1", "v2"}, variantIDs(m.Variants))
+	assert.Equal(t, m, repo.metaProducts[m.ID])
+
+	_, err = service.CreateMetaProduct("Gopher", "", product.Paper, []Variant{{Price: 0}})
+	assert.IsType(t, &ValidationError{}, err)
+	assert.Len(t, repo.metaProducts, 1, "invalid meta product isn't stored")
+}
+
+func TestCatalogService_UpdateMetaProduct(t *testing.T) {
+	repo := newMockRepo()
+	service := NewService(repo)
+	created, err := service.CreateMetaProduct("Gopher", "", product.Paper, []Variant{{Price: 10}})
+	assert.Nil(t, err)
+
+	m, err := service.UpdateMetaProduct(created.ID, "Crab ", "red", product.FullMetal)
+	assert.Nil(t, err)
+	assert.Equal(t, "Crab", m.Title)
+	assert.Equal(t, product.FullMetal, m.Material)
+	assert.Equal(t, created.Variants, m.Variants, "variants are returned with updated meta product")
+
+	_, err = service.UpdateMetaProduct(created.ID, "", "", product.FullMetal)
+	assert.IsType(t, &ValidationError{}, err)
+	_, err = service.UpdateMetaProduct("unknown", "Crab", "", product.FullMetal)
+	assert.Equal(t, ErrMetaProductNotFound, err)
+}
+
+func TestCatalogService_Variants(t *testing.T) {
+	repo := newMockRepo()
+	service := NewService(repo)
+	m, err := service.CreateMetaProduct("Gopher", "", product.Paper, nil)
+	assert.Nil(t, err)
+
+	v, err := service.AddVariant(m.ID, Variant{ID: "ignored", Color: strPtr(" red "), Price: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, product.ID("v1"), v.ID)
+	assert.Equal(t, "red", *v.Color)
+	_, err = service.AddVariant("unknown", Variant{Price: 10})
+	assert.Equal(t, ErrMetaProductNotFound, err)
+	_, err = service.AddVariant(m.ID, Variant{Price: -1})
+	assert.IsType(t, &ValidationError{}, err)
+
+	v, err = service.UpdateVariant(m.ID, v.ID, Variant{Price: 15})
+	assert.Nil(t, err)
+	assert.Equal(t, []Variant{*v}, repo.metaProducts[m.ID].Variants)
+	_, err = service.UpdateVariant(m.ID, "unknown", Variant{Price: 15})
+	assert.Equal(t, ErrVariantNotFound, err)
+
+	assert.Nil(t, service.RemoveVariant(m.ID, v.ID))
+	assert.Empty(t, repo.metaProducts[m.ID].Variants)
+	assert.Equal(t, ErrVariantNotFound, service.RemoveVariant(m.ID, v.ID))
+
+	assert.Nil(t, service.RemoveMetaProduct(m.ID))
+	_, err = service.MetaProduct(m.ID)
+	assert.Equal(t, ErrMetaProductNotFound, err)
+}
+
+func variantIDs(variants []Variant) []product.ID {
+	var ids []product.ID
+	for _, v := range variants {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
+
+func newMockRepo() *mockRepo {
+	return &mockRepo{metaProducts: map[product.MetaProductID]*MetaProduct{}}
+}
+
+type mockRepo struct {
+	metaProducts map[product.MetaProductID]*MetaProduct
+	lastMeta     int
+	lastVariant  int
+}
+
+func (repo *mockRepo) Find(id product.MetaProductID) (*MetaProduct, error) {
+	m, ok := repo.metaProducts[id]
+	if !ok {
+		return nil, ErrMetaProductNotFound
+	}
+	return m, nil
+}
+
+func (repo *mockRepo) Create(m *MetaProduct) error {
+	repo.metaProducts[m.ID] = m
+	return nil
+}
+
+func (repo *mockRepo) Update(m *MetaProduct) error {
+	stored, ok := repo.metaProducts[m.ID]
+	if !ok {
+		return ErrMetaProductNotFound
+	}
+	m.Variants = stored.Variants
+	repo.metaProducts[m.ID] = m
+	return nil
+}
+
+func (repo *mockRepo) Remove(id product.MetaProductID) error {
+	if _, ok := repo.metaProducts[id]; !ok {
+		return ErrMetaProductNotFound
+	}
+	delete(repo.metaProducts, id)
+	return nil
+}
+
+func (repo *mockRepo) AddVariant(id product.MetaProductID, v *Variant) error {
+	m, ok := repo.metaProducts[id]
+	if !ok {
+		return ErrMetaProductNotFound
+	}
+	m.Variants = append(m.Variants, *v)
+	return nil
+}
+
+func (repo *mockRepo) UpdateVariant(id product.MetaProductID, v *Variant) error {
+	m, ok := repo.metaProducts[id]
+	if !ok {
+		return ErrMetaProductNotFound
+	}
+	for i := range m.Variants {
+		if m.Variants[i].ID == v.ID {
+			m.Variants[i] = *v
+			return nil
+		}
+	}
+	return ErrVariantNotFound
+}
+
+func (repo *mockRepo) RemoveVariant(id product.MetaProductID, variantID product.ID) error {
+	m, ok := repo.metaProducts[id]
+	if !ok {
+		return ErrMetaProductNotFound
+	}
+	for i := range m.Variants {
+		if m.Variants[i].ID == variantID {
+			m.Variants = append(m.Variants[:i], m.Variants[i+1:]...)
+			return nil
+		}
+	}
+	return ErrVariantNotFound
+}
+
+func (repo *mockRepo) NextMetaProductID() (product.MetaProductID, error) {
+	repo.lastMeta++
+	return product.MetaProductID(fmt.Sprintf("m%d", repo.lastMeta)), nil
+}
+
+func (repo *mockRepo) NextVariantID() (product.ID, error) {
+	repo.lastVariant++
+	return product.ID(fmt.Sprintf("v%d", repo.lastVariant)), nil
+}
@@ -0,0 +1,105 @@
+package catalog
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+// Limits follow column sizes of the catalog tables
+const (
+	maxTitleLength       = 255
+	maxDescriptionLength = 255
+	maxColorLength       = 255
+	maxHeight            = 10000
+)
+
+// Field names match json fields of the admin api
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldMaterial    = "material"
+	FieldVariants    = "variants"
+	FieldHeight      = "height"
+	FieldColor       = "color"
+	FieldPrice       = "price"
+)
+
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError lists all invalid fields of the request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		fields = append(fields, field.Field)
+	}
+	return "invalid fields: " + strings.Join(fields, ", ")
+}
+
+// validateMetaProduct trims text fields of meta product and its variants
+func validateMetaProduct(m *MetaProduct) error {
+	m.Title = strings.TrimSpace(m.Title)
+	m.Description = strings.TrimSpace(m.Description)
+
+	var fields []FieldError
+	if m.Title == "" {
+		fields = append(fields, FieldError{FieldTitle, "is required"})
+	} else if utf8.RuneCountInString(m.Title) > maxTitleLength {
+		fields = append(fields, FieldError{FieldTitle, "is too long"})
+	}
+	if utf8.RuneCountInString(m.Description) > maxDescriptionLength {
+		fields = append(fields, FieldError{FieldDescription, "is too long"})
+	}
+	switch m.Material {
+	case product.Paper, product.FullMetal, product.Template:
+	default:
+		fields = append(fields, FieldError{FieldMaterial, "must be paper, fullmetal or template"})
+	}
+	for i := range m.Variants {
+		prefix := fmt.Sprintf("%s[%d].", FieldVariants, i)
+		fields = append(fields, variantFieldErrors(&m.Variants[i], prefix)...)
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+func validateVariant(v *Variant) error {
+	if fields := variantFieldErrors(v, ""); len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// variantFieldErrors reports fields with prefix, so errors of variants in meta product can be told apart
+func variantFieldErrors(v *Variant, prefix string) []FieldError {
+	var fields []FieldError
+	if v.Height != nil && (*v.Height <= 0 || *v.Height > maxHeight) {
+		fields = append(fields, FieldError{prefix + FieldHeight, fmt.Sprintf("must be from 1 to %d", maxHeight)})
+	}
+	if v.Color != nil {
+		color := strings.TrimSpace(*v.Color)
+		v.Color = &color
+		if color == "" {
+			fields = append(fields, FieldError{prefix + FieldColor, "must not be empty"})
+		} else if utf8.RuneCountInString(color) > maxColorLength {
+			fields = append(fields, FieldError{prefix + FieldColor, "is too long"})
+		}
+	}
+	if price := float64(v.Price); price <= 0 || math.IsInf(price, 0) || math.IsNaN(price) {
+		fields = append(fields, FieldError{prefix + FieldPrice, "must be positive"})
+	}
+	return fields
+}
@@ -0,0 +1,120 @@
+package catalog
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+func TestValidateMetaProduct(t *testing.T) {
+	tests := []struct {
+		name        string
+		m           MetaProduct
+		fields      []string
+		title       string
+		description string
+	}{
+		{
+			name:        "text fields are trimmed",
+			m:           MetaProduct{Title: "  Gopher \n", Description: "\tblue ", Material: product.Paper},
+			title:       "Gopher",
+			description: "blue",
+		},
+		{
+			name:   "blank title is required",
+			m:      MetaProduct{Title: "   ", Material: product.FullMetal},
+			fields: []string{FieldTitle},
+		},
+		{
+			name:   "long text fields",
+			m:      MetaProduct{Title: strings.Repeat("ж", maxTitleLength+1), Description: strings.Repeat("ж", maxDescriptionLength+1), Material: product.Template},
+			fields: []string{FieldTitle, FieldDescription},
+		},
+		{
+			name:  "length is counted in runes",
+			m:     MetaProduct{Title: strings.Repeat("ж", maxTitleLength), Material: product.Template},
+			title: strings.Repeat("ж", maxTitleLength),
+		},
+		{
+			name:   "unknown material",
+			m:      MetaProduct{Title: "Gopher", Material: 42},
+			fields: []string{FieldMaterial},
+		},
+		{
+			name: "variant fields are prefixed with index",
+			m: MetaProduct{Title: "Gopher", Material: product.Paper, Variants: []Variant{
+				{Price: 10},
+				{Height: intPtr(0), Color: strPtr(" "), Price: float32(math.NaN())},
+			}},
+			fields: []string{"variants[1].height", "variants[1].color", "variants[1].price"},
+			title:  "Gopher",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateMetaProduct(&test.m)
+			assert.Equal(t, test.fields, fieldNames(err))
+			if test.title != "" {
+				assert.Equal(t, test.title, test.m.Title)
+			}
+			if test.description != "" {
+				assert.Equal(t, test.description, test.m.Description)
+			}
+		})
+	}
+}
+
+func TestVariantFieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		v      Variant
+		fields []string
+		color  string
+	}{
+		{name: "valid", v: Variant{Height: intPtr(maxHeight), Color: strPtr(" red\t"), Price: 0.5}, color: "red"},
+		{name: "variant without height and color", v: Variant{Price: 1}},
+		{name: "zero height", v: Variant{Height: intPtr(0), Price: 1}, fields: []string{"v.height"}},
+		{name: "too high", v: Variant{Height: intPtr(maxHeight + 1), Price: 1}, fields: []string{"v.height"}},
+		{name: "blank color", v: Variant{Color: strPtr("  "), Price: 1}, fields: []string{"v.color"}},
+		{name: "long color", v: Variant{Color: strPtr(strings.Repeat("a", maxColorLength+1)), Price: 1}, fields: []string{"v.color"}},
+		{name: "zero price", v: Variant{}, fields: []string{"v.price"}},
+		{name: "negative price", v: Variant{Price: -1}, fields: []string{"v.price"}},
+		{name: "NaN price", v: Variant{Price: float32(math.NaN())}, fields: []string{"v.price"}},
+		{name: "infinite price", v: Variant{Price: float32(math.Inf(1))}, fields: []string{"v.price"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var names []string
+			for _, field := range variantFieldErrors(&test.v, "v.") {
+				names = append(names, field.Field)
+			}
+			assert.Equal(t, test.fields, names)
+			if test.color != "" {
+				assert.Equal(t, test.color, *test.v.Color)
+			}
+		})
+	}
+}
+
+func fieldNames(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var names []string
+	for _, field := range err.(*ValidationError).Fields {
+		names = append(names, field.Field)
+	}
+	return names
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,85 @@
+package inventory
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+// ReservationID is id of the order holding the items, so repeated reservation of the order doesn't hold stock twice
+type ReservationID string
+
+type Status int
+
+const (
+	Pending Status = iota
+	Committed
+	Released
+)
+
+// StockLevel counts items in the warehouse, Reserved items are held by pending orders and can't be sold again
+type StockLevel struct {
+	ProductID product.ID
+	OnHand    int
+	Reserved  int
+}
+
+func (l StockLevel) Available() int {
+	if available := l.OnHand - l.Reserved; available > 0 {
+		return available
+	}
+	return 0
+}
+
+type Item struct {
+	ProductID product.ID
+	Quantity  int
+}
+
+// Reservation holds items until the order is paid or cancelled, pending reservation is released after ExpiresAt
+type Reservation struct {
+	ID        ReservationID
+	Items     []Item
+	Status    Status
+	ExpiresAt time.Time
+}
+
+// Repository changes stock levels together with reservation status in one transaction
+type Repository interface {
+	// StockLevel returns zero level for product without stock
+	StockLevel(product.ID) (*StockLevel, error)
+	// SetOnHand returns product.ErrProductNotFound for unknown product
+	SetOnHand(id product.ID, quantity int) error
+	// Reserve stores pending reservation, nothing is held and OutOfStockError is returned when any product lacks items.
+	// ErrReservationExists is returned when reservation with the id is stored already
+	Reserve(*Reservation) error
+	FindReservation(ReservationID) (*Reservation, error)
+	// Commit takes reserved items from stock, ErrReservationClosed is returned when reservation is not pending before deadline
+	Commit(id ReservationID, deadline time.Time) error
+	// Release returns reserved items to stock, ErrReservationClosed is returned when reservation is not pending
+	Release(ReservationID) error
+	ExpiredReservations(now time.Time) ([]ReservationID, error)
+}
+
+// OutOfStockError lists products which have less items than requested
+type OutOfStockError struct {
+	ProductIDs []product.ID
+}
+
+func (e *OutOfStockError) Error() string {
+	ids := make([]string, 0, len(e.ProductIDs))
+	for _, id := range e.ProductIDs {
+		ids = append(ids, string(id))
+	}
+	return "out of stock: " + strings.Join(ids, ", ")
+}
+
+var ErrReservationNotFound = errors.New("reservation not found")
+var ErrReservationExists = errors.New("reservation already exists")
+var ErrReservationExpired = errors.New("reservation expired")
+var ErrReservationCommitted = errors.New("reservation is already committed")
+var ErrReservationClosed = errors.New("reservation is not pending")
+var ErrInvalidReservation = errors.New("invalid reservation")
+var ErrInvalidStock = errors.New("stock level must not be negative")
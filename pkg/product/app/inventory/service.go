@@ -0,0 +1,142 @@
+package inventory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+func NewService(repo Repository, reservationTTL time.Duration) *Service {
+	return &Service{repo: repo, reservationTTL: reservationTTL}
+}
+
+type Service struct {
+	repo           Repository
+	reservationTTL time.Duration
+}
+
+func (s *Service) StockLevel(id product.ID) (*StockLevel, error) {
+	return s.repo.StockLevel(id)
+}
+
+// SetStock sets count of items in the warehouse, reserved items are counted in it
+func (s *Service) SetStock(id product.ID, onHand int) (*StockLevel, error) {
+	if onHand < 0 {
+		return nil, ErrInvalidStock
+	}
+	if err := s.repo.SetOnHand(id, onHand); err != nil {
+		return nil, err
+	}
+	return s.repo.StockLevel(id)
+}
+
+// Reserve holds items for the order. Repeated call for pending reservation returns it unchanged,
+// so order service can retry the request
+func (s *Service) Reserve(id ReservationID, items []Item) (*Reservation, error) {
+	items, err := mergeItems(items)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reservation{
+		ID:        id,
+		Items:     items,
+		Status:    Pending,
+		ExpiresAt: time.Now().Add(s.reservationTTL),
+	}
+	err = s.repo.Reserve(r)
+	switch err {
+	case nil:
+		return r, nil
+	case ErrReservationExists:
+		existing, err := s.repo.FindReservation(id)
+		if err != nil {
+			return nil, err
+		}
+		if existing.Status == Pending && time.Now().Before(existing.ExpiresAt) {
+			return existing, nil
+		}
+		return nil, ErrReservationClosed
+	default:
+		return nil, err
+	}
+}
+
+// Commit sells reserved items, it is called when the order is paid
+func (s *Service) Commit(id ReservationID) error {
+	err := s.repo.Commit(id, time.Now())
+	if err != ErrReservationClosed {
+		return err
+	}
+
+	r, err := s.repo.FindReservation(id)
+	if err != nil {
+		return err
+	}
+	switch r.Status {
+	case Committed:
+		return nil
+	case Pending:
+		// expired reservation is released here, the sweeper may not have run yet
+		if err = s.repo.Release(id); err != nil && err != ErrReservationClosed {
+			return err
+		}
+	}
+	return ErrReservationExpired
+}
+
+// Release returns items of cancelled order to stock, released reservation is released again without error
+func (s *Service) Release(id ReservationID) error {
+	err := s.repo.Release(id)
+	if err != ErrReservationClosed {
+		return err
+	}
+
+	r, err := s.repo.FindReservation(id)
+	if err != nil {
+		return err
+	}
+	if r.Status == Committed {
+		return ErrReservationCommitted
+	}
+	return nil
+}
+
+// ReleaseExpired frees stock held by abandoned orders
+func (s *Service) ReleaseExpired() error {
+	ids, err := s.repo.ExpiredReservations(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err = s.repo.Release(id); err != nil && err != ErrReservationClosed {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeItems sums quantities of the same product and sorts items by product,
+// so concurrent reservations lock stock rows in the same order
+func mergeItems(items []Item) ([]Item, error) {
+	if len(items) == 0 {
+		return nil, ErrInvalidReservation
+	}
+	quantities := make(map[product.ID]int)
+	for _, item := range items {
+		if item.ProductID == "" || item.Quantity <= 0 {
+			return nil, ErrInvalidReservation
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	merged := make([]Item, 0, len(quantities))
+	for id, quantity := range quantities {
+		merged = append(merged, Item{ProductID: id, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ProductID < merged[j].ProductID
+	})
+	return merged, nil
+}
@@ -0,0 +1,247 @@
+package inventory
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+func TestInventoryService_ReserveIsIdempotent(t *testing.T) {
+	repo := newMockRepo(map[product.ID]int{"gopher": 10})
+	service := NewService(repo, time.Minute)
+
+	r, err := service.Reserve("order", []Item{{ProductID: "gopher", Quantity: 3}})
+	assert.Nil(t, err)
+	repeated, err := service.Reserve("order", []Item{{ProductID: "gopher", Quantity: 3}})
+	assert.Nil(t, err)
+	assert.Equal(t, r.ExpiresAt, repeated.ExpiresAt)
+
+	level, err := service.StockLevel("gopher")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, level.Reserved, "repeated request doesn't hold items twice")
+	assert.Equal(t, 7, level.Available())
+
+	assert.Nil(t, service.Release("order"))
+	_, err = service.Reserve("order", []Item{{ProductID: "gopher", Quantity: 3}})
+	assert.Equal(t, ErrReservationClosed, err, "closed reservation is not opened again")
+}
+
+func TestInventoryService_OutOfStock(t *testing.T) {
+	repo := newMockRepo(map[product.ID]int{"gopher": 10, "crab": 1, "whale": 0})
+	service := NewService(repo, time.Minute)
+
+	_, err := service.Reserve("order", []Item{
+		{ProductID: "whale", Quantity: 1},
+		{ProductID: "gopher", Quantity: 2},
+		{ProductID: "crab", Quantity: 2},
+	})
+	outOfStock, ok := err.(*OutOfStockError)
+	assert.True(t, ok)
+	assert.Equal(t, []product.ID{"crab", "whale"}, outOfStock.ProductIDs, "all missing products are listed")
+
+	level, _ := service.StockLevel("gopher")
+	assert.Equal(t, 0, level.Reserved, "nothing is held when any product is missing")
+	_, err = repo.FindReservation("order")
+	assert.Equal(t, ErrReservationNotFound, err)
+}
+
+func TestInventoryService_CommitAfterExpiry(t *testing.T) {
+	repo := newMockRepo(map[product.ID]int{"gopher": 10})
+	service := NewService(repo, -time.Second)
+
+	_, err := service.Reserve("order", []Item{{ProductID: "gopher", Quantity: 3}})
+	assert.Nil(t, err)
+	assert.Equal(t, ErrReservationExpired, service.Commit("order"))
+
+	level, _ := service.StockLevel("gopher")
+	assert.Equal(t, StockLevel{ProductID: "gopher", OnHand: 10}, *level, "expired items are returned to stock")
+	r, _ := repo.FindReservation("order")
+	assert.Equal(t, Released, r.Status)
+	assert.Equal(t, ErrReservationExpired, service.Commit("order"))
+}
+
+func TestInventoryService_ReleaseAfterCommit(t *testing.T) {
+	repo := newMockRepo(map[product.ID]int{"gopher": 10})
+	service := NewService(repo, time.Minute)
+
+	_, err := service.Reserve("order", []Item{{ProductID: "gopher", Quantity: 3}})
+	assert.Nil(t, err)
+	assert.Nil(t, service.Commit("order"))
+	assert.Nil(t, service.Commit("order"), "paid order is committed again without error")
+	assert.Equal(t, ErrReservationCommitted, service.Release("order"))
+
+	level, _ := service.StockLevel("gopher")
+	assert.Equal(t, StockLevel{ProductID: "gopher", OnHand: 7}, *level)
+
+	_, err = service.Reserve("cancelled", []Item{{ProductID: "gopher", Quantity: 1}})
+	assert.Nil(t, err)
+	assert.Nil(t, service.Release("cancelled"))
+	assert.Nil(t, service.Release("cancelled"), "cancelled order is released again without error")
+	level, _ = service.StockLevel("gopher")
+	assert.Equal(t, 0, level.Reserved)
+}
+
+func TestInventoryService_ReleaseExpired(t *testing.T) {
+	repo := newMockRepo(map[product.ID]int{"gopher": 10})
+	expiring := NewService(repo, -time.Second)
+	service := NewService(repo, time.Minute)
+
+	_, err := expiring.Reserve("abandoned", []Item{{ProductID: "gopher", Quantity: 2}})
+	assert.Nil(t, err)
+	_, err = service.Reserve("order", []Item{{ProductID: "gopher", Quantity: 3}})
+	assert.Nil(t, err)
+
+	assert.Nil(t, service.ReleaseExpired())
+	level, _ := service.StockLevel("gopher")
+	assert.Equal(t, 3, level.Reserved)
+}
+
+func TestInventoryService_SetStock(t *testing.T) {
+	service := NewService(newMockRepo(map[product.ID]int{"gopher": 10}), time.Minute)
+
+	level, err := service.SetStock("gopher", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, level.OnHand)
+	_, err = service.SetStock("gopher", -1)
+	assert.Equal(t, ErrInvalidStock, err)
+	_, err = service.SetStock("unknown", 1)
+	assert.Equal(t, product.ErrProductNotFound, err)
+}
+
+func TestMergeItems(t *testing.T) {
+	merged, err := mergeItems([]Item{
+		{ProductID: "gopher", Quantity: 1},
+		{ProductID: "crab", Quantity: 2},
+		{ProductID: "gopher", Quantity: 3},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []Item{{ProductID: "crab", Quantity: 2}, {ProductID: "gopher", Quantity: 4}}, merged)
+
+	for name, items := range map[string][]Item{
+		"no items":          nil,
+		"zero quantity":     {{ProductID: "gopher"}},
+		"negative quantity": {{ProductID: "gopher", Quantity: -1}},
+		"no product":        {{Quantity: 1}},
+	} {
+		_, err = mergeItems(items)
+		assert.Equal(t, ErrInvalidReservation, err, name)
+	}
+}
+
+// mockRepo keeps the same guarantees as postgres repository: conditional status change and all-or-nothing reservation
+type mockRepo struct {
+	mu           sync.Mutex
+	stock        map[product.ID]*StockLevel
+	reservations map[ReservationID]Reservation
+}
+
+func newMockRepo(onHand map[product.ID]int) *mockRepo {
+	repo := &mockRepo{stock: make(map[product.ID]*StockLevel), reservations: make(map[ReservationID]Reservation)}
+	for id, quantity := range onHand {
+		repo.stock[id] = &StockLevel{ProductID: id, OnHand: quantity}
+	}
+	return repo
+}
+
+func (repo *mockRepo) StockLevel(id product.ID) (*StockLevel, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if level, ok := repo.stock[id]; ok {
+		found := *level
+		return &found, nil
+	}
+	return &StockLevel{ProductID: id}, nil
+}
+
+func (repo *mockRepo) SetOnHand(id product.ID, quantity int) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	level, ok := repo.stock[id]
+	if !ok {
+		return product.ErrProductNotFound
+	}
+	level.OnHand = quantity
+	return nil
+}
+
+func (repo *mockRepo) Reserve(r *Reservation) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.reservations[r.ID]; ok {
+		return ErrReservationExists
+	}
+	var outOfStock []product.ID
+	for _, item := range r.Items {
+		if level, ok := repo.stock[item.ProductID]; !ok || level.Available() < item.Quantity {
+			outOfStock = append(outOfStock, item.ProductID)
+		}
+	}
+	if len(outOfStock) > 0 {
+		return &OutOfStockError{ProductIDs: outOfStock}
+	}
+	for _, item := range r.Items {
+		repo.stock[item.ProductID].Reserved += item.Quantity
+	}
+	repo.reservations[r.ID] = *r
+	return nil
+}
+
+func (repo *mockRepo) FindReservation(id ReservationID) (*Reservation, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	r, ok := repo.reservations[id]
+	if !ok {
+		return nil, ErrReservationNotFound
+	}
+	return &r, nil
+}
+
+func (repo *mockRepo) Commit(id ReservationID, deadline time.Time) error {
+	return repo.close(id, Committed, deadline, func(level *StockLevel, quantity int) {
+		level.OnHand -= quantity
+		level.Reserved -= quantity
+	})
+}
+
+func (repo *mockRepo) Release(id ReservationID) error {
+	return repo.close(id, Released, time.Time{}, func(level *StockLevel, quantity int) {
+		level.Reserved -= quantity
+	})
+}
+
+func (repo *mockRepo) close(id ReservationID, status Status, deadline time.Time, change func(*StockLevel, int)) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	r, ok := repo.reservations[id]
+	if !ok || r.Status != Pending || (!deadline.IsZero() && !r.ExpiresAt.After(deadline)) {
+		return ErrReservationClosed
+	}
+	for _, item := range r.Items {
+		change(repo.stock[item.ProductID], item.Quantity)
+	}
+	r.Status = status
+	repo.reservations[id] = r
+	return nil
+}
+
+func (repo *mockRepo) ExpiredReservations(now time.Time) ([]ReservationID, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var ids []ReservationID
+	for id, r := range repo.reservations {
+		if r.Status == Pending && !r.ExpiresAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -21,15 +21,33 @@ type Product struct {
 	Height        *int
 	Color         *string
 	Price         float32
+	// Relevance is rank of the product in text search, it is zero for other requests
+	Relevance float32
 }
 
 type Repository interface {
 	FindByID(id ID) (*Product, error)
+	// FindBySpecification returns up to Limit products after the cursor in the requested order
 	FindBySpecification(specification Specification) ([]Product, error)
+	// CountBySpecification counts all matching products, sorting and pagination are ignored
+	CountBySpecification(specification Specification) (int, error)
 }
 
+// Specification selects products by full-text search and filters, nil bounds and zero values match any product
 type Specification struct {
+	// SearchString matches whole words of title and description in any word form,
+	// part of a word doesn't match: "gophers" finds "Gopher", but "goph" doesn't
 	SearchString string
+	Material     Material
+	Color        string
+	MinHeight    *int
+	MaxHeight    *int
+	MinPrice     *float32
+	MaxPrice     *float32
+	SortBy       SortField
+	Descending   bool
+	After        *Cursor
+	Limit        int
 }
 
 var ErrProductNotFound = errors.New("product not found")
@@ -0,0 +1,53 @@
+package product
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type SortField string
+
+const (
+	// SortByRelevance orders the best matches of SearchString first, it is the default for text search
+	SortByRelevance SortField = "relevance"
+	SortByPrice     SortField = "price"
+	SortByTitle     SortField = "title"
+)
+
+// Cursor is position of the last product of the previous page, id makes position unique among equal sort values.
+// Value is formatted sort value: title, price or relevance
+type Cursor struct {
+	SortBy     SortField `json:"s"`
+	Descending bool      `json:"d,omitempty"`
+	Value      string    `json:"v"`
+	ID         ID        `json:"id"`
+}
+
+func encodeCursor(c Cursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrInvalidSpecification = errors.New("invalid product search")
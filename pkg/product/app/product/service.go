@@ -0,0 +1,98 @@
+package product
+
+import (
+	"strconv"
+)
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+type Service struct {
+	repo Repository
+}
+
+// FindProducts returns page of products matching the specification, total count of matching products
+// and cursor of the next page, the cursor is empty on the last page
+func (s *Service) FindProducts(spec Specification, cursor string) (products []Product, total int, next string, err error) {
+	if spec.SortBy == "" {
+		spec.SortBy = SortByTitle
+		if spec.SearchString != "" {
+			spec.SortBy = SortByRelevance
+		}
+	}
+	if spec.SortBy == SortByRelevance {
+		spec.Descending = true
+	}
+	if err = validateSpecification(spec); err != nil {
+		return nil, 0, "", err
+	}
+	if spec.Limit == 0 {
+		spec.Limit = defaultSearchLimit
+	}
+	if cursor != "" {
+		if spec.After, err = decodeCursor(cursor); err != nil {
+			return nil, 0, "", err
+		}
+		if spec.After.SortBy != spec.SortBy || spec.After.Descending != spec.Descending {
+			return nil, 0, "", ErrInvalidCursor
+		}
+	}
+
+	total, err = s.repo.CountBySpecification(spec)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	limit := spec.Limit
+	spec.Limit++
+	products, err = s.repo.FindBySpecification(spec)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if len(products) > limit {
+		products = products[:limit]
+		next, err = encodeCursor(spec.sortKey(products[limit-1]))
+		if err != nil {
+			return nil, 0, "", err
+		}
+	}
+	return products, total, next, nil
+}
+
+func validateSpecification(spec Specification) error {
+	switch spec.SortBy {
+	case SortByRelevance, SortByPrice, SortByTitle:
+	default:
+		return ErrInvalidSpecification
+	}
+	switch spec.Material {
+	case 0, Paper, FullMetal, Template:
+	default:
+		return ErrInvalidSpecification
+	}
+	if spec.Limit < 0 || spec.Limit > maxSearchLimit {
+		return ErrInvalidSpecification
+	}
+	if spec.MinHeight != nil && spec.MaxHeight != nil && *spec.MinHeight > *spec.MaxHeight {
+		return ErrInvalidSpecification
+	}
+	if spec.MinPrice != nil && spec.MaxPrice != nil && *spec.MinPrice > *spec.MaxPrice {
+		return ErrInvalidSpecification
+	}
+	return nil
+}
+
+// sortKey is position of the product in results of the specification
+func (spec Specification) sortKey(p Product) Cursor {
+	c := Cursor{SortBy: spec.SortBy, Descending: spec.Descending, ID: p.ID}
+	switch spec.SortBy {
+	case SortByRelevance:
+		c.Value = strconv.FormatFloat(float64(p.Relevance), 'g', -1, 32)
+	case SortByPrice:
+		c.Value = strconv.FormatFloat(float64(p.Price), 'g', -1, 32)
+	case SortByTitle:
+		c.Value = p.Title
+	}
+	return c
+}
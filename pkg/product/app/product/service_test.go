@@ -0,0 +1,161 @@
+package product
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductService_FindProductsPages(t *testing.T) {
+	repo := &mockRepo{products: []Product{
+		{ID: "1", Title: "Gopher", Price: 30},
+		{ID: "2", Title: "Android", Price: 10},
+		{ID: "3", Title: "Gopher", Price: 20},
+		{ID: "4", Title: "Crab", Price: 40},
+		{ID: "5", Title: "Whale", Price: 50},
+	}}
+	service := NewService(repo)
+
+	var ids []ID
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		products, total, next, err := service.FindProducts(Specification{Limit: 2}, cursor)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, total)
+		for _, p := range products {
+			ids = append(ids, p.ID)
+		}
+		cursor = next
+	}
+	// equal titles are ordered by id, so pages neither skip nor repeat products
+	assert.Equal(t, []ID{"2", "4", "1", "3", "5"}, ids)
+	assert.Empty(t, cursor, "the last page has no cursor")
+
+	products, _, next, err := service.FindProducts(Specification{SortBy: SortByPrice, Descending: true, Limit: 4}, "")
+	assert.Nil(t, err)
+	assert.Len(t, products, 4)
+	assert.Equal(t, ID("5"), products[0].ID)
+	products, _, next, err = service.FindProducts(Specification{SortBy: SortByPrice, Descending: true, Limit: 4}, next)
+	assert.Nil(t, err)
+	assert.Equal(t, []Product{repo.products[1]}, products)
+	assert.Empty(t, next)
+}
+
+func TestProductService_FindProductsCursor(t *testing.T) {
+	repo := &mockRepo{products: []Product{{ID: "1", Title: "Gopher"}, {ID: "2", Title: "Crab"}}}
+	service := NewService(repo)
+
+	_, _, next, err := service.FindProducts(Specification{Limit: 1}, "")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, next)
+
+	// position in another order points to random place
+	_, _, _, err = service.FindProducts(Specification{SortBy: SortByPrice, Limit: 1}, next)
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, _, _, err = service.FindProducts(Specification{Descending: true, Limit: 1}, next)
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, _, _, err = service.FindProducts(Specification{Limit: 1}, "garbage")
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestProductService_FindProductsDefaults(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo)
+
+	_, _, _, err := service.FindProducts(Specification{}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, SortByTitle, repo.lastSpec.SortBy)
+	assert.Equal(t, defaultSearchLimit+1, repo.lastSpec.Limit, "one more product shows whether the next page exists")
+
+	_, _, _, err = service.FindProducts(Specification{SearchString: "gopher"}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, SortByRelevance, repo.lastSpec.SortBy)
+	assert.True(t, repo.lastSpec.Descending, "the best matches go first")
+}
+
+func TestValidateSpecification(t *testing.T) {
+	low, high := 10, 20
+	cheap, expensive := float32(1), float32(2)
+	for name, test := range map[string]struct {
+		spec  Specification
+		valid bool
+	}{
+		"sort by title":         {spec: Specification{SortBy: SortByTitle}, valid: true},
+		"unknown sort":          {spec: Specification{SortBy: "color"}},
+		"no sort":               {spec: Specification{}},
+		"known material":        {spec: Specification{SortBy: SortByPrice, Material: Template}, valid: true},
+		"unknown material":      {spec: Specification{SortBy: SortByPrice, Material: 4}},
+		"max limit":             {spec: Specification{SortBy: SortByPrice, Limit: maxSearchLimit}, valid: true},
+		"too large limit":       {spec: Specification{SortBy: SortByPrice, Limit: maxSearchLimit + 1}},
+		"negative limit":        {spec: Specification{SortBy: SortByPrice, Limit: -1}},
+		"height range":          {spec: Specification{SortBy: SortByPrice, MinHeight: &low, MaxHeight: &high}, valid: true},
+		"equal height bounds":   {spec: Specification{SortBy: SortByPrice, MinHeight: &low, MaxHeight: &low}, valid: true},
+		"inverted height range": {spec: Specification{SortBy: SortByPrice, MinHeight: &high, MaxHeight: &low}},
+		"open price range":      {spec: Specification{SortBy: SortByPrice, MaxPrice: &cheap}, valid: true},
+		"inverted price range":  {spec: Specification{SortBy: SortByPrice, MinPrice: &expensive, MaxPrice: &cheap}},
+	} {
+		err := validateSpecification(test.spec)
+		if test.valid {
+			assert.Nil(t, err, name)
+		} else {
+			assert.Equal(t, ErrInvalidSpecification, err, name)
+		}
+	}
+}
+
+// mockRepo ignores filters, it orders products like postgres repository: by sort value, then by id
+type mockRepo struct {
+	products []Product
+	lastSpec Specification
+}
+
+func (repo *mockRepo) FindByID(id ID) (*Product, error) {
+	for _, p := range repo.products {
+		if p.ID == id {
+			return &p, nil
+		}
+	}
+	return nil, ErrProductNotFound
+}
+
+func (repo *mockRepo) FindBySpecification(spec Specification) ([]Product, error) {
+	repo.lastSpec = spec
+	products := append([]Product(nil), repo.products...)
+	sort.Slice(products, func(i, j int) bool {
+		return repo.less(spec, products[i], products[j])
+	})
+
+	var result []Product
+	for _, p := range products {
+		if spec.After != nil && !repo.less(spec, repo.find(spec.After.ID), p) {
+			continue
+		}
+		if len(result) < spec.Limit {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (repo *mockRepo) CountBySpecification(Specification) (int, error) {
+	return len(repo.products), nil
+}
+
+func (repo *mockRepo) find(id ID) Product {
+	p, _ := repo.FindByID(id)
+	return *p
+}
+
+func (repo *mockRepo) less(spec Specification, a, b Product) bool {
+	if spec.Descending {
+		a, b = b, a
+	}
+	switch {
+	case spec.SortBy == SortByPrice && a.Price != b.Price:
+		return a.Price < b.Price
+	case spec.SortBy == SortByTitle && a.Title != b.Title:
+		return a.Title < b.Title
+	}
+	return a.ID < b.ID
+}
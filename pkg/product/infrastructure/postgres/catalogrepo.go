@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/catalog"
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+func NewCatalogRepository(db *sql.DB) catalog.Repository {
+	return &catalogRepository{db: db}
+}
+
+type catalogRepository struct {
+	db *sql.DB
+}
+
+func (repo *catalogRepository) Find(id product.MetaProductID) (*catalog.MetaProduct, error) {
+	sqlStatement := `SELECT id, title, description, material
+						FROM meta_products
+						WHERE id=$1;`
+	var m catalog.MetaProduct
+	row := repo.db.QueryRow(sqlStatement, string(id))
+	switch err := row.Scan(&m.ID, &m.Title, &m.Description, &m.Material); err {
+	case sql.ErrNoRows:
+		return nil, catalog.ErrMetaProductNotFound
+	case nil:
+	default:
+		return nil, errors.WithStack(err)
+	}
+
+	if err := findVariants(repo.db, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// queryer is either db or transaction
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func findVariants(db queryer, m *catalog.MetaProduct) error {
+	rows, err := db.Query(`SELECT id, height, color, price
+						FROM products
+						WHERE meta_product_id=$1
+						ORDER BY price, id;`, string(m.ID))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+	m.Variants = nil
+	for rows.Next() {
+		var v catalog.Variant
+		if err = rows.Scan(&v.ID, &v.Height, &v.Color, &v.Price); err != nil {
+			return errors.WithStack(err)
+		}
+		m.Variants = append(m.Variants, v)
+	}
+	return errors.WithStack(rows.Err())
+}
+
+func (repo *catalogRepository) Create(m *catalog.MetaProduct) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = tx.Exec(`INSERT INTO meta_products (id, title, description, material) VALUES ($1, $2, $3, $4);`,
+		string(m.ID), m.Title, m.Description, m.Material)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.WithStack(err)
+	}
+	for i := range m.Variants {
+		if err = insertVariant(tx, m.ID, &m.Variants[i]); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// Update keeps the meta product row locked until its variants are read, so concurrent AddVariant waits for it
+func (repo *catalogRepository) Update(m *catalog.MetaProduct) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result, err := tx.Exec(`UPDATE meta_products SET title = $2, description = $3, material = $4 WHERE id = $1;`,
+		string(m.ID), m.Title, m.Description, m.Material)
+	if err = checkAffected(result, err, catalog.ErrMetaProductNotFound); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = findVariants(tx, m); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (repo *catalogRepository) Remove(id product.MetaProductID) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err = tx.Exec("DELETE FROM stock WHERE product_id IN (SELECT id FROM products WHERE meta_product_id = $1);", string(id)); err != nil {
+		_ = tx.Rollback()
+		return errors.WithStack(err)
+	}
+	if _, err = tx.Exec("DELETE FROM products WHERE meta_product_id = $1;", string(id)); err != nil {
+		_ = tx.Rollback()
+		return errors.WithStack(err)
+	}
+	result, err := tx.Exec("DELETE FROM meta_products WHERE id = $1;", string(id))
+	if err = checkAffected(result, err, catalog.ErrMetaProductNotFound); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// AddVariant locks the meta product row, so concurrent removal of meta product can't leave orphan variant
+func (repo *catalogRepository) AddVariant(metaProductID product.MetaProductID, v *catalog.Variant) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var id string
+	switch err = tx.QueryRow("SELECT id FROM meta_products WHERE id = $1 FOR SHARE;", string(metaProductID)).Scan(&id); err {
+	case nil:
+	case sql.ErrNoRows:
+		_ = tx.Rollback()
+		return catalog.ErrMetaProductNotFound
+	default:
+		_ = tx.Rollback()
+		return errors.WithStack(err)
+	}
+	if err = insertVariant(tx, metaProductID, v); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (repo *catalogRepository) UpdateVariant(metaProductID product.MetaProductID, v *catalog.Variant) error {
+	result, err := repo.db.Exec(`UPDATE products SET height = $3, color = $4, price = $5 WHERE id = $1 AND meta_product_id = $2;`,
+		string(v.ID), string(metaProductID), v.Height, v.Color, v.Price)
+	return checkAffected(result, err, catalog.ErrVariantNotFound)
+}
+
+func (repo *catalogRepository) RemoveVariant(metaProductID product.MetaProductID, id product.ID) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result, err := tx.Exec("DELETE FROM products WHERE id = $1 AND meta_product_id = $2;", string(id), string(metaProductID))
+	if err = checkAffected(result, err, catalog.ErrVariantNotFound); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM stock WHERE product_id = $1;", string(id)); err != nil {
+		_ = tx.Rollback()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (repo *catalogRepository) NextMetaProductID() (product.MetaProductID, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	return product.MetaProductID(id.String()), nil
+}
+
+func (repo *catalogRepository) NextVariantID() (product.ID, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	return product.ID(id.String()), nil
+}
+
+// insertVariant creates empty stock of the variant, so stock level of every product is stored
+func insertVariant(tx *sql.Tx, metaProductID product.MetaProductID, v *catalog.Variant) error {
+	_, err := tx.Exec(`INSERT INTO products (id, meta_product_id, height, color, price) VALUES ($1, $2, $3, $4, $5);`,
+		string(v.ID), string(metaProductID), v.Height, v.Color, v.Price)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = tx.Exec(`INSERT INTO stock (product_id, on_hand, reserved) VALUES ($1, 0, 0);`, string(v.ID))
+	return errors.WithStack(err)
+}
+
+// checkAffected reports notFound when the statement changed nothing
+func checkAffected(result sql.Result, err error, notFound error) error {
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/inventory"
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+func NewInventoryRepository(db *sql.DB) inventory.Repository {
+	return &inventoryRepository{db: db}
+}
+
+type inventoryRepository struct {
+	db *sql.DB
+}
+
+func (repo *inventoryRepository) StockLevel(id product.ID) (*inventory.StockLevel, error) {
+	level := inventory.StockLevel{ProductID: id}
+	err := repo.db.QueryRow("SELECT on_hand, reserved FROM stock WHERE product_id = $1;", string(id)).
+		Scan(&level.OnHand, &level.Reserved)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithStack(err)
+	}
+	return &level, nil
+}
+
+func (repo *inventoryRepository) SetOnHand(id product.ID, quantity int) error {
+	sqlStatement := `
+		INSERT INTO stock (product_id, on_hand, reserved)
+		SELECT id, $2, 0 FROM products WHERE id = $1
+		ON CONFLICT (product_id) DO UPDATE SET on_hand = EXCLUDED.on_hand;
+`
+	result, err := repo.db.Exec(sqlStatement, string(id), quantity)
+	return checkAffected(result, err, product.ErrProductNotFound)
+}
+
+// Reserve checks every item, so OutOfStockError lists all missing products, not only the first one
+func (repo *inventoryRepository) Reserve(r *inventory.Reservation) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result, err := tx.Exec(`INSERT INTO stock_reservations (id, status, expires_at) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING;`,
+		string(r.ID), r.Status, r.ExpiresAt)
+	if err = checkAffected(result, err, inventory.ErrReservationExists); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	var outOfStock []product.ID
+	for _, item := range r.Items {
+		result, err = tx.Exec(`UPDATE stock SET reserved = reserved + $2 WHERE product_id = $1 AND on_hand - reserved >= $2;`,
+			string(item.ProductID), item.Quantity)
+		switch err = checkAffected(result, err, errOutOfStock); err {
+		case nil:
+		case errOutOfStock:
+			outOfStock = append(outOfStock, item.ProductID)
+			continue
+		default:
+			_ = tx.Rollback()
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO stock_reservation_items (reservation_id, product_id, quantity) VALUES ($1, $2, $3);`,
+			string(r.ID), string(item.ProductID), item.Quantity)
+		if err != nil {
+			_ = tx.Rollback()
+			return errors.WithStack(err)
+		}
+	}
+	if len(outOfStock) > 0 {
+		_ = tx.Rollback()
+		return &inventory.OutOfStockError{ProductIDs: outOfStock}
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+var errOutOfStock = errors.New("out of stock")
+
+func (repo *inventoryRepository) FindReservation(id inventory.ReservationID) (*inventory.Reservation, error) {
+	r := inventory.Reservation{ID: id}
+	err := repo.db.QueryRow("SELECT status, expires_at FROM stock_reservations WHERE id = $1;", string(id)).
+		Scan(&r.Status, &r.ExpiresAt)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		return nil, inventory.ErrReservationNotFound
+	default:
+		return nil, errors.WithStack(err)
+	}
+
+	rows, err := repo.db.Query(`SELECT product_id, quantity FROM stock_reservation_items WHERE reservation_id = $1 ORDER BY product_id;`, string(id))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item inventory.Item
+		if err = rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		r.Items = append(r.Items, item)
+	}
+	return &r, errors.WithStack(rows.Err())
+}
+
+func (repo *inventoryRepository) Commit(id inventory.ReservationID, deadline time.Time) error {
+	return repo.close(id, inventory.Committed, deadline, `
+		UPDATE stock SET on_hand = stock.on_hand - i.quantity, reserved = stock.reserved - i.quantity
+		FROM stock_reservation_items AS i
+		WHERE i.reservation_id = $1 AND stock.product_id = i.product_id;
+`)
+}
+
+func (repo *inventoryRepository) Release(id inventory.ReservationID) error {
+	return repo.close(id, inventory.Released, time.Time{}, `
+		UPDATE stock SET reserved = stock.reserved - i.quantity
+		FROM stock_reservation_items AS i
+		WHERE i.reservation_id = $1 AND stock.product_id = i.product_id;
+`)
+}
+
+// close moves pending reservation to the status and applies stockStatement to its items,
+// zero deadline closes reservation regardless of expiration
+func (repo *inventoryRepository) close(id inventory.ReservationID, status inventory.Status, deadline time.Time, stockStatement string) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result, err := tx.Exec(`UPDATE stock_reservations SET status = $2 WHERE id = $1 AND status = $3 AND ($4::timestamptz IS NULL OR expires_at > $4);`,
+		string(id), status, inventory.Pending, nullTime(deadline))
+	if err = checkAffected(result, err, inventory.ErrReservationClosed); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec(stockStatement, string(id)); err != nil {
+		_ = tx.Rollback()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+func (repo *inventoryRepository) ExpiredReservations(now time.Time) ([]inventory.ReservationID, error) {
+	rows, err := repo.db.Query(`SELECT id FROM stock_reservations WHERE status = $1 AND expires_at <= $2;`, inventory.Pending, now)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	var ids []inventory.ReservationID
+	for rows.Next() {
+		var id inventory.ReservationID
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, errors.WithStack(rows.Err())
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
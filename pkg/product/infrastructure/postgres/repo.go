@@ -2,6 +2,8 @@ package postgres
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -33,24 +35,106 @@ func (repo *repository) FindByID(id product.ID) (*product.Product, error) {
 	}
 }
 
+// searchVector must match the expression of meta_products_search_idx, otherwise the index is not used
+const searchVector = `setweight(to_tsvector('english', coalesce(mp.title, '')), 'A') || setweight(to_tsvector('english', coalesce(mp.description, '')), 'B')`
+
 func (repo *repository) FindBySpecification(specification product.Specification) ([]product.Product, error) {
-	sqlStatement := `SELECT p.id, meta_product_id, height, color, price, title, description, material 
+	var q specificationQuery
+	condition := q.condition(specification)
+	relevance := "0::real"
+	if specification.SearchString != "" {
+		relevance = fmt.Sprintf("ts_rank(%s, websearch_to_tsquery('english', %s))", searchVector, q.arg(specification.SearchString))
+	}
+
+	// price is compared with precision of the model, float32 cursor never equals the stored float exactly
+	sortColumn := map[product.SortField]string{
+		product.SortByRelevance: relevance,
+		product.SortByPrice:     "p.price::real",
+		product.SortByTitle:     "mp.title",
+	}[specification.SortBy]
+	if sortColumn == "" {
+		return nil, product.ErrInvalidSpecification
+	}
+	direction, compare := "ASC", ">"
+	if specification.Descending {
+		direction, compare = "DESC", "<"
+	}
+	if after := specification.After; after != nil {
+		value := q.arg(after.Value)
+		switch specification.SortBy {
+		case product.SortByRelevance, product.SortByPrice:
+			value += "::real"
+		}
+		condition += fmt.Sprintf(" AND (%s, p.id) %s (%s, %s)", sortColumn, compare, value, q.arg(string(after.ID)))
+	}
+
+	sqlStatement := fmt.Sprintf(`SELECT p.id, meta_product_id, height, color, price, title, description, material, %s
 						FROM products AS p
 						INNER JOIN meta_products AS mp ON mp.id = p.meta_product_id
-						WHERE title LIKE $1
-						ORDER BY RANDOM() DESC`
+						WHERE %s
+						ORDER BY %s %s, p.id %s
+						LIMIT %s`, relevance, condition, sortColumn, direction, direction, q.arg(specification.Limit))
 	var products []product.Product
-	rows, err := repo.db.Query(sqlStatement, "%"+specification.SearchString+"%")
+	rows, err := repo.db.Query(sqlStatement, q.args...)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var p product.Product
-		err = rows.Scan(&p.ID, &p.MetaProductID, &p.Height, &p.Color, &p.Price, &p.Title, &p.Description, &p.Material)
+		err = rows.Scan(&p.ID, &p.MetaProductID, &p.Height, &p.Color, &p.Price, &p.Title, &p.Description, &p.Material, &p.Relevance)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 		products = append(products, p)
 	}
-	return products, errors.WithStack(err)
+	return products, errors.WithStack(rows.Err())
+}
+
+func (repo *repository) CountBySpecification(specification product.Specification) (int, error) {
+	var q specificationQuery
+	sqlStatement := `SELECT count(*)
+						FROM products AS p
+						INNER JOIN meta_products AS mp ON mp.id = p.meta_product_id
+						WHERE ` + q.condition(specification)
+	var count int
+	err := repo.db.QueryRow(sqlStatement, q.args...).Scan(&count)
+	return count, errors.WithStack(err)
+}
+
+// specificationQuery collects arguments of the statement and returns their placeholders
+type specificationQuery struct {
+	args []interface{}
+}
+
+func (q *specificationQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// condition filters products by the specification, cursor is not applied
+func (q *specificationQuery) condition(specification product.Specification) string {
+	conditions := []string{"TRUE"}
+	if specification.SearchString != "" {
+		conditions = append(conditions, fmt.Sprintf("%s @@ websearch_to_tsquery('english', %s)", searchVector, q.arg(specification.SearchString)))
+	}
+	if specification.Material != 0 {
+		conditions = append(conditions, "mp.material = "+q.arg(specification.Material))
+	}
+	if specification.Color != "" {
+		conditions = append(conditions, "lower(p.color) = lower("+q.arg(specification.Color)+")")
+	}
+	if specification.MinHeight != nil {
+		conditions = append(conditions, "p.height >= "+q.arg(*specification.MinHeight))
+	}
+	if specification.MaxHeight != nil {
+		conditions = append(conditions, "p.height <= "+q.arg(*specification.MaxHeight))
+	}
+	if specification.MinPrice != nil {
+		conditions = append(conditions, "p.price >= "+q.arg(*specification.MinPrice))
+	}
+	if specification.MaxPrice != nil {
+		conditions = append(conditions, "p.price <= "+q.arg(*specification.MaxPrice))
+	}
+	return strings.Join(conditions, " AND ")
 }
@@ -2,9 +2,13 @@ package transport
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/catalog"
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/inventory"
 	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
 )
 
@@ -42,13 +46,21 @@ func makeReadProductEndpoint(repo product.Repository) endpoint.Endpoint {
 }
 
 type readProductsRequest struct {
-	Search string
+	Specification product.Specification
+	Cursor        string
+	Cacheable     bool
 }
 
 type readProductsResponse struct {
-	Products []responseProduct `json:"products,omitempty"`
+	Products   []responseProduct `json:"products,omitempty"`
+	Total      int               `json:"total"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+
+	isCacheable bool
 }
 
+func (r readProductsResponse) cacheable() bool { return r.isCacheable }
+
 type responseProduct struct {
 	ProductID     string  `json:"productID,omitempty"`
 	MetaProductID string  `json:"metaProductID,omitempty"`
@@ -60,10 +72,10 @@ type responseProduct struct {
 	Price         float32 `json:"price,omitempty"`
 }
 
-func makeReadProductsEndpoint(repo product.Repository) endpoint.Endpoint {
+func makeReadProductsEndpoint(s *product.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(readProductsRequest)
-		if products, err := repo.FindBySpecification(product.Specification{SearchString: req.Search}); err != nil {
+		if products, total, next, err := s.FindProducts(req.Specification, req.Cursor); err != nil {
 			return readProductsResponse{}, err
 		} else {
 			var responseProducts []responseProduct
@@ -81,9 +93,336 @@ func makeReadProductsEndpoint(repo product.Repository) endpoint.Endpoint {
 				responseProducts = append(responseProducts, responseProduct)
 			}
 
-			return readProductsResponse{Products: responseProducts}, nil
+			return readProductsResponse{Products: responseProducts, Total: total, NextCursor: next, isCacheable: req.Cacheable}, nil
+		}
+	}
+}
+
+type variantInfo struct {
+	ID     string  `json:"id"`
+	Height *int    `json:"height,omitempty"`
+	Color  *string `json:"color,omitempty"`
+	Price  float32 `json:"price"`
+}
+
+type metaProductInfo struct {
+	ID          string        `json:"id"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Material    string        `json:"material"`
+	Variants    []variantInfo `json:"variants"`
+}
+
+func makeVariantInfo(v catalog.Variant) variantInfo {
+	return variantInfo{
+		ID:     string(v.ID),
+		Height: v.Height,
+		Color:  v.Color,
+		Price:  v.Price,
+	}
+}
+
+func makeMetaProductInfo(m catalog.MetaProduct) metaProductInfo {
+	info := metaProductInfo{
+		ID:          string(m.ID),
+		Title:       m.Title,
+		Description: m.Description,
+		Material:    materialString(m.Material),
+		Variants:    make([]variantInfo, 0, len(m.Variants)),
+	}
+	for _, v := range m.Variants {
+		info.Variants = append(info.Variants, makeVariantInfo(v))
+	}
+	return info
+}
+
+type readMetaProductRequest struct {
+	ID string
+}
+
+type priceRangeInfo struct {
+	Min float32 `json:"min"`
+	Max float32 `json:"max"`
+}
+
+type readMetaProductResponse struct {
+	ID          string          `json:"id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Material    string          `json:"material"`
+	PriceRange  *priceRangeInfo `json:"priceRange,omitempty"`
+	// Heights and Colors are options of the variant picker
+	Heights  []int         `json:"heights"`
+	Colors   []string      `json:"colors"`
+	Variants []variantInfo `json:"variants"`
+}
+
+func (r readMetaProductResponse) cacheable() bool { return true }
+
+// makeReadPublicMetaProductEndpoint groups variants for product page, it is available to guests
+func makeReadPublicMetaProductEndpoint(s *catalog.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(readMetaProductRequest)
+		m, err := s.MetaProduct(product.MetaProductID(req.ID))
+		if err != nil {
+			return readMetaProductResponse{}, err
+		}
+
+		info := makeMetaProductInfo(*m)
+		resp := readMetaProductResponse{
+			ID:          info.ID,
+			Title:       info.Title,
+			Description: info.Description,
+			Material:    info.Material,
+			Heights:     []int{},
+			Colors:      []string{},
+			Variants:    info.Variants,
+		}
+		if min, max, ok := m.PriceRange(); ok {
+			resp.PriceRange = &priceRangeInfo{Min: min, Max: max}
+		}
+		heights := make(map[int]bool)
+		colors := make(map[string]bool)
+		for _, v := range m.Variants {
+			if v.Height != nil && !heights[*v.Height] {
+				heights[*v.Height] = true
+				resp.Heights = append(resp.Heights, *v.Height)
+			}
+			if v.Color != nil && !colors[*v.Color] {
+				colors[*v.Color] = true
+				resp.Colors = append(resp.Colors, *v.Color)
+			}
+		}
+		sort.Ints(resp.Heights)
+		sort.Strings(resp.Colors)
+		return resp, nil
+	}
+}
+
+func makeReadMetaProductEndpoint(s *catalog.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(readMetaProductRequest)
+		m, err := s.MetaProduct(product.MetaProductID(req.ID))
+		if err != nil {
+			return metaProductInfo{}, err
+		}
+		return makeMetaProductInfo(*m), nil
+	}
+}
+
+type createMetaProductRequest struct {
+	Title       string
+	Description string
+	Material    product.Material
+	Variants    []catalog.Variant
+}
+
+func makeCreateMetaProductEndpoint(s *catalog.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createMetaProductRequest)
+		m, err := s.CreateMetaProduct(req.Title, req.Description, req.Material, req.Variants)
+		if err != nil {
+			return metaProductInfo{}, err
+		}
+		return makeMetaProductInfo(*m), nil
+	}
+}
+
+type updateMetaProductRequest struct {
+	ID          string
+	Title       string
+	Description string
+	Material    product.Material
+}
+
+func makeUpdateMetaProductEndpoint(s *catalog.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updateMetaProductRequest)
+		m, err := s.UpdateMetaProduct(product.MetaProductID(req.ID), req.Title, req.Description, req.Material)
+		if err != nil {
+			return metaProductInfo{}, err
 		}
+		return makeMetaProductInfo(*m), nil
+	}
+}
+
+type removeMetaProductRequest struct {
+	ID string
+}
+
+type removeMetaProductResponse struct{}
+
+func makeRemoveMetaProductEndpoint(s *catalog.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(removeMetaProductRequest)
+		err := s.RemoveMetaProduct(product.MetaProductID(req.ID))
+		return removeMetaProductResponse{}, err
+	}
+}
+
+type addVariantRequest struct {
+	MetaProductID string
+	Variant       catalog.Variant
+}
+
+func makeAddVariantEndpoint(s *catalog.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(addVariantRequest)
+		v, err := s.AddVariant(product.MetaProductID(req.MetaProductID), req.Variant)
+		if err != nil {
+			return variantInfo{}, err
+		}
+		return makeVariantInfo(*v), nil
+	}
+}
+
+type updateVariantRequest struct {
+	MetaProductID string
+	VariantID     string
+	Variant       catalog.Variant
+}
+
+func makeUpdateVariantEndpoint(s *catalog.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updateVariantRequest)
+		v, err := s.UpdateVariant(product.MetaProductID(req.MetaProductID), product.ID(req.VariantID), req.Variant)
+		if err != nil {
+			return variantInfo{}, err
+		}
+		return makeVariantInfo(*v), nil
+	}
+}
+
+type removeVariantRequest struct {
+	MetaProductID string
+	VariantID     string
+}
+
+type removeVariantResponse struct{}
+
+func makeRemoveVariantEndpoint(s *catalog.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(removeVariantRequest)
+		err := s.RemoveVariant(product.MetaProductID(req.MetaProductID), product.ID(req.VariantID))
+		return removeVariantResponse{}, err
+	}
+}
+
+type stockLevelInfo struct {
+	ProductID string `json:"productId"`
+	OnHand    int    `json:"onHand"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+}
+
+func makeStockLevelInfo(l inventory.StockLevel) stockLevelInfo {
+	return stockLevelInfo{
+		ProductID: string(l.ProductID),
+		OnHand:    l.OnHand,
+		Reserved:  l.Reserved,
+		Available: l.Available(),
+	}
+}
+
+type readStockRequest struct {
+	ProductID string
+}
+
+func makeReadStockEndpoint(s *inventory.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(readStockRequest)
+		level, err := s.StockLevel(product.ID(req.ProductID))
+		if err != nil {
+			return stockLevelInfo{}, err
+		}
+		return makeStockLevelInfo(*level), nil
+	}
+}
+
+type setStockRequest struct {
+	ProductID string
+	OnHand    int
+}
+
+func makeSetStockEndpoint(s *inventory.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setStockRequest)
+		level, err := s.SetStock(product.ID(req.ProductID), req.OnHand)
+		if err != nil {
+			return stockLevelInfo{}, err
+		}
+		return makeStockLevelInfo(*level), nil
+	}
+}
+
+type reservationItemInfo struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+type reservationInfo struct {
+	ID        string                `json:"id"`
+	Items     []reservationItemInfo `json:"items"`
+	ExpiresAt time.Time             `json:"expiresAt"`
+}
+
+type reserveRequest struct {
+	ID    string
+	Items []inventory.Item
+}
+
+func makeReserveEndpoint(s *inventory.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(reserveRequest)
+		r, err := s.Reserve(inventory.ReservationID(req.ID), req.Items)
+		if err != nil {
+			return reservationInfo{}, err
+		}
+		info := reservationInfo{
+			ID:        string(r.ID),
+			Items:     make([]reservationItemInfo, 0, len(r.Items)),
+			ExpiresAt: r.ExpiresAt,
+		}
+		for _, item := range r.Items {
+			info.Items = append(info.Items, reservationItemInfo{ProductID: string(item.ProductID), Quantity: item.Quantity})
+		}
+		return info, nil
+	}
+}
+
+type closeReservationRequest struct {
+	ID string
+}
+
+type closeReservationResponse struct{}
+
+func makeCommitReservationEndpoint(s *inventory.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(closeReservationRequest)
+		err := s.Commit(inventory.ReservationID(req.ID))
+		return closeReservationResponse{}, err
+	}
+}
+
+func makeReleaseReservationEndpoint(s *inventory.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(closeReservationRequest)
+		err := s.Release(inventory.ReservationID(req.ID))
+		return closeReservationResponse{}, err
+	}
+}
+
+// parseMaterial returns zero material for unknown names, validation of catalog reports it
+func parseMaterial(material string) product.Material {
+	switch material {
+	case "paper":
+		return product.Paper
+	case "fullmetal":
+		return product.FullMetal
+	case "template":
+		return product.Template
 	}
+	return 0
 }
 
 func materialString(materialType product.Material) string {
@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/catalog"
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+func TestReadPublicMetaProductEndpoint(t *testing.T) {
+	red, blue := "red", "blue"
+	low, high := 10, 20
+	repo := catalogRepo{metaProducts: map[product.MetaProductID]*catalog.MetaProduct{
+		"1": {ID: "1", Title: "Gopher", Material: product.Paper, Variants: []catalog.Variant{
+			{ID: "v1", Height: &high, Color: &red, Price: 30},
+			{ID: "v2", Height: &low, Color: &red, Price: 10},
+			{ID: "v3", Height: &high, Color: &blue, Price: 20},
+			{ID: "v4", Price: 25},
+		}},
+		"2": {ID: "2", Title: "Crab", Material: product.Paper},
+	}}
+	readMetaProduct := makeReadPublicMetaProductEndpoint(catalog.NewService(repo))
+
+	resp, err := readMetaProduct(context.Background(), readMetaProductRequest{ID: "1"})
+	assert.Nil(t, err)
+	m := resp.(readMetaProductResponse)
+	assert.Equal(t, []int{10, 20}, m.Heights, "heights are deduplicated and sorted")
+	assert.Equal(t, []string{"blue", "red"}, m.Colors, "colors are deduplicated and sorted")
+	assert.Equal(t, &priceRangeInfo{Min: 10, Max: 30}, m.PriceRange)
+	assert.Len(t, m.Variants, 4)
+
+	resp, err = readMetaProduct(context.Background(), readMetaProductRequest{ID: "2"})
+	assert.Nil(t, err)
+	m = resp.(readMetaProductResponse)
+	assert.Nil(t, m.PriceRange)
+	assert.Equal(t, []int{}, m.Heights, "empty options are encoded as empty lists")
+	assert.Equal(t, []string{}, m.Colors)
+
+	_, err = readMetaProduct(context.Background(), readMetaProductRequest{ID: "unknown"})
+	assert.Equal(t, catalog.ErrMetaProductNotFound, err)
+	w := httptest.NewRecorder()
+	encodeError(context.Background(), err, w)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// catalogRepo serves reads only, the endpoints under test don't change the catalog
+type catalogRepo struct {
+	catalog.Repository
+	metaProducts map[product.MetaProductID]*catalog.MetaProduct
+}
+
+func (repo catalogRepo) Find(id product.MetaProductID) (*catalog.MetaProduct, error) {
+	m, ok := repo.metaProducts[id]
+	if !ok {
+		return nil, catalog.ErrMetaProductNotFound
+	}
+	return m, nil
+}
@@ -2,8 +2,14 @@ package transport
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	httplog "github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
@@ -11,14 +17,24 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/catalog"
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/inventory"
 	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
 )
 
-func MakeHandler(repo product.Repository, logger httplog.Logger) http.Handler {
+func MakeHandler(
+	repo product.Repository,
+	products *product.Service,
+	catalogService *catalog.Service,
+	inventoryService *inventory.Service,
+	logger httplog.Logger,
+) http.Handler {
 	r := mux.NewRouter()
 	opts := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(authz.ServerBefore),
 	}
 
 	readProductHandler := httptransport.NewServer(
@@ -29,8 +45,101 @@ func MakeHandler(repo product.Repository, logger httplog.Logger) http.Handler {
 	)
 
 	readProductsHandler := httptransport.NewServer(
-		makeReadProductsEndpoint(repo),
+		makeReadProductsEndpoint(products),
 		decodeReadProductsRequest,
+		encodeCacheableResponse,
+		append(opts, httptransport.ServerBefore(ifNoneMatchToContext))...,
+	)
+
+	readPublicMetaProductHandler := httptransport.NewServer(
+		makeReadPublicMetaProductEndpoint(catalogService),
+		decodeReadMetaProductRequest,
+		encodeCacheableResponse,
+		append(opts, httptransport.ServerBefore(ifNoneMatchToContext))...,
+	)
+
+	manageCatalog := authz.Require(authz.ManageCatalog)
+
+	readMetaProductHandler := httptransport.NewServer(
+		manageCatalog(makeReadMetaProductEndpoint(catalogService)),
+		decodeReadMetaProductRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	createMetaProductHandler := httptransport.NewServer(
+		manageCatalog(makeCreateMetaProductEndpoint(catalogService)),
+		decodeCreateMetaProductRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	updateMetaProductHandler := httptransport.NewServer(
+		manageCatalog(makeUpdateMetaProductEndpoint(catalogService)),
+		decodeUpdateMetaProductRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	removeMetaProductHandler := httptransport.NewServer(
+		manageCatalog(makeRemoveMetaProductEndpoint(catalogService)),
+		decodeRemoveMetaProductRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	addVariantHandler := httptransport.NewServer(
+		manageCatalog(makeAddVariantEndpoint(catalogService)),
+		decodeAddVariantRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	updateVariantHandler := httptransport.NewServer(
+		manageCatalog(makeUpdateVariantEndpoint(catalogService)),
+		decodeUpdateVariantRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	removeVariantHandler := httptransport.NewServer(
+		manageCatalog(makeRemoveVariantEndpoint(catalogService)),
+		decodeRemoveVariantRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	readStockHandler := httptransport.NewServer(
+		manageCatalog(makeReadStockEndpoint(inventoryService)),
+		decodeReadStockRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	setStockHandler := httptransport.NewServer(
+		manageCatalog(makeSetStockEndpoint(inventoryService)),
+		decodeSetStockRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	reserveHandler := httptransport.NewServer(
+		makeReserveEndpoint(inventoryService),
+		decodeReserveRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	commitReservationHandler := httptransport.NewServer(
+		makeCommitReservationEndpoint(inventoryService),
+		decodeCloseReservationRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	releaseReservationHandler := httptransport.NewServer(
+		makeReleaseReservationEndpoint(inventoryService),
+		decodeCloseReservationRequest,
 		encodeResponse,
 		opts...,
 	)
@@ -38,6 +147,20 @@ func MakeHandler(repo product.Repository, logger httplog.Logger) http.Handler {
 	r.Handle("/api/v1/products/{id}", readProductHandler).Methods(http.MethodGet)
 	r.Handle("/api/v1/internal/products/{id}", readProductHandler).Methods(http.MethodGet)
 	r.Handle("/api/v1/products", readProductsHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/meta-products/{id}", readPublicMetaProductHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/admin/meta-products", createMetaProductHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/admin/meta-products/{id}", readMetaProductHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/admin/meta-products/{id}", updateMetaProductHandler).Methods(http.MethodPut)
+	r.Handle("/api/v1/admin/meta-products/{id}", removeMetaProductHandler).Methods(http.MethodDelete)
+	r.Handle("/api/v1/admin/meta-products/{id}/variants", addVariantHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/admin/meta-products/{id}/variants/{variantId}", updateVariantHandler).Methods(http.MethodPut)
+	r.Handle("/api/v1/admin/meta-products/{id}/variants/{variantId}", removeVariantHandler).Methods(http.MethodDelete)
+	r.Handle("/api/v1/admin/products/{id}/stock", readStockHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/admin/products/{id}/stock", setStockHandler).Methods(http.MethodPut)
+	// reservations are managed by order service, they are not published by the ingress
+	r.Handle("/api/v1/internal/reservations", reserveHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/internal/reservations/{id}/commit", commitReservationHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/internal/reservations/{id}/release", releaseReservationHandler).Methods(http.MethodPost)
 
 	return r
 }
@@ -53,17 +176,340 @@ func decodeReadProductRequest(_ context.Context, r *http.Request) (interface{},
 	return req, nil
 }
 
+// productsQuery is the search of products in query string or in json body of older clients
+type productsQuery struct {
+	Search    string   `json:"search,omitempty"`
+	Material  string   `json:"material,omitempty"`
+	Color     string   `json:"color,omitempty"`
+	MinHeight *int     `json:"minHeight,omitempty"`
+	MaxHeight *int     `json:"maxHeight,omitempty"`
+	MinPrice  *float32 `json:"minPrice,omitempty"`
+	MaxPrice  *float32 `json:"maxPrice,omitempty"`
+	Sort      string   `json:"sort,omitempty"`
+	Order     string   `json:"order,omitempty"`
+	Cursor    string   `json:"cursor,omitempty"`
+	Limit     int      `json:"limit,omitempty"`
+}
+
+// decodeReadProductsRequest prefers query string, the body of older clients is read only when the query string is empty.
+// Response is cacheable only when the body is not used, caches don't take the body into account
 func decodeReadProductsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var query productsQuery
+	fromBody := false
+	if values := r.URL.Query(); len(values) > 0 {
+		if err := parseProductsQuery(values, &query); err != nil {
+			return nil, err
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&query); err == nil {
+		fromBody = true
+	} else if err != io.EOF {
+		return nil, newErrInvalidRequest(err, "invalid read product request")
+	}
+
+	spec := product.Specification{
+		SearchString: query.Search,
+		Color:        query.Color,
+		MinHeight:    query.MinHeight,
+		MaxHeight:    query.MaxHeight,
+		MinPrice:     query.MinPrice,
+		MaxPrice:     query.MaxPrice,
+		SortBy:       product.SortField(query.Sort),
+		Limit:        query.Limit,
+	}
+	if query.Material != "" {
+		if spec.Material = parseMaterial(query.Material); spec.Material == 0 {
+			return nil, newErrInvalidRequest(nil, "material must be paper, fullmetal or template")
+		}
+	}
+	switch query.Order {
+	case "", "asc":
+	case "desc":
+		spec.Descending = true
+	default:
+		return nil, newErrInvalidRequest(nil, "order must be asc or desc")
+	}
+
+	req := readProductsRequest{Specification: spec, Cursor: query.Cursor, Cacheable: !fromBody}
+	return req, nil
+}
+
+func parseProductsQuery(values url.Values, query *productsQuery) error {
+	query.Search = values.Get("search")
+	query.Material = values.Get("material")
+	query.Color = values.Get("color")
+	query.Sort = values.Get("sort")
+	query.Order = values.Get("order")
+	query.Cursor = values.Get("cursor")
+
+	var err error
+	parseInt := func(name string) *int {
+		value := values.Get(name)
+		if value == "" || err != nil {
+			return nil
+		}
+		n, parseErr := strconv.Atoi(value)
+		if parseErr != nil {
+			err = newErrInvalidRequest(parseErr, name+" must be integer")
+			return nil
+		}
+		return &n
+	}
+	parsePrice := func(name string) *float32 {
+		value := values.Get(name)
+		if value == "" || err != nil {
+			return nil
+		}
+		n, parseErr := strconv.ParseFloat(value, 32)
+		if parseErr != nil {
+			err = newErrInvalidRequest(parseErr, name+" must be number")
+			return nil
+		}
+		price := float32(n)
+		return &price
+	}
+	query.MinHeight = parseInt("minHeight")
+	query.MaxHeight = parseInt("maxHeight")
+	query.MinPrice = parsePrice("minPrice")
+	query.MaxPrice = parsePrice("maxPrice")
+	if limit := parseInt("limit"); limit != nil {
+		query.Limit = *limit
+	}
+	return err
+}
+
+type variantBody struct {
+	Height *int    `json:"height"`
+	Color  *string `json:"color"`
+	Price  float32 `json:"price"`
+}
+
+func (b variantBody) variant() catalog.Variant {
+	return catalog.Variant{Height: b.Height, Color: b.Color, Price: b.Price}
+}
+
+type metaProductBody struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Material    string `json:"material"`
+}
+
+func decodeReadMetaProductRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for read meta product request")
+	}
+
+	req := readMetaProductRequest{ID: id}
+	return req, nil
+}
+
+func decodeCreateMetaProductRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var body struct {
-		Search string `json:"search,omitempty"`
+		metaProductBody
+		Variants []variantBody `json:"variants"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		return nil, newErrInvalidRequest(err, "invalid read product request")
+		return nil, newErrInvalidRequest(err, "invalid create meta product request")
+	}
+
+	req := createMetaProductRequest{
+		Title:       body.Title,
+		Description: body.Description,
+		Material:    parseMaterial(body.Material),
+	}
+	for _, v := range body.Variants {
+		req.Variants = append(req.Variants, v.variant())
+	}
+	return req, nil
+}
+
+func decodeUpdateMetaProductRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for update meta product request")
+	}
+
+	var body metaProductBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid update meta product request")
+	}
+
+	req := updateMetaProductRequest{
+		ID:          id,
+		Title:       body.Title,
+		Description: body.Description,
+		Material:    parseMaterial(body.Material),
 	}
-	req := readProductsRequest{Search: body.Search}
 	return req, nil
 }
 
+func decodeRemoveMetaProductRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for remove meta product request")
+	}
+
+	req := removeMetaProductRequest{ID: id}
+	return req, nil
+}
+
+func decodeAddVariantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for add variant request")
+	}
+
+	var body variantBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid add variant request")
+	}
+
+	req := addVariantRequest{MetaProductID: id, Variant: body.variant()}
+	return req, nil
+}
+
+func decodeUpdateVariantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	variantID, variantOk := vars["variantId"]
+	if !ok || !variantOk {
+		return nil, newErrInvalidRequest(nil, "id and variant id required for update variant request")
+	}
+
+	var body variantBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid update variant request")
+	}
+
+	req := updateVariantRequest{MetaProductID: id, VariantID: variantID, Variant: body.variant()}
+	return req, nil
+}
+
+func decodeRemoveVariantRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	variantID, variantOk := vars["variantId"]
+	if !ok || !variantOk {
+		return nil, newErrInvalidRequest(nil, "id and variant id required for remove variant request")
+	}
+
+	req := removeVariantRequest{MetaProductID: id, VariantID: variantID}
+	return req, nil
+}
+
+func decodeReadStockRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for read stock request")
+	}
+
+	req := readStockRequest{ProductID: id}
+	return req, nil
+}
+
+func decodeSetStockRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for set stock request")
+	}
+
+	var body struct {
+		OnHand int `json:"onHand"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid set stock request")
+	}
+
+	req := setStockRequest{ProductID: id, OnHand: body.OnHand}
+	return req, nil
+}
+
+func decodeReserveRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var body struct {
+		ID    string `json:"id"`
+		Items []struct {
+			ProductID string `json:"productId"`
+			Quantity  int    `json:"quantity"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid reserve request")
+	}
+	if body.ID == "" {
+		return nil, newErrInvalidRequest(nil, "id required for reserve request")
+	}
+
+	req := reserveRequest{ID: body.ID}
+	for _, item := range body.Items {
+		req.Items = append(req.Items, inventory.Item{ProductID: product.ID(item.ProductID), Quantity: item.Quantity})
+	}
+	return req, nil
+}
+
+func decodeCloseReservationRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for reservation request")
+	}
+
+	req := closeReservationRequest{ID: id}
+	return req, nil
+}
+
+// productsMaxAge is how long catalog changes may be invisible to customers behind caches
+const productsMaxAge = 60
+
+// cacheableResponse is encoded with ETag, so caches revalidate it by If-None-Match instead of downloading again
+type cacheableResponse interface {
+	cacheable() bool
+}
+
+type ifNoneMatchKey struct{}
+
+func ifNoneMatchToContext(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, ifNoneMatchKey{}, r.Header.Get("If-None-Match"))
+}
+
+func encodeCacheableResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if c, ok := response.(cacheableResponse); !ok || !c.cacheable() {
+		w.Header().Set("Cache-Control", "no-store")
+		return encodeResponse(ctx, w, response)
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", productsMaxAge))
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch, _ := ctx.Value(ifNoneMatchKey{}).(string); etagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, err = w.Write(append(body, '\n'))
+	return err
+}
+
+// etagMatches uses weak comparison, proxies may mark compressed responses as weak
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if e, ok := response.(errorer); ok && e.error() != nil {
 		encodeError(ctx, e.error(), w)
@@ -77,6 +523,16 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
+	if validationErr, ok := err.(*catalog.ValidationError); ok {
+		encodeValidationError(validationErr, w)
+		return
+	}
+
+	if outOfStockErr, ok := err.(*inventory.OutOfStockError); ok {
+		encodeOutOfStockError(outOfStockErr, w)
+		return
+	}
+
 	if invalidRequestErr, ok := err.(*errInvalidRequest); ok {
 		w.WriteHeader(http.StatusBadRequest)
 		err = errors.New(invalidRequestErr.message)
@@ -85,8 +541,16 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 		err = errors.New(unauthorizedErr.message)
 	} else {
 		switch err {
-		case product.ErrProductNotFound:
+		case product.ErrProductNotFound, catalog.ErrMetaProductNotFound, catalog.ErrVariantNotFound:
 			w.WriteHeader(http.StatusNotFound)
+		case authz.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+		case product.ErrInvalidSpecification, product.ErrInvalidCursor, inventory.ErrInvalidReservation, inventory.ErrInvalidStock:
+			w.WriteHeader(http.StatusBadRequest)
+		case inventory.ErrReservationNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case inventory.ErrReservationExpired, inventory.ErrReservationCommitted, inventory.ErrReservationClosed:
+			w.WriteHeader(http.StatusConflict)
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -97,6 +561,36 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	})
 }
 
+type fieldErrorInfo struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func encodeValidationError(err *catalog.ValidationError, w http.ResponseWriter) {
+	fields := make([]fieldErrorInfo, 0, len(err.Fields))
+	for _, field := range err.Fields {
+		fields = append(fields, fieldErrorInfo{Field: field.Field, Message: field.Message})
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  err.Error(),
+		"fields": fields,
+	})
+}
+
+// encodeOutOfStockError lists products, so order service can tell the customer what to remove from the cart
+func encodeOutOfStockError(err *inventory.OutOfStockError, w http.ResponseWriter) {
+	productIDs := make([]string, 0, len(err.ProductIDs))
+	for _, id := range err.ProductIDs {
+		productIDs = append(productIDs, string(id))
+	}
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      err.Error(),
+		"productIds": productIDs,
+	})
+}
+
 type errorer interface {
 	error() error
 }
@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/product/app/product"
+)
+
+func TestParseProductsQuery(t *testing.T) {
+	values, err := url.ParseQuery("search=gopher&material=paper&color=blue&minHeight=10&maxHeight=20&minPrice=1.5&maxPrice=30&sort=price&order=desc&cursor=abc&limit=5")
+	assert.Nil(t, err)
+	var query productsQuery
+	assert.Nil(t, parseProductsQuery(values, &query))
+
+	minHeight, maxHeight := 10, 20
+	minPrice, maxPrice := float32(1.5), float32(30)
+	assert.Equal(t, productsQuery{
+		Search:    "gopher",
+		Material:  "paper",
+		Color:     "blue",
+		MinHeight: &minHeight,
+		MaxHeight: &maxHeight,
+		MinPrice:  &minPrice,
+		MaxPrice:  &maxPrice,
+		Sort:      "price",
+		Order:     "desc",
+		Cursor:    "abc",
+		Limit:     5,
+	}, query)
+
+	query = productsQuery{}
+	assert.Nil(t, parseProductsQuery(url.Values{}, &query))
+	assert.Equal(t, productsQuery{}, query, "missing parameters don't filter products")
+
+	for _, rawQuery := range []string{"minHeight=high", "maxHeight=1.5", "minPrice=cheap", "limit=all"} {
+		values, _ = url.ParseQuery(rawQuery)
+		assert.NotNil(t, parseProductsQuery(values, &productsQuery{}), rawQuery)
+	}
+}
+
+func TestDecodeReadProductsRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/products?search=gopher", strings.NewReader(`{"search": "crab"}`))
+	req, err := decodeReadProductsRequest(context.Background(), r)
+	assert.Nil(t, err)
+	assert.Equal(t, "gopher", req.(readProductsRequest).Specification.SearchString, "query string wins over the body")
+	assert.True(t, req.(readProductsRequest).Cacheable)
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/products", strings.NewReader(`{"search": "crab"}`))
+	req, err = decodeReadProductsRequest(context.Background(), r)
+	assert.Nil(t, err)
+	assert.Equal(t, "crab", req.(readProductsRequest).Specification.SearchString)
+	assert.False(t, req.(readProductsRequest).Cacheable, "caches don't take the body into account")
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/products", nil)
+	req, err = decodeReadProductsRequest(context.Background(), r)
+	assert.Nil(t, err)
+	assert.Equal(t, product.Specification{}, req.(readProductsRequest).Specification)
+	assert.True(t, req.(readProductsRequest).Cacheable)
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/products?order=random", nil)
+	_, err = decodeReadProductsRequest(context.Background(), r)
+	assert.NotNil(t, err)
+}
+
+func TestEtagMatches(t *testing.T) {
+	etag := `"abc"`
+	for ifNoneMatch, matches := range map[string]bool{
+		``:               false,
+		`"abc"`:          true,
+		`W/"abc"`:        true,
+		`"other", "abc"`: true,
+		`"other"`:        false,
+		`*`:              true,
+		`abc`:            false,
+	} {
+		assert.Equal(t, matches, etagMatches(ifNoneMatch, etag), ifNoneMatch)
+	}
+}
+
+func TestEncodeCacheableResponse(t *testing.T) {
+	response := readProductsResponse{Products: []responseProduct{{ProductID: "1", Title: "Gopher"}}, Total: 1, isCacheable: true}
+
+	w := httptest.NewRecorder()
+	assert.Nil(t, encodeCacheableResponse(context.Background(), w, response))
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Contains(t, w.Body.String(), "Gopher")
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/products", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	assert.Nil(t, encodeCacheableResponse(ifNoneMatchToContext(context.Background(), r), w, response))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Body.String())
+
+	response.Total = 2
+	w = httptest.NewRecorder()
+	assert.Nil(t, encodeCacheableResponse(ifNoneMatchToContext(context.Background(), r), w, response))
+	assert.Equal(t, http.StatusOK, w.Code, "changed listing is sent again")
+
+	response.isCacheable = false
+	w = httptest.NewRecorder()
+	assert.Nil(t, encodeCacheableResponse(ifNoneMatchToContext(context.Background(), r), w, response))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Empty(t, w.Header().Get("ETag"))
+}
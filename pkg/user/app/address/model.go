@@ -0,0 +1,47 @@
+package address
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+type ID string
+
+// Details is the part of address entered by the user, orders keep a copy of it
+type Details struct {
+	Recipient string
+	Phone     user.Phone
+	// Country is ISO 3166-1 alpha-2 code
+	Country    string
+	Region     string
+	City       string
+	PostalCode string
+	Line1      string
+	Line2      string
+}
+
+// Address belongs to one user, only one address of the user is default
+type Address struct {
+	ID     ID
+	UserID user.ID
+	Details
+	IsDefault bool
+	CreatedAt time.Time
+}
+
+// Repository returns addresses of the user in creation order. Store doesn't change default flag of stored address,
+// SetDefault makes the address default and drops the flag from other addresses of the user at once
+type Repository interface {
+	Store(*Address) error
+	Find(ID) (*Address, error)
+	FindByUserID(user.ID) ([]Address, error)
+	SetDefault(userID user.ID, id ID) error
+	Remove(ID) error
+	RemoveByUserID(user.ID) error
+	NextID() (ID, error)
+}
+
+var ErrAddressNotFound = errors.New("address not found")
+var ErrTooManyAddresses = errors.New("too many addresses")
@@ -0,0 +1,126 @@
+package address
+
+import (
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const maxAddressesPerUser = 20
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+type Service struct {
+	repo Repository
+}
+
+// Create adds address to the address book, the first address becomes default anyway
+func (s *Service) Create(userID user.ID, details Details, makeDefault bool) (*Address, error) {
+	details, err := validateDetails(details)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) >= maxAddressesPerUser {
+		return nil, ErrTooManyAddresses
+	}
+
+	id, err := s.repo.NextID()
+	if err != nil {
+		return nil, err
+	}
+	a := &Address{ID: id, UserID: userID, Details: details, CreatedAt: time.Now()}
+	if err = s.repo.Store(a); err != nil {
+		return nil, err
+	}
+	if makeDefault || len(addresses) == 0 {
+		return a, s.setDefault(a)
+	}
+	return a, nil
+}
+
+// Update replaces details of the address. Default flag can only be moved to the address, it can't be dropped without another default
+func (s *Service) Update(userID user.ID, id ID, details Details, makeDefault bool) (*Address, error) {
+	details, err := validateDetails(details)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s.Find(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Details = details
+	if err = s.repo.Store(a); err != nil {
+		return nil, err
+	}
+	if makeDefault && !a.IsDefault {
+		return a, s.setDefault(a)
+	}
+	return a, nil
+}
+
+// Remove deletes the address, the oldest of the rest addresses becomes default instead of removed default address
+func (s *Service) Remove(userID user.ID, id ID) error {
+	a, err := s.Find(userID, id)
+	if err != nil {
+		return err
+	}
+	if err = s.repo.Remove(id); err != nil || !a.IsDefault {
+		return err
+	}
+
+	addresses, err := s.repo.FindByUserID(userID)
+	if err != nil || len(addresses) == 0 {
+		return err
+	}
+	return s.setDefault(&addresses[0])
+}
+
+// Find returns address of the user, address of another user is reported as not found
+func (s *Service) Find(userID user.ID, id ID) (*Address, error) {
+	a, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	if a.UserID != userID {
+		return nil, ErrAddressNotFound
+	}
+	return a, nil
+}
+
+// DefaultAddress returns ErrAddressNotFound when the address book is empty
+func (s *Service) DefaultAddress(userID user.ID) (*Address, error) {
+	addresses, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addresses {
+		if a.IsDefault {
+			return &a, nil
+		}
+	}
+	return nil, ErrAddressNotFound
+}
+
+func (s *Service) UserAddresses(userID user.ID) ([]Address, error) {
+	return s.repo.FindByUserID(userID)
+}
+
+// RemoveUserAddresses erases the address book of deleted user
+func (s *Service) RemoveUserAddresses(userID user.ID) error {
+	return s.repo.RemoveByUserID(userID)
+}
+
+func (s *Service) setDefault(a *Address) error {
+	if err := s.repo.SetDefault(a.UserID, a.ID); err != nil {
+		return err
+	}
+	a.IsDefault = true
+	return nil
+}
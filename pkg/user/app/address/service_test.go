@@ -0,0 +1,108 @@
+package address_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/address"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestAddressService_Default(t *testing.T) {
+	service := address.NewService(memory.NewAddressRepository())
+
+	home, err := service.Create("user", validDetails(), false)
+	assert.Nil(t, err)
+	assert.True(t, home.IsDefault, "the first address is default")
+
+	work, err := service.Create("user", validDetails(), false)
+	assert.Nil(t, err)
+	assert.False(t, work.IsDefault)
+
+	_, err = service.Update("user", work.ID, validDetails(), true)
+	assert.Nil(t, err)
+	defaultAddress, err := service.DefaultAddress("user")
+	assert.Nil(t, err)
+	assert.Equal(t, work.ID, defaultAddress.ID)
+
+	_, err = service.Update("user", work.ID, validDetails(), false)
+	assert.Nil(t, err)
+	defaultAddress, err = service.DefaultAddress("user")
+	assert.Nil(t, err)
+	assert.Equal(t, work.ID, defaultAddress.ID, "update without default flag keeps the default")
+
+	assert.Nil(t, service.Remove("user", work.ID))
+	defaultAddress, err = service.DefaultAddress("user")
+	assert.Nil(t, err)
+	assert.Equal(t, home.ID, defaultAddress.ID, "the rest address becomes default")
+
+	assert.Nil(t, service.Remove("user", home.ID))
+	_, err = service.DefaultAddress("user")
+	assert.Equal(t, address.ErrAddressNotFound, err)
+}
+
+func TestAddressService_OtherUserAddress(t *testing.T) {
+	service := address.NewService(memory.NewAddressRepository())
+
+	a, err := service.Create("owner", validDetails(), false)
+	assert.Nil(t, err)
+
+	_, err = service.Find("other", a.ID)
+	assert.Equal(t, address.ErrAddressNotFound, err)
+	_, err = service.Update("other", a.ID, validDetails(), true)
+	assert.Equal(t, address.ErrAddressNotFound, err)
+	assert.Equal(t, address.ErrAddressNotFound, service.Remove("other", a.ID))
+
+	assert.Nil(t, service.RemoveUserAddresses("owner"))
+	_, err = service.Find("owner", a.ID)
+	assert.Equal(t, address.ErrAddressNotFound, err)
+}
+
+func TestAddressService_Validation(t *testing.T) {
+	service := address.NewService(memory.NewAddressRepository())
+
+	details := validDetails()
+	details.Country = " ru "
+	details.PostalCode = "sw1a 1aa"
+	details.Phone = "+7 (900) 123-45-67"
+	a, err := service.Create("user", details, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "RU", a.Country)
+	assert.Equal(t, "SW1A 1AA", a.PostalCode)
+	assert.Equal(t, user.Phone("+79001234567"), a.Phone)
+
+	_, err = service.Create("user", address.Details{Country: "Russia", PostalCode: "1", Phone: "phone"}, false)
+	validationErr, ok := err.(*user.ValidationError)
+	assert.True(t, ok)
+	var fields []string
+	for _, f := range validationErr.Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.ElementsMatch(t, []string{
+		address.FieldRecipient, address.FieldCity, address.FieldLine1,
+		address.FieldCountry, address.FieldPostalCode, address.FieldPhone,
+	}, fields)
+}
+
+func TestAddressService_TooManyAddresses(t *testing.T) {
+	service := address.NewService(memory.NewAddressRepository())
+
+	for i := 0; i < 20; i++ {
+		_, err := service.Create("user", validDetails(), false)
+		assert.Nil(t, err)
+	}
+	_, err := service.Create("user", validDetails(), false)
+	assert.Equal(t, address.ErrTooManyAddresses, err)
+}
+
+func validDetails() address.Details {
+	return address.Details{
+		Recipient:  "Ivan Ivanov",
+		Country:    "RU",
+		City:       "Moscow",
+		PostalCode: "101000",
+		Line1:      "Tverskaya st., 1",
+	}
+}
@@ -0,0 +1,83 @@
+package address
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const (
+	maxNameLength = 100
+	maxLineLength = 200
+)
+
+// Field names match json fields of the api, errors are reported the same way as profile errors
+const (
+	FieldRecipient  = "recipient"
+	FieldPhone      = "phone"
+	FieldCountry    = "country"
+	FieldRegion     = "region"
+	FieldCity       = "city"
+	FieldPostalCode = "postalCode"
+	FieldLine1      = "line1"
+	FieldLine2      = "line2"
+)
+
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// postalCodePattern covers formats of all countries, e.g. "101000", "SW1A 1AA" or "10001-0001"
+var postalCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,8}[A-Z0-9]$`)
+
+// validateDetails returns details with trimmed values, uppercased country and postal code and normalized phone
+func validateDetails(d Details) (Details, error) {
+	d = Details{
+		Recipient:  strings.TrimSpace(d.Recipient),
+		Phone:      user.Phone(strings.TrimSpace(string(d.Phone))),
+		Country:    strings.ToUpper(strings.TrimSpace(d.Country)),
+		Region:     strings.TrimSpace(d.Region),
+		City:       strings.TrimSpace(d.City),
+		PostalCode: strings.ToUpper(strings.TrimSpace(d.PostalCode)),
+		Line1:      strings.TrimSpace(d.Line1),
+		Line2:      strings.TrimSpace(d.Line2),
+	}
+
+	var fields []user.FieldError
+	optional := func(field, value string, maxLength int) {
+		if utf8.RuneCountInString(value) > maxLength {
+			fields = append(fields, user.FieldError{Field: field, Message: "is too long"})
+		}
+	}
+	required := func(field, value string, maxLength int) {
+		if value == "" {
+			fields = append(fields, user.FieldError{Field: field, Message: "is required"})
+		} else {
+			optional(field, value, maxLength)
+		}
+	}
+	required(FieldRecipient, d.Recipient, maxNameLength)
+	optional(FieldRegion, d.Region, maxNameLength)
+	required(FieldCity, d.City, maxNameLength)
+	required(FieldLine1, d.Line1, maxLineLength)
+	optional(FieldLine2, d.Line2, maxLineLength)
+
+	if !countryPattern.MatchString(d.Country) {
+		fields = append(fields, user.FieldError{Field: FieldCountry, Message: "must be ISO 3166-1 alpha-2 code, e.g. RU"})
+	}
+	if !postalCodePattern.MatchString(d.PostalCode) {
+		fields = append(fields, user.FieldError{Field: FieldPostalCode, Message: "must be from 3 to 10 latin letters, digits, spaces or '-'"})
+	}
+	if d.Phone != "" {
+		phone, err := user.NormalizePhone(string(d.Phone))
+		if err != nil {
+			fields = append(fields, user.FieldError{Field: FieldPhone, Message: err.Error()})
+		}
+		d.Phone = phone
+	}
+
+	if len(fields) > 0 {
+		return d, &user.ValidationError{Fields: fields}
+	}
+	return d, nil
+}
@@ -0,0 +1,64 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+type ID string
+
+type Scope string
+
+const (
+	// ScopeRead allows only safe requests
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+)
+
+func KnownScope(scope Scope) bool {
+	return scope == ScopeRead || scope == ScopeWrite
+}
+
+// Key authenticates scripts on behalf of the user, only hash of the secret is stored
+type Key struct {
+	ID         ID
+	UserID     user.ID
+	Name       string
+	Hash       string
+	Scopes     []Scope
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// Allows checks scopes of the key against http method of the request
+func (k Key) Allows(method string) bool {
+	for _, scope := range k.Scopes {
+		switch scope {
+		case ScopeWrite:
+			return true
+		case ScopeRead:
+			if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type Repository interface {
+	// Store saves new key
+	Store(*Key) error
+	// MarkUsed changes only last usage time of stored key, removed key is not stored again and ErrKeyNotFound is returned
+	MarkUsed(id ID, lastUsedAt time.Time) error
+	Find(ID) (*Key, error)
+	FindByUserID(user.ID) ([]Key, error)
+	Remove(ID) error
+	NextID() (ID, error)
+}
+
+var ErrKeyNotFound = errors.New("api key not found")
+var ErrInvalidKey = errors.New("invalid api key")
+var ErrInvalidScope = errors.New("invalid api key scope")
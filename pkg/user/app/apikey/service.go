@@ -0,0 +1,134 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/jwt"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const (
+	// Prefix tells api keys apart from access tokens in Authorization header
+	Prefix        = jwt.APIKeyPrefix
+	keySeparator  = "_"
+	keySecretSize = 32
+	// lastUsedStep limits storage writes, last used time is not updated more often than once per step
+	lastUsedStep = time.Minute
+)
+
+func NewService(repo Repository, users *user.Service) *Service {
+	return &Service{repo, users}
+}
+
+type Service struct {
+	repo  Repository
+	users *user.Service
+}
+
+// Create returns the key with its secret, the secret can't be shown later
+func (s *Service) Create(userID user.ID, name string, scopes []Scope) (*Key, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !KnownScope(scope) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+	if _, err := s.users.ReadUser(userID); err != nil {
+		return nil, "", err
+	}
+
+	id, err := s.repo.NextID()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := make([]byte, keySecretSize)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+
+	key := &Key{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Hash:      hash(encodedSecret),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	return key, Prefix + string(id) + keySeparator + encodedSecret, s.repo.Store(key)
+}
+
+// UserKeys returns keys of the user, the newest first
+func (s *Service) UserKeys(userID user.ID) ([]Key, error) {
+	keys, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Revoke removes key only if it belongs to the user
+func (s *Service) Revoke(userID user.ID, id ID) error {
+	key, err := s.repo.Find(id)
+	if err != nil {
+		return err
+	}
+	if key.UserID != userID {
+		return ErrKeyNotFound
+	}
+	return s.repo.Remove(id)
+}
+
+// Authenticate returns the key and its owner, user data is read on each request so changes are visible at once
+func (s *Service) Authenticate(apiKey string) (*Key, *user.User, error) {
+	parts := strings.SplitN(strings.TrimPrefix(apiKey, Prefix), keySeparator, 2)
+	if !strings.HasPrefix(apiKey, Prefix) || len(parts) != 2 {
+		return nil, nil, ErrInvalidKey
+	}
+
+	key, err := s.repo.Find(ID(parts[0]))
+	if err == ErrKeyNotFound {
+		return nil, nil, ErrInvalidKey
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(parts[1])), []byte(key.Hash)) != 1 {
+		return nil, nil, ErrInvalidKey
+	}
+
+	u, err := s.users.ReadUser(key.UserID)
+	if err == user.ErrUserNotFound {
+		return nil, nil, ErrInvalidKey
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedStep {
+		key.LastUsedAt = &now
+		// the key is revoked meanwhile
+		if err = s.repo.MarkUsed(key.ID, now); err == ErrKeyNotFound {
+			return nil, nil, ErrInvalidKey
+		} else if err != nil {
+			return nil, nil, err
+		}
+	}
+	return key, u, nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
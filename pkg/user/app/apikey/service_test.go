@@ -0,0 +1,79 @@
+package apikey_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/apikey"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user/usertest"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestAPIKeyService_Authenticate(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	service := apikey.NewService(memory.NewAPIKeyRepository(), users)
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+
+	key, secret, err := service.Create(userID, "warehouse", []apikey.Scope{apikey.ScopeRead})
+	assert.Nil(t, err)
+	assert.NotContains(t, key.Hash, secret)
+	assert.Nil(t, key.LastUsedAt)
+
+	authenticated, u, err := service.Authenticate(secret)
+	assert.Nil(t, err)
+	assert.Equal(t, userID, u.ID)
+	assert.Equal(t, key.ID, authenticated.ID)
+	assert.True(t, authenticated.Allows(http.MethodGet))
+	assert.False(t, authenticated.Allows(http.MethodPost))
+
+	keys, err := service.UserKeys(userID)
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].LastUsedAt)
+
+	_, _, err = service.Authenticate(secret + "x")
+	assert.Equal(t, apikey.ErrInvalidKey, err)
+	_, _, err = service.Authenticate("invalid")
+	assert.Equal(t, apikey.ErrInvalidKey, err)
+}
+
+func TestAPIKeyService_Revoke(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	service := apikey.NewService(memory.NewAPIKeyRepository(), users)
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	otherID, err := users.CreateUser(user.Actor{}, "other", "first name", "last name", "other@email.ru", "+79011234567", "pass")
+	assert.Nil(t, err)
+
+	_, _, err = service.Create(userID, "warehouse", []apikey.Scope{"admin"})
+	assert.Equal(t, apikey.ErrInvalidScope, err)
+
+	key, secret, err := service.Create(userID, "warehouse", []apikey.Scope{apikey.ScopeWrite})
+	assert.Nil(t, err)
+
+	assert.Equal(t, apikey.ErrKeyNotFound, service.Revoke(otherID, key.ID))
+	assert.Nil(t, service.Revoke(userID, key.ID))
+	_, _, err = service.Authenticate(secret)
+	assert.Equal(t, apikey.ErrInvalidKey, err)
+}
+
+func TestAPIKeyService_UsageDoesNotRestoreRevokedKey(t *testing.T) {
+	repo := memory.NewAPIKeyRepository()
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	service := apikey.NewService(repo, users)
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	key, _, err := service.Create(userID, "warehouse", []apikey.Scope{apikey.ScopeRead})
+	assert.Nil(t, err)
+
+	// usage is recorded after the key is revoked on another replica
+	assert.Nil(t, service.Revoke(userID, key.ID))
+	assert.Equal(t, apikey.ErrKeyNotFound, repo.MarkUsed(key.ID, time.Now()))
+	_, err = repo.Find(key.ID)
+	assert.Equal(t, apikey.ErrKeyNotFound, err)
+}
@@ -0,0 +1,56 @@
+package attempt
+
+import (
+	"errors"
+	"time"
+)
+
+// Key identifies subject of the login attempts, e.g. username or client IP
+type Key string
+
+func UsernameKey(username string) Key {
+	return Key("username:" + username)
+}
+
+func IPKey(ip string) Key {
+	return Key("ip:" + ip)
+}
+
+// Failures are counted in a row, counter is dropped after success or when the last failure is too old
+type Failures struct {
+	Count  int
+	LastAt time.Time
+}
+
+// Store is shared between all service replicas, so lockout can't be bypassed by hitting another replica
+type Store interface {
+	Find(Key) (Failures, error)
+	// Add registers failure atomically, failures older than ttl are forgotten
+	Add(key Key, at time.Time, ttl time.Duration) (Failures, error)
+	// Release takes back one failure added in advance, counter never goes below zero
+	Release(Key) error
+	Remove(Key) error
+}
+
+// Policy allows FreeAttempts failures in a row, then each next failure doubles lockout starting from BaseLockout
+type Policy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+}
+
+func (p Policy) Lockout(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+	lockout := p.BaseLockout
+	for i := p.FreeAttempts; i < failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > p.MaxLockout {
+		return p.MaxLockout
+	}
+	return lockout
+}
+
+var ErrTooManyAttempts = errors.New("too many login attempts")
@@ -0,0 +1,91 @@
+package attempt
+
+import (
+	"strings"
+	"time"
+)
+
+// failuresTTL is how long failures are remembered, it must be longer than any lockout
+const failuresTTL = 24 * time.Hour
+
+// NewService limits login attempts per username and per client IP separately,
+// IP limit is usually looser, since many users may share one address
+func NewService(store Store, usernamePolicy, ipPolicy Policy) *Service {
+	return &Service{store, usernamePolicy, ipPolicy}
+}
+
+type Service struct {
+	store          Store
+	usernamePolicy Policy
+	ipPolicy       Policy
+}
+
+// Reserve counts the attempt as failed before credentials are verified, so parallel guesses can't get
+// around the lockout. It returns ErrTooManyAttempts and time to wait if username or IP is locked.
+// Caller must Release the attempt when credentials turn out to be valid.
+func (s *Service) Reserve(username, ip string) (time.Duration, error) {
+	now := time.Now()
+	policies := s.policies(username, ip)
+	seen := make(map[Key]int, len(policies))
+	var retryAfter time.Duration
+	for key, policy := range policies {
+		failures, err := s.store.Find(key)
+		if err != nil {
+			return 0, err
+		}
+		if now.Sub(failures.LastAt) >= failuresTTL {
+			continue
+		}
+		seen[key] = failures.Count
+		if wait := failures.LastAt.Add(policy.Lockout(failures.Count)).Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	// locked attempt is not counted, otherwise retries would prolong the lockout
+	if retryAfter > 0 {
+		return retryAfter, ErrTooManyAttempts
+	}
+
+	for key, policy := range policies {
+		failures, err := s.store.Add(key, now, failuresTTL)
+		if err != nil {
+			return 0, err
+		}
+		// concurrent attempts are reserved after the check, the attempt is allowed while they don't lock the key
+		if failures.Count > seen[key]+1 {
+			if wait := policy.Lockout(failures.Count - 1); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter, ErrTooManyAttempts
+	}
+	return 0, nil
+}
+
+// Release takes back the reserved attempt, e.g. password is valid, so login from shared IP is not counted
+func (s *Service) Release(username, ip string) error {
+	for key := range s.policies(username, ip) {
+		if err := s.store.Release(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Succeeded resets username counter only, otherwise attacker could reset IP counter by logging into own account
+func (s *Service) Succeeded(username string) error {
+	return s.store.Remove(UsernameKey(normalizeUsername(username)))
+}
+
+func (s *Service) policies(username, ip string) map[Key]Policy {
+	return map[Key]Policy{
+		UsernameKey(normalizeUsername(username)): s.usernamePolicy,
+		IPKey(ip):                                s.ipPolicy,
+	}
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
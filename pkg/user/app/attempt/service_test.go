@@ -0,0 +1,102 @@
+package attempt_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/attempt"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestPolicy_Lockout(t *testing.T) {
+	policy := attempt.Policy{FreeAttempts: 3, BaseLockout: time.Second, MaxLockout: 5 * time.Second}
+
+	assert.Equal(t, time.Duration(0), policy.Lockout(2))
+	assert.Equal(t, time.Second, policy.Lockout(3))
+	assert.Equal(t, 2*time.Second, policy.Lockout(4))
+	assert.Equal(t, 4*time.Second, policy.Lockout(5))
+	assert.Equal(t, 5*time.Second, policy.Lockout(6))
+	assert.Equal(t, 5*time.Second, policy.Lockout(100))
+}
+
+func TestAttemptService_LocksUsername(t *testing.T) {
+	usernamePolicy := attempt.Policy{FreeAttempts: 2, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	ipPolicy := attempt.Policy{FreeAttempts: 10, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	service := attempt.NewService(memory.NewAttemptStore(), usernamePolicy, ipPolicy)
+
+	_, err := service.Reserve("username", "10.0.0.1")
+	assert.Nil(t, err)
+	_, err = service.Reserve("UserName", "10.0.0.2")
+	assert.Nil(t, err)
+
+	retryAfter, err := service.Reserve("username", "10.0.0.3")
+	assert.Equal(t, attempt.ErrTooManyAttempts, err)
+	assert.True(t, retryAfter > 0 && retryAfter <= time.Minute)
+
+	_, err = service.Reserve("other", "10.0.0.1")
+	assert.Nil(t, err)
+
+	assert.Nil(t, service.Succeeded("username"))
+	_, err = service.Reserve("username", "10.0.0.1")
+	assert.Nil(t, err)
+}
+
+func TestAttemptService_LocksIP(t *testing.T) {
+	usernamePolicy := attempt.Policy{FreeAttempts: 10, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	ipPolicy := attempt.Policy{FreeAttempts: 2, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	service := attempt.NewService(memory.NewAttemptStore(), usernamePolicy, ipPolicy)
+
+	_, err := service.Reserve("first", "10.0.0.1")
+	assert.Nil(t, err)
+	_, err = service.Reserve("second", "10.0.0.1")
+	assert.Nil(t, err)
+
+	_, err = service.Reserve("third", "10.0.0.1")
+	assert.Equal(t, attempt.ErrTooManyAttempts, err)
+	_, err = service.Reserve("third", "10.0.0.2")
+	assert.Nil(t, err)
+
+	// success doesn't reset IP counter
+	assert.Nil(t, service.Succeeded("third"))
+	_, err = service.Reserve("third", "10.0.0.1")
+	assert.Equal(t, attempt.ErrTooManyAttempts, err)
+}
+
+func TestAttemptService_ReleasedAttemptIsNotCounted(t *testing.T) {
+	usernamePolicy := attempt.Policy{FreeAttempts: 2, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	ipPolicy := attempt.Policy{FreeAttempts: 2, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	service := attempt.NewService(memory.NewAttemptStore(), usernamePolicy, ipPolicy)
+
+	// users behind the same IP log in successfully
+	for _, username := range []string{"first", "second", "third"} {
+		_, err := service.Reserve(username, "10.0.0.1")
+		assert.Nil(t, err)
+		assert.Nil(t, service.Release(username, "10.0.0.1"))
+	}
+	_, err := service.Reserve("fourth", "10.0.0.1")
+	assert.Nil(t, err)
+}
+
+func TestAttemptService_ParallelAttemptsAreLimited(t *testing.T) {
+	usernamePolicy := attempt.Policy{FreeAttempts: 5, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	ipPolicy := attempt.Policy{FreeAttempts: 100, BaseLockout: time.Minute, MaxLockout: time.Hour}
+	service := attempt.NewService(memory.NewAttemptStore(), usernamePolicy, ipPolicy)
+
+	var wg sync.WaitGroup
+	var allowed int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.Reserve("username", "10.0.0.1"); err == nil {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), allowed)
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+type ID string
+
+// Action of user changes is defined by the user package, its repository records them in the same transaction
+type Action = user.Action
+
+const (
+	ActionUserCreated     = user.ActionCreated
+	ActionUserUpdated     = user.ActionUpdated
+	ActionUserDeleted     = user.ActionDeleted
+	ActionPasswordChanged = user.ActionPasswordChanged
+	ActionEmailVerified   = user.ActionEmailVerified
+)
+
+const (
+	ActionLogin  Action = "login"
+	ActionLogout Action = "logout"
+)
+
+// Profile fields are named like in user validation errors
+const (
+	FieldEmailVerified = "emailVerified"
+	FieldRoles         = "roles"
+	// FieldPassword is recorded without values, the trail must not keep even password hashes
+	FieldPassword = "password"
+)
+
+type Actor = user.Actor
+
+type Change struct {
+	Field  string
+	Before string
+	After  string
+}
+
+type Entry struct {
+	ID        ID
+	UserID    user.ID
+	Actor     Actor
+	Action    Action
+	Changes   []Change
+	CreatedAt time.Time
+}
+
+// Filter selects entries of the time range [From, To), zero UserID selects entries of all users
+type Filter struct {
+	UserID user.ID
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// Repository is append-only, entries are never changed or removed. Find returns the newest entries first
+type Repository interface {
+	Append(*Entry) error
+	Find(Filter) ([]Entry, error)
+	NextID() (ID, error)
+}
+
+var ErrInvalidFilter = errors.New("invalid audit filter")
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
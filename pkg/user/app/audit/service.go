@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+type Service struct {
+	repo Repository
+}
+
+func (s *Service) Record(actor Actor, action Action, userID user.ID, changes []Change) error {
+	id, err := s.repo.NextID()
+	if err != nil {
+		return err
+	}
+	return s.repo.Append(&Entry{
+		ID:        id,
+		UserID:    userID,
+		Actor:     actor,
+		Action:    action,
+		Changes:   changes,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (s *Service) Entries(filter Filter) ([]Entry, error) {
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, ErrInvalidFilter
+	}
+	if filter.Limit < 0 || filter.Limit > maxLimit {
+		return nil, ErrInvalidFilter
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultLimit
+	}
+	return s.repo.Find(filter)
+}
+
+// UserEntry is appended by the user repository in the same transaction as the change, after is nil for deleted user.
+// Deleted user is recorded by id only, the trail must not keep personal data of removed account
+func UserEntry(id ID, userID user.ID, after *user.User, change user.Change, createdAt time.Time) Entry {
+	entry := Entry{
+		ID:        id,
+		UserID:    userID,
+		Actor:     change.Actor,
+		Action:    change.Action,
+		CreatedAt: createdAt,
+	}
+	if after != nil {
+		entry.Changes = Diff(change.Before, after)
+	}
+	return entry
+}
+
+// Diff lists changed fields of the user, password is reported without values
+func Diff(before, after *user.User) []Change {
+	if before == nil {
+		before = &user.User{}
+	}
+	if after == nil {
+		after = &user.User{}
+	}
+
+	var changes []Change
+	addChange := func(field, before, after string) {
+		if before != after {
+			changes = append(changes, Change{Field: field, Before: before, After: after})
+		}
+	}
+	addChange(user.FieldUsername, before.Username, after.Username)
+	addChange(user.FieldFirstName, before.FirstName, after.FirstName)
+	addChange(user.FieldLastName, before.LastName, after.LastName)
+	addChange(user.FieldEmail, string(before.Email), string(after.Email))
+	addChange(FieldEmailVerified, strconv.FormatBool(before.EmailVerified), strconv.FormatBool(after.EmailVerified))
+	addChange(user.FieldPhone, string(before.Phone), string(after.Phone))
+	addChange(FieldRoles, authz.FormatRoles(user.AuthzRoles(before.Roles)), authz.FormatRoles(user.AuthzRoles(after.Roles)))
+	if before.EncodedPass != after.EncodedPass {
+		changes = append(changes, Change{Field: FieldPassword})
+	}
+	return changes
+}
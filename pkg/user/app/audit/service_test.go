@@ -0,0 +1,75 @@
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestDiff(t *testing.T) {
+	before := &user.User{ID: "1", Username: "username", Email: "some@email.ru", EmailVerified: true, EncodedPass: "pass"}
+	after := &user.User{ID: "1", Username: "username", Email: "other@email.ru", EncodedPass: "new pass", Roles: []user.Role{"admin"}}
+
+	assert.Equal(t, []audit.Change{
+		{Field: user.FieldEmail, Before: "some@email.ru", After: "other@email.ru"},
+		{Field: audit.FieldEmailVerified, Before: "true", After: "false"},
+		{Field: audit.FieldRoles, Before: "", After: "admin"},
+		{Field: audit.FieldPassword},
+	}, audit.Diff(before, after))
+	assert.Empty(t, audit.Diff(before, before))
+
+	created := audit.Diff(nil, after)
+	assert.Contains(t, created, audit.Change{Field: user.FieldUsername, After: "username"})
+}
+
+func TestUserEntry(t *testing.T) {
+	admin := audit.Actor{UserID: "admin", IP: "10.0.0.1"}
+	u := &user.User{ID: "1", Username: "username", Email: "some@email.ru"}
+
+	created := audit.UserEntry("entry", u.ID, u, user.Change{Actor: admin, Action: user.ActionCreated}, time.Now())
+	assert.Equal(t, audit.ActionUserCreated, created.Action)
+	assert.Equal(t, admin, created.Actor)
+	assert.Contains(t, created.Changes, audit.Change{Field: user.FieldEmail, After: "some@email.ru"})
+
+	// personal data of deleted user is not kept
+	deleted := audit.UserEntry("entry", u.ID, nil, user.Change{Actor: admin, Action: user.ActionDeleted, Before: u}, time.Now())
+	assert.Equal(t, user.ID("1"), deleted.UserID)
+	assert.Empty(t, deleted.Changes)
+}
+
+func TestAuditService_Entries(t *testing.T) {
+	service := audit.NewService(memory.NewAuditRepository())
+	admin := audit.Actor{UserID: "admin", IP: "10.0.0.1"}
+	from := time.Now()
+
+	assert.Nil(t, service.Record(admin, audit.ActionUserCreated, "1", []audit.Change{{Field: user.FieldUsername, After: "first"}}))
+	assert.Nil(t, service.Record(audit.Actor{UserID: "2"}, audit.ActionLogin, "2", nil))
+	assert.Nil(t, service.Record(admin, audit.ActionUserDeleted, "1", nil))
+
+	entries, err := service.Entries(audit.Filter{UserID: "1"})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	// the newest entries go first
+	assert.Equal(t, audit.ActionUserDeleted, entries[0].Action)
+	assert.Equal(t, audit.ActionUserCreated, entries[1].Action)
+	assert.Equal(t, admin, entries[1].Actor)
+
+	entries, err = service.Entries(audit.Filter{From: from, To: time.Now().Add(time.Second), Limit: 2})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, audit.ActionLogin, entries[1].Action)
+
+	entries, err = service.Entries(audit.Filter{To: from})
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	_, err = service.Entries(audit.Filter{From: from, To: from})
+	assert.Equal(t, audit.ErrInvalidFilter, err)
+	_, err = service.Entries(audit.Filter{Limit: 100000})
+	assert.Equal(t, audit.ErrInvalidFilter, err)
+}
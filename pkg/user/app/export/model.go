@@ -0,0 +1,40 @@
+package export
+
+import (
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// Source provides personal data kept by another service, nil data means the service has nothing about the user
+type Source interface {
+	Name() string
+	Export(userID user.ID) (interface{}, error)
+}
+
+// Section is a part of the archive, sections keep the order they are collected in
+type Section struct {
+	Name string
+	Data interface{}
+}
+
+// Profile doesn't contain password hash, it is not personal data the user can use
+type Profile struct {
+	ID            string   `json:"id"`
+	Username      string   `json:"username"`
+	FirstName     string   `json:"firstName"`
+	LastName      string   `json:"lastName"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"emailVerified"`
+	Phone         string   `json:"phone"`
+	Roles         []string `json:"roles"`
+}
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
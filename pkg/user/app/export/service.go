@@ -0,0 +1,71 @@
+package export
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const (
+	profileSection  = "profile"
+	sessionsSection = "sessions"
+)
+
+func NewService(users *user.Service, sessions *session.Service, sources ...Source) *Service {
+	return &Service{users, sessions, sources}
+}
+
+type Service struct {
+	users    *user.Service
+	sessions *session.Service
+	sources  []Source
+}
+
+// Export collects all personal data of the user. Export fails if any source fails, partial archive can't be told from complete one
+func (s *Service) Export(userID user.ID) ([]Section, error) {
+	u, err := s.users.ReadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]string, 0, len(u.Roles))
+	for _, role := range u.Roles {
+		roles = append(roles, string(role))
+	}
+	sections := []Section{{Name: profileSection, Data: Profile{
+		ID:            string(u.ID),
+		Username:      u.Username,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Email:         string(u.Email),
+		EmailVerified: u.EmailVerified,
+		Phone:         string(u.Phone),
+		Roles:         roles,
+	}}}
+
+	userSessions, err := s.sessions.UserSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+	exportedSessions := make([]Session, 0, len(userSessions))
+	for _, userSession := range userSessions {
+		exportedSessions = append(exportedSessions, Session{
+			ID:         userSession.Handle(),
+			UserAgent:  userSession.UserAgent,
+			IP:         userSession.IP,
+			CreatedAt:  userSession.CreatedAt,
+			LastSeenAt: userSession.LastSeenAt,
+			ExpiresAt:  userSession.ExpiresAt,
+		})
+	}
+	sections = append(sections, Section{Name: sessionsSection, Data: exportedSessions})
+
+	for _, source := range s.sources {
+		data, err := source.Export(userID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't export %s data", source.Name())
+		}
+		sections = append(sections, Section{Name: source.Name(), Data: data})
+	}
+	return sections, nil
+}
@@ -0,0 +1,78 @@
+package export_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/export"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user/usertest"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestExportService_Export(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	sessions := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+	cart := &mockSource{name: "cart", data: map[string]string{"productId": "1"}}
+	service := export.NewService(users, sessions, cart)
+
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	u, err := users.ReadUser(userID)
+	assert.Nil(t, err)
+	_, _, err = sessions.Start(u, session.Client{UserAgent: "curl", IP: "127.0.0.1"})
+	assert.Nil(t, err)
+
+	sections, err := service.Export(userID)
+	assert.Nil(t, err)
+	assert.Len(t, sections, 3)
+
+	assert.Equal(t, "profile", sections[0].Name)
+	profile := sections[0].Data.(export.Profile)
+	assert.Equal(t, "username", profile.Username)
+	assert.Equal(t, "+79001234567", profile.Phone)
+
+	assert.Equal(t, "sessions", sections[1].Name)
+	exportedSessions := sections[1].Data.([]export.Session)
+	assert.Len(t, exportedSessions, 1)
+	assert.Equal(t, "curl", exportedSessions[0].UserAgent)
+
+	assert.Equal(t, "cart", sections[2].Name)
+	assert.Equal(t, cart.data, sections[2].Data)
+	assert.Equal(t, userID, cart.requestedUserID)
+}
+
+func TestExportService_ExportFailures(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	sessions := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+	orders := &mockSource{name: "orders", err: errors.New("connection refused")}
+	service := export.NewService(users, sessions, orders)
+
+	_, err := service.Export("unknown")
+	assert.Equal(t, user.ErrUserNotFound, errors.Cause(err))
+
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	_, err = service.Export(userID)
+	assert.Equal(t, orders.err, errors.Cause(err))
+}
+
+type mockSource struct {
+	name            string
+	data            interface{}
+	err             error
+	requestedUserID user.ID
+}
+
+func (s *mockSource) Name() string {
+	return s.name
+}
+
+func (s *mockSource) Export(userID user.ID) (interface{}, error) {
+	s.requestedUserID = userID
+	return s.data, s.err
+}
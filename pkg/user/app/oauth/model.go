@@ -0,0 +1,98 @@
+package oauth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+type ClientID string
+
+// Client is an application registered to obtain tokens on behalf of users.
+// Public clients like mobile apps have no secret and rely on PKCE only
+type Client struct {
+	ID           ClientID
+	SecretHash   string
+	Name         string
+	RedirectURIs []string
+}
+
+func (c Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+func (c Client) AllowsRedirectURI(redirectURI string) bool {
+	for _, uri := range c.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+type ClientRepository interface {
+	Store(*Client) error
+	Find(ClientID) (*Client, error)
+	NextID() (ClientID, error)
+}
+
+// AuthorizationCode is exchanged for tokens once, only hash of the code is stored
+type AuthorizationCode struct {
+	Hash          string
+	ClientID      ClientID
+	UserID        user.ID
+	RedirectURI   string
+	Scope         string
+	CodeChallenge string
+	Nonce         string
+	ExpiresAt     time.Time
+}
+
+func (c AuthorizationCode) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+type CodeRepository interface {
+	Store(*AuthorizationCode) error
+	// Take removes code and returns it, so concurrent exchanges can't use the same code twice
+	Take(hash string) (*AuthorizationCode, error)
+}
+
+// AuthorizationRequest holds parameters of the authorization endpoint
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            ClientID
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenSet is a successful token endpoint response
+type TokenSet struct {
+	AccessToken  string
+	IDToken      string
+	RefreshToken string
+	ExpiresAt    time.Time
+	Scope        string
+}
+
+// Error codes are defined by RFC 6749, they are returned to the client as is
+var (
+	ErrInvalidRequest          = errors.New("invalid_request")
+	ErrInvalidClient           = errors.New("invalid_client")
+	ErrInvalidGrant            = errors.New("invalid_grant")
+	ErrUnsupportedGrantType    = errors.New("unsupported_grant_type")
+	ErrUnsupportedResponseType = errors.New("unsupported_response_type")
+	ErrInvalidScope            = errors.New("invalid_scope")
+	ErrAccessDenied            = errors.New("access_denied")
+)
+
+var ErrClientNotFound = errors.New("client not found")
+var ErrInvalidClientInfo = errors.New("client name and absolute redirect uris are required")
+
+// ErrInvalidRedirectURI is not sent to the redirect uri, otherwise codes could leak to attacker's site
+var ErrInvalidRedirectURI = errors.New("invalid redirect uri")
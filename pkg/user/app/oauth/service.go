@@ -0,0 +1,323 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/jwt"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/token"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const (
+	codeSize                = 32
+	clientSecretSize        = 32
+	CodeChallengeMethodS256 = "S256"
+	ResponseTypeCode        = "code"
+
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// RFC 7636 limits code verifier length
+const (
+	minCodeVerifierLength = 43
+	maxCodeVerifierLength = 128
+)
+
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+func NewService(
+	clients ClientRepository,
+	codes CodeRepository,
+	users *user.Service,
+	sessions *session.Service,
+	tokens *token.Service,
+	codeTTL time.Duration,
+) *Service {
+	return &Service{clients, codes, users, sessions, tokens, codeTTL}
+}
+
+type Service struct {
+	clients  ClientRepository
+	codes    CodeRepository
+	users    *user.Service
+	sessions *session.Service
+	tokens   *token.Service
+	codeTTL  time.Duration
+}
+
+// ValidateAuthorizationRequest must pass before the user is asked to log in.
+// ErrInvalidClient and ErrInvalidRedirectURI must be shown to the user, other errors are sent to the redirect uri
+func (s *Service) ValidateAuthorizationRequest(req AuthorizationRequest) (*Client, error) {
+	client, err := s.clients.Find(req.ClientID)
+	if err == ErrClientNotFound {
+		return nil, ErrInvalidClient
+	} else if err != nil {
+		return nil, err
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return client, ErrUnsupportedResponseType
+	}
+	// PKCE is required for all clients, it protects confidential clients from code injection too
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != CodeChallengeMethodS256 {
+		return client, ErrInvalidRequest
+	}
+	for _, scope := range strings.Fields(req.Scope) {
+		if !supportedScope(scope) {
+			return client, ErrInvalidScope
+		}
+	}
+	return client, nil
+}
+
+// IssueCode is called after the user is authenticated, request must be validated before
+func (s *Service) IssueCode(req AuthorizationRequest, userID user.ID) (string, error) {
+	secret := make([]byte, codeSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(secret)
+	err := s.codes.Store(&AuthorizationCode{
+		Hash:          hash(code),
+		ClientID:      req.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		ExpiresAt:     time.Now().Add(s.codeTTL),
+	})
+	return code, err
+}
+
+// ExchangeCode implements authorization_code grant, tokens are backed by a regular session,
+// so the user sees and can revoke it with other sessions
+func (s *Service) ExchangeCode(clientID ClientID, clientSecret, code, redirectURI, codeVerifier string, device session.Client) (*TokenSet, error) {
+	client, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizationCode, err := s.codes.Take(hash(code))
+	if err != nil {
+		return nil, err
+	}
+	if authorizationCode.Expired(time.Now()) ||
+		authorizationCode.ClientID != client.ID ||
+		authorizationCode.RedirectURI != redirectURI ||
+		!verifyCodeChallenge(authorizationCode.CodeChallenge, codeVerifier) {
+		return nil, ErrInvalidGrant
+	}
+
+	u, err := s.users.ReadUser(authorizationCode.UserID)
+	if err == user.ErrUserNotFound {
+		return nil, ErrInvalidGrant
+	} else if err != nil {
+		return nil, err
+	}
+
+	device.OAuthClientID = string(client.ID)
+	device.OAuthScope = authorizationCode.Scope
+	userSession, refreshToken, err := s.sessions.Start(u, device)
+	if err != nil {
+		return nil, err
+	}
+	tokenSet, err := s.issueTokens(client, userSession, authorizationCode.Scope)
+	if err != nil {
+		return nil, err
+	}
+	if hasScope(authorizationCode.Scope, ScopeOpenID) {
+		tokenSet.IDToken, err = s.tokens.IssueIDToken(idTokenClaims(client, userSession, authorizationCode.Scope, authorizationCode.Nonce))
+		if err != nil {
+			return nil, err
+		}
+	}
+	tokenSet.RefreshToken = refreshToken
+	return tokenSet, nil
+}
+
+// Refresh implements refresh_token grant with the same rotation as browser sessions
+func (s *Service) Refresh(clientID ClientID, clientSecret, refreshToken string) (*TokenSet, error) {
+	client, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	userSession, newRefreshToken, err := s.sessions.Refresh(refreshToken, string(client.ID))
+	switch err {
+	case nil:
+	case session.ErrSessionNotFound, session.ErrInvalidRefreshToken, session.ErrRefreshTokenReused, session.ErrWrongClient:
+		return nil, ErrInvalidGrant
+	default:
+		return nil, err
+	}
+
+	tokenSet, err := s.issueTokens(client, userSession, userSession.OAuthScope)
+	if err != nil {
+		return nil, err
+	}
+	tokenSet.RefreshToken = newRefreshToken
+	return tokenSet, nil
+}
+
+// UserInfo returns claims about the user of the access token allowed by its scope.
+// Tokens of browser sessions have no scope and get all claims
+func (s *Service) UserInfo(accessToken string) (jwt.Claims, error) {
+	claims, err := s.tokens.VerifyAccessToken(accessToken)
+	if err != nil {
+		return jwt.Claims{}, err
+	}
+	u, err := s.users.ReadUser(user.ID(claims.Subject))
+	if err != nil {
+		return jwt.Claims{}, err
+	}
+
+	scope := claims.Scope
+	if scope == "" {
+		scope = strings.Join(SupportedScopes, " ")
+	}
+	return ScopedClaims(jwt.Claims{
+		Subject:       string(u.ID),
+		Login:         u.Username,
+		Email:         string(u.Email),
+		EmailVerified: u.EmailVerified,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+	}, scope), nil
+}
+
+// CreateClient registers a new application, secret of confidential client is returned once and it is not stored
+func (s *Service) CreateClient(name string, redirectURIs []string, confidential bool) (*Client, string, error) {
+	if strings.TrimSpace(name) == "" || len(redirectURIs) == 0 {
+		return nil, "", ErrInvalidClientInfo
+	}
+	for _, redirectURI := range redirectURIs {
+		// redirect uris are stored space separated
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" || strings.ContainsAny(redirectURI, " \t\n") {
+			return nil, "", ErrInvalidClientInfo
+		}
+	}
+
+	id, err := s.clients.NextID()
+	if err != nil {
+		return nil, "", err
+	}
+	var secret string
+	if confidential {
+		b := make([]byte, clientSecretSize)
+		if _, err = rand.Read(b); err != nil {
+			return nil, "", err
+		}
+		secret = base64.RawURLEncoding.EncodeToString(b)
+	}
+	client := &Client{ID: id, Name: strings.TrimSpace(name), RedirectURIs: redirectURIs}
+	return client, secret, s.RegisterClient(client, secret)
+}
+
+func (s *Service) RegisterClient(client *Client, secret string) error {
+	if secret != "" {
+		client.SecretHash = hash(secret)
+	}
+	return s.clients.Store(client)
+}
+
+func (s *Service) authenticateClient(clientID ClientID, clientSecret string) (*Client, error) {
+	client, err := s.clients.Find(clientID)
+	if err == ErrClientNotFound {
+		return nil, ErrInvalidClient
+	} else if err != nil {
+		return nil, err
+	}
+
+	if client.Public() {
+		if clientSecret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+func (s *Service) issueTokens(client *Client, userSession *session.Session, scope string) (*TokenSet, error) {
+	// other services trust access token claims, so the token carries only what the user consented to
+	claims := ScopedClaims(token.SessionClaims(userSession), scope)
+	claims.Audience = string(client.ID)
+	claims.Scope = scope
+	accessToken, expiresAt, err := s.tokens.IssueAccessToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenSet{AccessToken: accessToken, ExpiresAt: expiresAt, Scope: scope}, nil
+}
+
+func idTokenClaims(client *Client, userSession *session.Session, scope, nonce string) jwt.Claims {
+	claims := ScopedClaims(token.SessionClaims(userSession), scope)
+	claims.Audience = string(client.ID)
+	claims.Nonce = nonce
+	return claims
+}
+
+// ScopedClaims keeps only claims allowed by the scope.
+// None of the scopes grants roles, client apps act with permissions of a regular user
+func ScopedClaims(claims jwt.Claims, scope string) jwt.Claims {
+	result := jwt.Claims{Subject: claims.Subject}
+	if hasScope(scope, ScopeProfile) {
+		result.Login = claims.Login
+		result.FirstName = claims.FirstName
+		result.LastName = claims.LastName
+	}
+	if hasScope(scope, ScopeEmail) {
+		result.Email = claims.Email
+		result.EmailVerified = claims.EmailVerified
+	}
+	return result
+}
+
+func verifyCodeChallenge(codeChallenge, codeVerifier string) bool {
+	if len(codeVerifier) < minCodeVerifierLength || len(codeVerifier) > maxCodeVerifierLength {
+		return false
+	}
+	digest := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(digest[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
+
+func supportedScope(scope string) bool {
+	for _, supported := range SupportedScopes {
+		if scope == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func hasScope(scope, expected string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
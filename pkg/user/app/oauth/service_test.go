@@ -0,0 +1,223 @@
+package oauth_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/oauth"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/token"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user/usertest"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+const (
+	redirectURI  = "app://callback"
+	codeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func TestOAuthService_AuthorizationCodeFlow(t *testing.T) {
+	service, tokens, userID := newService(t)
+	assert.Nil(t, service.RegisterClient(&oauth.Client{ID: "mobile", Name: "Mobile", RedirectURIs: []string{redirectURI}}, ""))
+
+	req := authorizationRequest("mobile")
+	_, err := service.ValidateAuthorizationRequest(req)
+	assert.Nil(t, err)
+
+	code, err := service.IssueCode(req, userID)
+	assert.Nil(t, err)
+
+	_, err = service.ExchangeCode("mobile", "", code, redirectURI, "wrong-verifier-wrong-verifier-wrong-verifier", session.Client{})
+	assert.Equal(t, oauth.ErrInvalidGrant, err)
+
+	code, err = service.IssueCode(req, userID)
+	assert.Nil(t, err)
+	tokenSet, err := service.ExchangeCode("mobile", "", code, redirectURI, codeVerifier, session.Client{})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokenSet.IDToken)
+	assert.NotEmpty(t, tokenSet.RefreshToken)
+
+	claims, err := tokens.VerifyAccessToken(tokenSet.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, string(userID), claims.Subject)
+
+	// code is single-use
+	_, err = service.ExchangeCode("mobile", "", code, redirectURI, codeVerifier, session.Client{})
+	assert.Equal(t, oauth.ErrInvalidGrant, err)
+
+	info, err := service.UserInfo(tokenSet.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "username", info.Login)
+	assert.Empty(t, info.Email)
+}
+
+func TestOAuthService_CreateClient(t *testing.T) {
+	service, _, userID := newService(t)
+
+	for _, redirectURIs := range [][]string{nil, {"/callback"}, {"https://app.example.com/cb#fragment"}, {"https://app.example.com/a b"}} {
+		_, _, err := service.CreateClient("Web", redirectURIs, true)
+		assert.Equal(t, oauth.ErrInvalidClientInfo, err, redirectURIs)
+	}
+	_, _, err := service.CreateClient(" ", []string{redirectURI}, true)
+	assert.Equal(t, oauth.ErrInvalidClientInfo, err)
+
+	public, secret, err := service.CreateClient("Mobile", []string{redirectURI}, false)
+	assert.Nil(t, err)
+	assert.Empty(t, secret)
+	assert.True(t, public.Public())
+
+	client, secret, err := service.CreateClient("Web", []string{redirectURI}, true)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, secret)
+	assert.NotEqual(t, public.ID, client.ID)
+
+	req := authorizationRequest(client.ID)
+	_, err = service.ValidateAuthorizationRequest(req)
+	assert.Nil(t, err)
+	code, err := service.IssueCode(req, userID)
+	assert.Nil(t, err)
+	_, err = service.ExchangeCode(client.ID, "wrong secret", code, redirectURI, codeVerifier, session.Client{})
+	assert.Equal(t, oauth.ErrInvalidClient, err)
+	code, err = service.IssueCode(req, userID)
+	assert.Nil(t, err)
+	_, err = service.ExchangeCode(client.ID, secret, code, redirectURI, codeVerifier, session.Client{})
+	assert.Nil(t, err)
+}
+
+func TestOAuthService_ValidateAuthorizationRequest(t *testing.T) {
+	service, _, _ := newService(t)
+	assert.Nil(t, service.RegisterClient(&oauth.Client{ID: "mobile", Name: "Mobile", RedirectURIs: []string{redirectURI}}, ""))
+
+	req := authorizationRequest("unknown")
+	_, err := service.ValidateAuthorizationRequest(req)
+	assert.Equal(t, oauth.ErrInvalidClient, err)
+
+	req = authorizationRequest("mobile")
+	req.RedirectURI = "https://evil.example/callback"
+	_, err = service.ValidateAuthorizationRequest(req)
+	assert.Equal(t, oauth.ErrInvalidRedirectURI, err)
+
+	req = authorizationRequest("mobile")
+	req.CodeChallengeMethod = "plain"
+	_, err = service.ValidateAuthorizationRequest(req)
+	assert.Equal(t, oauth.ErrInvalidRequest, err)
+
+	req = authorizationRequest("mobile")
+	req.Scope = "openid admin"
+	_, err = service.ValidateAuthorizationRequest(req)
+	assert.Equal(t, oauth.ErrInvalidScope, err)
+}
+
+func TestOAuthService_RefreshIsBoundToClient(t *testing.T) {
+	service, _, userID := newService(t)
+	assert.Nil(t, service.RegisterClient(&oauth.Client{ID: "mobile", Name: "Mobile", RedirectURIs: []string{redirectURI}}, ""))
+	assert.Nil(t, service.RegisterClient(&oauth.Client{ID: "partner", Name: "Partner", RedirectURIs: []string{redirectURI}}, "secret"))
+
+	code, err := service.IssueCode(authorizationRequest("mobile"), userID)
+	assert.Nil(t, err)
+	tokenSet, err := service.ExchangeCode("mobile", "", code, redirectURI, codeVerifier, session.Client{})
+	assert.Nil(t, err)
+
+	refreshed, err := service.Refresh("mobile", "", tokenSet.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEqual(t, tokenSet.RefreshToken, refreshed.RefreshToken)
+
+	_, err = service.Refresh("partner", "wrong", refreshed.RefreshToken)
+	assert.Equal(t, oauth.ErrInvalidClient, err)
+
+	_, err = service.Refresh("partner", "secret", refreshed.RefreshToken)
+	assert.Equal(t, oauth.ErrInvalidGrant, err)
+	// the token is not rotated for other client, so its owner can still use it
+	_, err = service.Refresh("mobile", "", refreshed.RefreshToken)
+	assert.Nil(t, err)
+}
+
+func TestOAuthService_RefreshKeepsGrantedScope(t *testing.T) {
+	service, tokens, users, userID := newServiceWithUsers(t)
+	assert.Nil(t, service.RegisterClient(&oauth.Client{ID: "mobile", Name: "Mobile", RedirectURIs: []string{redirectURI}}, ""))
+	_, err := users.SetRoles(user.Actor{}, userID, []user.Role{"admin"})
+	assert.Nil(t, err)
+
+	code, err := service.IssueCode(authorizationRequest("mobile"), userID)
+	assert.Nil(t, err)
+	tokenSet, err := service.ExchangeCode("mobile", "", code, redirectURI, codeVerifier, session.Client{})
+	assert.Nil(t, err)
+
+	refreshed, err := service.Refresh("mobile", "", tokenSet.RefreshToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "openid profile", refreshed.Scope)
+
+	claims, err := tokens.VerifyAccessToken(refreshed.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, "openid profile", claims.Scope)
+	assert.Equal(t, "username", claims.Login)
+	assert.Empty(t, claims.Email, "email scope is not granted")
+	assert.Empty(t, claims.Roles, "scopes don't grant roles")
+
+	info, err := service.UserInfo(refreshed.AccessToken)
+	assert.Nil(t, err)
+	assert.Empty(t, info.Email)
+}
+
+func newService(t *testing.T) (*oauth.Service, *token.Service, user.ID) {
+	service, tokens, _, userID := newServiceWithUsers(t)
+	return service, tokens, userID
+}
+
+func newServiceWithUsers(t *testing.T) (*oauth.Service, *token.Service, *user.Service, user.ID) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	sessions := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+	tokens := token.NewService(&mockKeyRepo{}, "issuer", time.Minute, time.Hour)
+	service := oauth.NewService(memory.NewOAuthClientRepository(), memory.NewAuthorizationCodeRepository(), users, sessions, tokens, time.Minute)
+
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	return service, tokens, users, userID
+}
+
+func authorizationRequest(clientID oauth.ClientID) oauth.AuthorizationRequest {
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	return oauth.AuthorizationRequest{
+		ResponseType:        oauth.ResponseTypeCode,
+		ClientID:            clientID,
+		RedirectURI:         redirectURI,
+		Scope:               strings.Join([]string{oauth.ScopeOpenID, oauth.ScopeProfile}, " "),
+		State:               "state",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		CodeChallengeMethod: oauth.CodeChallengeMethodS256,
+	}
+}
+
+type mockKeyRepo struct {
+	keys []token.SigningKey
+}
+
+func (repo *mockKeyRepo) FindAll() ([]token.SigningKey, error) {
+	return append([]token.SigningKey(nil), repo.keys...), nil
+}
+
+func (repo *mockKeyRepo) Store(key *token.SigningKey) error {
+	repo.keys = append(repo.keys, *key)
+	return nil
+}
+
+func (repo *mockKeyRepo) Remove(id token.KeyID) error {
+	for i, key := range repo.keys {
+		if key.ID == id {
+			repo.keys = append(repo.keys[:i], repo.keys[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (repo *mockKeyRepo) NextID() (token.KeyID, error) {
+	return token.KeyID(uuid.New().String()), nil
+}
@@ -0,0 +1,28 @@
+package reset
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// Token allows to set a new password once, only hash of the token is stored
+type Token struct {
+	Hash      string
+	UserID    user.ID
+	ExpiresAt time.Time
+}
+
+func (t Token) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+type Repository interface {
+	Store(*Token) error
+	// Take removes token and returns it, so concurrent requests can't use the same token twice
+	Take(hash string) (*Token, error)
+	RemoveByUserID(user.ID) error
+}
+
+var ErrInvalidToken = errors.New("invalid or expired password reset token")
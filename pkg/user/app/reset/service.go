@@ -0,0 +1,84 @@
+package reset
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const tokenSize = 32
+
+func NewService(repo Repository, users *user.Service, sessions *session.Service, notifier user.Notifier, tokenTTL time.Duration) *Service {
+	return &Service{repo, users, sessions, notifier, tokenTTL}
+}
+
+type Service struct {
+	repo     Repository
+	users    *user.Service
+	sessions *session.Service
+	notifier user.Notifier
+	tokenTTL time.Duration
+}
+
+// RequestReset sends reset token to the user. Unknown username is not reported,
+// otherwise the endpoint could be used to find out registered usernames
+func (s *Service) RequestReset(username string) error {
+	u, err := s.users.FindByUsername(username)
+	if err == user.ErrUserNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	secret := make([]byte, tokenSize)
+	if _, err = rand.Read(secret); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	err = s.repo.Store(&Token{
+		Hash:      hashToken(token),
+		UserID:    u.ID,
+		ExpiresAt: time.Now().Add(s.tokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Use this token to set a new password: %s\nIt expires in %s.", token, s.tokenTTL)
+	return s.notifier.Notify(u, "Password reset", text)
+}
+
+// ConfirmReset sets a new password and logs the user out everywhere, it returns id of the user owning the token
+func (s *Service) ConfirmReset(actor user.Actor, token, newPassword string) (user.ID, error) {
+	// password is checked before the token is taken, so the user can retry with the same token
+	if newPassword == "" {
+		return "", user.ErrEmptyPassword
+	}
+	t, err := s.repo.Take(hashToken(token))
+	if err != nil {
+		return "", err
+	}
+	if t.Expired(time.Now()) {
+		return "", ErrInvalidToken
+	}
+
+	if err = s.users.SetPassword(actor, t.UserID, newPassword); err != nil {
+		return "", err
+	}
+	// other tokens are requested before the reset, they must not allow to reset password again
+	if err = s.repo.RemoveByUserID(t.UserID); err != nil {
+		return "", err
+	}
+	return t.UserID, s.sessions.RevokeUserSessions(t.UserID)
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,72 @@
+package reset_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/reset"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user/usertest"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestResetService_ConfirmReset(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	sessions := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+	notifier := &usertest.Notifier{}
+	service := reset.NewService(memory.NewResetTokenRepository(), users, sessions, notifier, time.Hour)
+
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	u, err := users.ReadUser(userID)
+	assert.Nil(t, err)
+	s, _, err := sessions.Start(u, session.Client{})
+	assert.Nil(t, err)
+
+	assert.Nil(t, service.RequestReset("username"))
+	token := notifier.Token()
+	assert.NotEmpty(t, token)
+
+	_, err = service.ConfirmReset(user.Actor{}, token, "")
+	assert.Equal(t, user.ErrEmptyPassword, err)
+	_, err = service.ConfirmReset(user.Actor{}, "invalid", "new pass")
+	assert.Equal(t, reset.ErrInvalidToken, err)
+	resetUserID, err := service.ConfirmReset(user.Actor{}, token, "new pass")
+	assert.Nil(t, err)
+	assert.Equal(t, userID, resetUserID)
+	_, err = users.Authenticate("username", "new pass")
+	assert.Nil(t, err)
+	_, err = sessions.Find(s.ID)
+	assert.Equal(t, session.ErrSessionNotFound, err)
+
+	_, err = service.ConfirmReset(user.Actor{}, token, "other pass")
+	assert.Equal(t, reset.ErrInvalidToken, err)
+}
+
+func TestResetService_ExpiredToken(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	sessions := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+	notifier := &usertest.Notifier{}
+	service := reset.NewService(memory.NewResetTokenRepository(), users, sessions, notifier, time.Millisecond)
+
+	_, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	assert.Nil(t, service.RequestReset("username"))
+
+	time.Sleep(2 * time.Millisecond)
+	_, err = service.ConfirmReset(user.Actor{}, notifier.Token(), "new pass")
+	assert.Equal(t, reset.ErrInvalidToken, err)
+}
+
+func TestResetService_UnknownUsernameIsNotReported(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	sessions := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+	notifier := &usertest.Notifier{}
+	service := reset.NewService(memory.NewResetTokenRepository(), users, sessions, notifier, time.Hour)
+
+	assert.Nil(t, service.RequestReset("unknown"))
+	assert.Empty(t, notifier.Texts)
+}
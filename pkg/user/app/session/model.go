@@ -0,0 +1,87 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+type ID string
+
+type Session struct {
+	ID     ID
+	UserID user.ID
+	Login  string
+	Email  string
+	// EmailVerified restricts unverified users in other services
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Roles         []user.Role
+	// RefreshTokenID is random and stays the same on rotation, so reuse of rotated token is detected
+	RefreshTokenID string
+	// RefreshTokenHash belongs to the only refresh token which is not used yet
+	RefreshTokenHash string
+	// RefreshExpiresAt doesn't depend on idle expiration, refresh token renews idle session until the max lifetime
+	RefreshExpiresAt time.Time
+	UserAgent        string
+	IP               string
+	// OAuthClientID is set for sessions started by OAuth client apps, refresh token is bound to the client
+	OAuthClientID string
+	// OAuthScope is granted to the client by the user, tokens issued on refresh don't exceed it
+	OAuthScope string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// ExpiresAt slides forward while session is in use
+	ExpiresAt time.Time
+}
+
+// Client describes device which started the session
+type Client struct {
+	UserAgent     string
+	IP            string
+	OAuthClientID string
+	OAuthScope    string
+}
+
+// Handle identifies the session in the api, the id is the session cookie value and must not be shown
+func (s Session) Handle() string {
+	sum := sha256.Sum256([]byte(s.ID))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// RefreshExpired means the session can't be renewed anymore and may be removed from storage
+func (s Session) RefreshExpired(now time.Time) bool {
+	return !now.Before(s.RefreshExpiresAt)
+}
+
+// Repository is shared between all service replicas. Sessions are kept until refresh token expires,
+// idle expiration is checked by the service
+type Repository interface {
+	// Store saves new session, stored sessions are changed by Update and RotateRefreshToken only
+	Store(*Session) error
+	// Update changes user data and expiration of the session, refresh token is kept.
+	// Removed session is not stored again, ErrSessionNotFound is returned for it, so renewal can't undo revocation
+	Update(*Session) error
+	Find(ID) (*Session, error)
+	FindByRefreshTokenID(string) (*Session, error)
+	// RotateRefreshToken replaces the hash and renews the session only if the hash is still oldHash,
+	// otherwise ErrRefreshTokenReused is returned, so concurrent refreshes with the same token can't both succeed
+	RotateRefreshToken(tokenID, oldHash, newHash string, lastSeenAt, expiresAt time.Time) error
+	FindByUserID(user.ID) ([]Session, error)
+	Remove(ID) error
+	RemoveByUserID(user.ID) error
+	NextID() (ID, error)
+}
+
+var ErrSessionNotFound = errors.New("session not found")
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+var ErrRefreshTokenReused = errors.New("refresh token is already used")
+var ErrWrongClient = errors.New("refresh token belongs to another client")
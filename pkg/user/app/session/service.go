@@ -0,0 +1,249 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const (
+	refreshTokenIDSize    = 16
+	refreshTokenSize      = 32
+	refreshTokenSeparator = "."
+	// renewalStep limits storage writes, session is not renewed more often than once per step
+	renewalStep = time.Minute
+)
+
+// NewService creates sessions expiring after idleTTL without use, but living no longer than maxTTL
+func NewService(repo Repository, idleTTL, maxTTL time.Duration) *Service {
+	return &Service{repo, idleTTL, maxTTL}
+}
+
+type Service struct {
+	repo    Repository
+	idleTTL time.Duration
+	maxTTL  time.Duration
+}
+
+// Start creates session and returns refresh token for it
+func (s *Service) Start(u *user.User, client Client) (*Session, string, error) {
+	id, err := s.repo.NextID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:            id,
+		UserID:        u.ID,
+		Login:         u.Username,
+		Email:         string(u.Email),
+		EmailVerified: u.EmailVerified,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Roles:         u.Roles,
+		UserAgent:     client.UserAgent,
+		IP:            client.IP,
+		OAuthClientID: client.OAuthClientID,
+		OAuthScope:    client.OAuthScope,
+		CreatedAt:     now,
+		LastSeenAt:    now,
+	}
+	session.ExpiresAt = s.expiresAt(session, now)
+	session.RefreshExpiresAt = s.MaxExpiresAt(session)
+	session.RefreshTokenID, err = randomString(refreshTokenIDSize)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomString(refreshTokenSize)
+	if err != nil {
+		return nil, "", err
+	}
+	session.RefreshTokenHash = hashRefreshSecret(secret)
+	return session, refreshToken(session, secret), s.repo.Store(session)
+}
+
+func (s *Service) Find(id ID) (*Session, error) {
+	session, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Expired(time.Now()) {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// Renew finds session and slides its expiration, so active users are not logged out
+func (s *Service) Renew(id ID) (*Session, error) {
+	session, err := s.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if expiresAt := s.expiresAt(session, now); expiresAt.Sub(session.ExpiresAt) >= renewalStep {
+		session.ExpiresAt = expiresAt
+		session.LastSeenAt = now
+		err = s.repo.Update(session)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Refresh exchanges refresh token for a new one and renews the session even after idle expiration.
+// Refresh token is single-use, presenting already used token means it was stolen, so the whole session is revoked.
+// oauthClientID is empty for browser sessions, token of another client is rejected before rotation, so it stays usable by its owner
+func (s *Service) Refresh(token, oauthClientID string) (*Session, string, error) {
+	parts := strings.SplitN(token, refreshTokenSeparator, 2)
+	if len(parts) != 2 {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	session, err := s.repo.FindByRefreshTokenID(parts[0])
+	if err != nil {
+		return nil, "", err
+	}
+	if session.OAuthClientID != oauthClientID {
+		return nil, "", ErrWrongClient
+	}
+	now := time.Now()
+	if session.RefreshExpired(now) {
+		return nil, "", ErrSessionNotFound
+	}
+	oldHash := hashRefreshSecret(parts[1])
+	if subtle.ConstantTimeCompare([]byte(oldHash), []byte(session.RefreshTokenHash)) != 1 {
+		return nil, "", s.revokeReused(session.ID)
+	}
+
+	secret, err := randomString(refreshTokenSize)
+	if err != nil {
+		return nil, "", err
+	}
+	newHash := hashRefreshSecret(secret)
+	expiresAt := s.expiresAt(session, now)
+	switch err = s.repo.RotateRefreshToken(session.RefreshTokenID, oldHash, newHash, now, expiresAt); err {
+	case nil:
+	case ErrRefreshTokenReused:
+		// concurrent refresh has already used the token
+		return nil, "", s.revokeReused(session.ID)
+	default:
+		return nil, "", err
+	}
+	session.RefreshTokenHash = newHash
+	session.ExpiresAt = expiresAt
+	session.LastSeenAt = now
+	return session, refreshToken(session, secret), nil
+}
+
+func (s *Service) revokeReused(id ID) error {
+	if err := s.repo.Remove(id); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func (s *Service) Revoke(id ID) error {
+	return s.repo.Remove(id)
+}
+
+// UserSessions returns active sessions of the user, the most recently used first
+func (s *Service) UserSessions(userID user.ID) ([]Session, error) {
+	sessions, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		if !session.Expired(now) {
+			result = append(result, session)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeenAt.After(result[j].LastSeenAt)
+	})
+	return result, nil
+}
+
+// RevokeUserSession revokes session of the user by its handle, sessions of other users are not found
+func (s *Service) RevokeUserSession(userID user.ID, handle string) error {
+	sessions, err := s.UserSessions(userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.Handle() == handle {
+			return s.repo.Remove(session.ID)
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (s *Service) RevokeUserSessions(userID user.ID) error {
+	return s.repo.RemoveByUserID(userID)
+}
+
+// UpdateUser copies changed user data to active sessions, so it is visible without login
+func (s *Service) UpdateUser(u *user.User) error {
+	sessions, err := s.repo.FindByUserID(u.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range sessions {
+		session := &sessions[i]
+		session.Login = u.Username
+		session.Email = string(u.Email)
+		session.EmailVerified = u.EmailVerified
+		session.FirstName = u.FirstName
+		session.LastName = u.LastName
+		session.Roles = u.Roles
+		// session revoked meanwhile stays removed
+		if err = s.repo.Update(session); err != nil && err != ErrSessionNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaxExpiresAt is the moment after which session can't be renewed
+func (s *Service) MaxExpiresAt(session *Session) time.Time {
+	return session.CreatedAt.Add(s.maxTTL)
+}
+
+func (s *Service) expiresAt(session *Session, now time.Time) time.Time {
+	expiresAt := now.Add(s.idleTTL)
+	if maxExpiresAt := s.MaxExpiresAt(session); expiresAt.After(maxExpiresAt) {
+		return maxExpiresAt
+	}
+	return expiresAt
+}
+
+// refreshToken doesn't contain session id, the id is the session cookie value
+func refreshToken(session *Session, secret string) string {
+	return session.RefreshTokenID + refreshTokenSeparator + secret
+}
+
+func randomString(size int) (string, error) {
+	value := make([]byte, size)
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
+
+func hashRefreshSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,197 @@
+package session_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestSessionService_StartAndRevoke(t *testing.T) {
+	service := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+
+	s, _, err := service.Start(&user.User{ID: "1", Username: "username"}, session.Client{})
+	assert.Nil(t, err)
+	assert.Equal(t, user.ID("1"), s.UserID)
+
+	found, err := service.Find(s.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "username", found.Login)
+
+	assert.Nil(t, service.Revoke(s.ID))
+	_, err = service.Find(s.ID)
+	assert.Equal(t, session.ErrSessionNotFound, err)
+}
+
+func TestSessionService_Expiry(t *testing.T) {
+	service := session.NewService(memory.NewSessionRepository(), time.Millisecond, time.Hour)
+
+	s, _, err := service.Start(&user.User{ID: "1", Username: "username"}, session.Client{})
+	assert.Nil(t, err)
+
+	time.Sleep(2 * time.Millisecond)
+	_, err = service.Find(s.ID)
+	assert.Equal(t, session.ErrSessionNotFound, err)
+}
+
+func TestSessionService_RenewIsLimitedByMaxTTL(t *testing.T) {
+	service := session.NewService(memory.NewSessionRepository(), time.Hour, 2*time.Hour)
+
+	s, _, err := service.Start(&user.User{ID: "1"}, session.Client{})
+	assert.Nil(t, err)
+	assert.Equal(t, s.CreatedAt.Add(time.Hour), s.ExpiresAt)
+
+	renewed, err := service.Renew(s.ID)
+	assert.Nil(t, err)
+	assert.False(t, renewed.ExpiresAt.After(service.MaxExpiresAt(s)))
+}
+
+func TestSessionService_RefreshRotatesToken(t *testing.T) {
+	service := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+
+	s, refreshToken, err := service.Start(&user.User{ID: "1"}, session.Client{})
+	assert.Nil(t, err)
+
+	refreshed, newRefreshToken, err := service.Refresh(refreshToken, "")
+	assert.Nil(t, err)
+	assert.Equal(t, s.ID, refreshed.ID)
+	assert.NotEqual(t, refreshToken, newRefreshToken)
+
+	_, newestRefreshToken, err := service.Refresh(newRefreshToken, "")
+	assert.Nil(t, err)
+	assert.NotEqual(t, newRefreshToken, newestRefreshToken)
+
+	_, _, err = service.Refresh("invalid", "")
+	assert.Equal(t, session.ErrInvalidRefreshToken, err)
+}
+
+func TestSessionService_RefreshTokenReuseRevokesSession(t *testing.T) {
+	service := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+
+	s, refreshToken, err := service.Start(&user.User{ID: "1"}, session.Client{})
+	assert.Nil(t, err)
+	_, newRefreshToken, err := service.Refresh(refreshToken, "")
+	assert.Nil(t, err)
+
+	_, _, err = service.Refresh(refreshToken, "")
+	assert.Equal(t, session.ErrRefreshTokenReused, err)
+
+	_, err = service.Find(s.ID)
+	assert.Equal(t, session.ErrSessionNotFound, err)
+	_, _, err = service.Refresh(newRefreshToken, "")
+	assert.Equal(t, session.ErrSessionNotFound, err)
+}
+
+func TestSessionService_RefreshIsBoundToClient(t *testing.T) {
+	service := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+
+	_, refreshToken, err := service.Start(&user.User{ID: "1"}, session.Client{OAuthClientID: "mobile"})
+	assert.Nil(t, err)
+
+	_, _, err = service.Refresh(refreshToken, "")
+	assert.Equal(t, session.ErrWrongClient, err)
+	_, _, err = service.Refresh(refreshToken, "partner")
+	assert.Equal(t, session.ErrWrongClient, err)
+	// rejected requests don't rotate the token
+	_, _, err = service.Refresh(refreshToken, "mobile")
+	assert.Nil(t, err)
+}
+
+func TestSessionService_RefreshOutlivesIdleSession(t *testing.T) {
+	service := session.NewService(memory.NewSessionRepository(), time.Millisecond, time.Hour)
+
+	s, refreshToken, err := service.Start(&user.User{ID: "1"}, session.Client{})
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(refreshToken, string(s.ID)), "refresh token must not expose session id")
+
+	time.Sleep(2 * time.Millisecond)
+	_, err = service.Find(s.ID)
+	assert.Equal(t, session.ErrSessionNotFound, err)
+
+	refreshed, _, err := service.Refresh(refreshToken, "")
+	assert.Nil(t, err)
+	assert.Equal(t, s.ID, refreshed.ID)
+}
+
+func TestSessionService_ConcurrentRefresh(t *testing.T) {
+	service := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+
+	_, refreshToken, err := service.Start(&user.User{ID: "1"}, session.Client{})
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = service.Refresh(refreshToken, "")
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	assert.Equal(t, 1, succeeded, "refresh token is single-use")
+}
+
+func TestSessionService_UserSessions(t *testing.T) {
+	service := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+
+	first, _, err := service.Start(&user.User{ID: "1"}, session.Client{UserAgent: "curl", IP: "10.0.0.1"})
+	assert.Nil(t, err)
+	second, _, err := service.Start(&user.User{ID: "1"}, session.Client{UserAgent: "firefox", IP: "10.0.0.2"})
+	assert.Nil(t, err)
+	other, _, err := service.Start(&user.User{ID: "2"}, session.Client{})
+	assert.Nil(t, err)
+
+	sessions, err := service.UserSessions("1")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+
+	assert.Equal(t, session.ErrSessionNotFound, service.RevokeUserSession("1", other.Handle()))
+	assert.Equal(t, session.ErrSessionNotFound, service.RevokeUserSession("1", string(first.ID)), "session id is not accepted as handle")
+	assert.Nil(t, service.RevokeUserSession("1", first.Handle()))
+	sessions, err = service.UserSessions("1")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, second.ID, sessions[0].ID)
+	assert.Equal(t, "firefox", sessions[0].UserAgent)
+
+	assert.Nil(t, service.RevokeUserSessions("1"))
+	sessions, err = service.UserSessions("1")
+	assert.Nil(t, err)
+	assert.Empty(t, sessions)
+	_, err = service.Find(other.ID)
+	assert.Nil(t, err)
+}
+
+func TestSessionService_UpdateDoesNotRestoreRevokedSession(t *testing.T) {
+	repo := memory.NewSessionRepository()
+	service := session.NewService(repo, time.Minute, time.Hour)
+
+	s, refreshToken, err := service.Start(&user.User{ID: "1", Username: "username"}, session.Client{})
+	assert.Nil(t, err)
+	// renewal or profile sync has read the session before logout on another replica
+	found, err := service.Find(s.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, service.Revoke(s.ID))
+
+	found.Login = "renamed"
+	assert.Equal(t, session.ErrSessionNotFound, repo.Update(found))
+	_, err = service.Find(s.ID)
+	assert.Equal(t, session.ErrSessionNotFound, err)
+	_, _, err = service.Refresh(refreshToken, "")
+	assert.Equal(t, session.ErrSessionNotFound, err)
+	assert.Nil(t, service.UpdateUser(&user.User{ID: "1", Username: "renamed"}))
+}
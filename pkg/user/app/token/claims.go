@@ -0,0 +1,23 @@
+package token
+
+import (
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/jwt"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+)
+
+// SessionClaims describe the user of the session, other services take identity from them
+func SessionClaims(s *session.Session) jwt.Claims {
+	roles := make([]string, 0, len(s.Roles))
+	for _, role := range s.Roles {
+		roles = append(roles, string(role))
+	}
+	return jwt.Claims{
+		Subject:       string(s.UserID),
+		Login:         s.Login,
+		Email:         s.Email,
+		EmailVerified: s.EmailVerified,
+		FirstName:     s.FirstName,
+		LastName:      s.LastName,
+		Roles:         roles,
+	}
+}
@@ -0,0 +1,22 @@
+package token
+
+import (
+	"crypto/rsa"
+	"time"
+)
+
+type KeyID string
+
+type SigningKey struct {
+	ID         KeyID
+	PrivateKey *rsa.PrivateKey
+	CreatedAt  time.Time
+}
+
+// KeyRepository shares signing keys between service replicas, so any of them can publish all keys in use
+type KeyRepository interface {
+	FindAll() ([]SigningKey, error)
+	Store(*SigningKey) error
+	Remove(KeyID) error
+	NextID() (KeyID, error)
+}
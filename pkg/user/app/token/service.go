@@ -0,0 +1,177 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/jwt"
+)
+
+const (
+	keySize = 2048
+	// keysCacheTTL limits how long replica may sign with a key after another replica rotated it
+	keysCacheTTL = time.Minute
+	// keyPublishDelay covers keys cache of other replicas and key set cache of remote verifiers,
+	// they know the key before the first token signed with it
+	keyPublishDelay = 2 * keysCacheTTL
+)
+
+// NewService signs every key for rotationPeriod, the next key is published keyPublishDelay before it is used.
+// Replaced key is published until the last token signed with it is expired
+func NewService(repo KeyRepository, issuer string, accessTokenTTL, rotationPeriod time.Duration) *Service {
+	return &Service{
+		repo:           repo,
+		issuer:         issuer,
+		accessTokenTTL: accessTokenTTL,
+		rotationPeriod: rotationPeriod,
+		publishDelay:   keyPublishDelay,
+	}
+}
+
+type Service struct {
+	repo           KeyRepository
+	issuer         string
+	accessTokenTTL time.Duration
+	rotationPeriod time.Duration
+	publishDelay   time.Duration
+
+	mu       sync.Mutex
+	keys     []SigningKey
+	loadedAt time.Time
+}
+
+// IssueAccessToken fills registered claims and signs the token with the newest key
+func (s *Service) IssueAccessToken(claims jwt.Claims) (token string, expiresAt time.Time, err error) {
+	key, err := s.signingKey()
+	if err != nil {
+		return "", expiresAt, err
+	}
+
+	now := time.Now()
+	expiresAt = now.Add(s.accessTokenTTL)
+	claims.Issuer = s.issuer
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = expiresAt.Unix()
+	claims.TokenUse = jwt.AccessTokenUse
+
+	token, err = jwt.Sign(claims, jwt.SigningKey{ID: string(key.ID), PrivateKey: key.PrivateKey})
+	return token, expiresAt, err
+}
+
+// IssueIDToken signs OpenID Connect id token for the client
+func (s *Service) IssueIDToken(claims jwt.Claims) (string, error) {
+	key, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.Issuer = s.issuer
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(s.accessTokenTTL).Unix()
+	claims.TokenUse = jwt.IDTokenUse
+	return jwt.Sign(claims, jwt.SigningKey{ID: string(key.ID), PrivateKey: key.PrivateKey})
+}
+
+// VerifyAccessToken accepts only access tokens issued by this service
+func (s *Service) VerifyAccessToken(token string) (*jwt.Claims, error) {
+	claims, err := jwt.Verify(token, s, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenUse != jwt.AccessTokenUse || claims.Issuer != s.issuer {
+		return nil, jwt.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *Service) Issuer() string {
+	return s.issuer
+}
+
+func (s *Service) KeySet() (jwt.JSONWebKeySet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keySet := jwt.JSONWebKeySet{Keys: []jwt.JSONWebKey{}}
+	if err := s.load(time.Now()); err != nil {
+		return keySet, err
+	}
+	for _, key := range s.keys {
+		keySet.Keys = append(keySet.Keys, jwt.NewJSONWebKey(string(key.ID), &key.PrivateKey.PublicKey))
+	}
+	return keySet, nil
+}
+
+func (s *Service) PublicKey(keyID string) (*rsa.PublicKey, error) {
+	keySet, err := s.KeySet()
+	if err != nil {
+		return nil, err
+	}
+	return keySet.PublicKey(keyID)
+}
+
+func (s *Service) signingKey() (SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if err := s.load(now); err != nil {
+		return SigningKey{}, err
+	}
+	if len(s.keys) == 0 || now.Sub(s.keys[0].CreatedAt) >= s.rotationPeriod-s.publishDelay {
+		id, err := s.repo.NextID()
+		if err != nil {
+			return SigningKey{}, err
+		}
+		privateKey, err := rsa.GenerateKey(rand.Reader, keySize)
+		if err != nil {
+			return SigningKey{}, err
+		}
+		key := SigningKey{ID: id, PrivateKey: privateKey, CreatedAt: now}
+		if err = s.repo.Store(&key); err != nil {
+			return SigningKey{}, err
+		}
+		s.keys = append([]SigningKey{key}, s.keys...)
+	}
+
+	for _, key := range s.keys {
+		if now.Sub(key.CreatedAt) >= s.publishDelay {
+			return key, nil
+		}
+	}
+	// there is no published key on the first start, so there are no issued tokens to verify either
+	return s.keys[len(s.keys)-1], nil
+}
+
+// load refreshes cached keys newest first and removes keys which can't verify any issued token.
+// Key is used for signing until the next key is published, then tokens signed with it live for accessTokenTTL
+func (s *Service) load(now time.Time) error {
+	if now.Sub(s.loadedAt) < keysCacheTTL {
+		return nil
+	}
+
+	keys, err := s.repo.FindAll()
+	if err != nil {
+		return err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	s.keys = s.keys[:0]
+	for i, key := range keys {
+		if i > 0 && now.Sub(keys[i-1].CreatedAt) > s.publishDelay+s.accessTokenTTL {
+			if err = s.repo.Remove(key.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		s.keys = append(s.keys, key)
+	}
+	s.loadedAt = now
+	return nil
+}
@@ -0,0 +1,110 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/jwt"
+)
+
+func TestTokenService_IssueAccessToken(t *testing.T) {
+	service := NewService(&mockKeyRepo{}, "issuer", time.Minute, time.Hour)
+
+	token, expiresAt, err := service.IssueAccessToken(jwt.Claims{Subject: "user", Login: "username"})
+	assert.Nil(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+
+	claims, err := jwt.Verify(token, service, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, "user", claims.Subject)
+	assert.Equal(t, "username", claims.Login)
+	assert.Equal(t, "issuer", claims.Issuer)
+	assert.Equal(t, jwt.AccessTokenUse, claims.TokenUse)
+
+	_, err = jwt.Verify(token, service, time.Now().Add(time.Hour))
+	assert.Equal(t, jwt.ErrExpiredToken, err)
+
+	_, err = jwt.Verify(token+"x", service, time.Now())
+	assert.Equal(t, jwt.ErrInvalidToken, err)
+}
+
+func TestTokenService_KeyRotation(t *testing.T) {
+	repo := &mockKeyRepo{}
+	service := NewService(repo, "issuer", time.Minute, time.Millisecond)
+	service.publishDelay = 0
+
+	oldToken, _, err := service.IssueAccessToken(jwt.Claims{Subject: "user"})
+	assert.Nil(t, err)
+	time.Sleep(2 * time.Millisecond)
+	newToken, _, err := service.IssueAccessToken(jwt.Claims{Subject: "user"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(repo.keys))
+	keySet, err := service.KeySet()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(keySet.Keys))
+
+	_, err = jwt.Verify(oldToken, keySet, time.Now())
+	assert.Nil(t, err)
+	_, err = jwt.Verify(newToken, keySet, time.Now())
+	assert.Nil(t, err)
+}
+
+func TestTokenService_NextKeyIsPublishedBeforeUse(t *testing.T) {
+	current, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+	repo := &mockKeyRepo{keys: []SigningKey{{ID: "current", PrivateKey: current, CreatedAt: time.Now().Add(-59 * time.Minute)}}}
+	service := NewService(repo, "issuer", time.Minute, time.Hour)
+
+	// the current key is about to expire, the next one is created but not used yet
+	token, _, err := service.IssueAccessToken(jwt.Claims{Subject: "user"})
+	assert.Nil(t, err)
+	assert.Len(t, repo.keys, 2)
+	keySet, err := service.KeySet()
+	assert.Nil(t, err)
+	assert.Len(t, keySet.Keys, 2)
+	currentKeySet := jwt.JSONWebKeySet{Keys: []jwt.JSONWebKey{jwt.NewJSONWebKey("current", &current.PublicKey)}}
+	_, err = jwt.Verify(token, currentKeySet, time.Now())
+	assert.Nil(t, err)
+
+	// caches of other replicas have expired, the next key is used
+	repo.keys[1].CreatedAt = time.Now().Add(-keyPublishDelay)
+	service.loadedAt = time.Time{}
+	token, _, err = service.IssueAccessToken(jwt.Claims{Subject: "user"})
+	assert.Nil(t, err)
+	_, err = jwt.Verify(token, currentKeySet, time.Now())
+	assert.Equal(t, jwt.ErrUnknownKey, err)
+	assert.Len(t, repo.keys, 2, "tokens signed with the previous key are not expired yet")
+}
+
+type mockKeyRepo struct {
+	keys []SigningKey
+}
+
+func (repo *mockKeyRepo) FindAll() ([]SigningKey, error) {
+	return append([]SigningKey(nil), repo.keys...), nil
+}
+
+func (repo *mockKeyRepo) Store(key *SigningKey) error {
+	repo.keys = append(repo.keys, *key)
+	return nil
+}
+
+func (repo *mockKeyRepo) Remove(id KeyID) error {
+	for i, key := range repo.keys {
+		if key.ID == id {
+			repo.keys = append(repo.keys[:i], repo.keys[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (repo *mockKeyRepo) NextID() (KeyID, error) {
+	return KeyID(uuid.New().String()), nil
+}
@@ -0,0 +1,71 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RFC 6238 parameters supported by all common authenticator apps
+const (
+	period = 30 * time.Second
+	digits = 6
+	// skew accepts codes of adjacent steps, since clocks of the phone and the server differ
+	skew = 1
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func step(t time.Time) int64 {
+	return t.Unix() / int64(period/time.Second)
+}
+
+// Code returns code for the moment, authenticator app shows the same one
+func Code(secret string, t time.Time) string {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return ""
+	}
+	return generateCode(key, step(t))
+}
+
+// generateCode implements HOTP (RFC 4226) for the step counter
+func generateCode(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, secret)
+	_, _ = mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// verifyCode returns step of the matched code, steps not after lastUsedStep are rejected
+func verifyCode(secret string, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.TrimSpace(code)
+	current := step(now)
+	for s := current - skew; s <= current+skew; s++ {
+		if s <= lastUsedStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(generateCode(key, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// Enrollment holds shared secret of the user authenticator app,
+// it is not used for login until the user proves the app is set up
+type Enrollment struct {
+	UserID    user.ID
+	Secret    string
+	Confirmed bool
+	// LastUsedStep prevents replay of the code within its validity window
+	LastUsedStep       int64
+	RecoveryCodeHashes []string
+	// FailedAttempts counts wrong codes on disabling, a valid code resets it
+	FailedAttempts int
+}
+
+type Repository interface {
+	Store(*Enrollment) error
+	Find(user.ID) (*Enrollment, error)
+	Remove(user.ID) error
+	// AddFailedAttempt increments FailedAttempts atomically and returns the new value
+	AddFailedAttempt(user.ID) (int, error)
+}
+
+type ChallengeID string
+
+// Challenge is a login with verified password waiting for the second factor
+type Challenge struct {
+	ID        ChallengeID
+	UserID    user.ID
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+func (c Challenge) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+type ChallengeRepository interface {
+	Store(*Challenge) error
+	// AddAttempt increments Attempts atomically and returns the new value,
+	// so parallel guesses can't get around the limit
+	AddAttempt(ChallengeID) (int, error)
+	Find(ChallengeID) (*Challenge, error)
+	Remove(ChallengeID) error
+	NextID() (ChallengeID, error)
+}
+
+var ErrNotEnrolled = errors.New("two-factor authentication is not enabled")
+var ErrAlreadyEnrolled = errors.New("two-factor authentication is already enabled")
+var ErrInvalidCode = errors.New("invalid two-factor authentication code")
+var ErrChallengeNotFound = errors.New("login challenge not found")
+var ErrTooManyAttempts = errors.New("too many invalid two-factor authentication codes")
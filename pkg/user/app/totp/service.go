@@ -0,0 +1,235 @@
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const (
+	secretSize        = 20
+	recoveryCodeCount = 10
+	recoveryCodeSize  = 5
+	// maxChallengeAttempts limits guessing of 6 digit code, challenge is dropped after that
+	maxChallengeAttempts = 5
+	// maxDisableAttempts limits guessing of the code with stolen session, a valid code resets the counter
+	maxDisableAttempts = 5
+)
+
+func NewService(repo Repository, challenges ChallengeRepository, issuer string, challengeTTL time.Duration) *Service {
+	return &Service{repo, challenges, issuer, challengeTTL}
+}
+
+type Service struct {
+	repo         Repository
+	challenges   ChallengeRepository
+	issuer       string
+	challengeTTL time.Duration
+}
+
+// Enroll generates a new secret and returns otpauth URI to be shown as QR code.
+// Enrollment is pending until ConfirmEnrollment
+func (s *Service) Enroll(u *user.User) (secret string, uri string, err error) {
+	enrollment, err := s.repo.Find(u.ID)
+	if err == nil && enrollment.Confirmed {
+		return "", "", ErrAlreadyEnrolled
+	} else if err != nil && err != ErrNotEnrolled {
+		return "", "", err
+	}
+
+	key := make([]byte, secretSize)
+	if _, err = rand.Read(key); err != nil {
+		return "", "", err
+	}
+	secret = secretEncoding.EncodeToString(key)
+	err = s.repo.Store(&Enrollment{UserID: u.ID, Secret: secret})
+	if err != nil {
+		return "", "", err
+	}
+	return secret, s.uri(u, secret), nil
+}
+
+// ConfirmEnrollment enables two-factor authentication and returns recovery codes, they are shown once
+func (s *Service) ConfirmEnrollment(userID user.ID, code string) ([]string, error) {
+	enrollment, err := s.repo.Find(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.Confirmed {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	usedStep, ok := verifyCode(enrollment.Secret, code, time.Now(), enrollment.LastUsedStep)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	enrollment.RecoveryCodeHashes = make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		recoveryCode, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		enrollment.RecoveryCodeHashes = append(enrollment.RecoveryCodeHashes, hashRecoveryCode(recoveryCode))
+	}
+	enrollment.Confirmed = true
+	enrollment.LastUsedStep = usedStep
+	return recoveryCodes, s.repo.Store(enrollment)
+}
+
+// Disable requires a valid code, so stolen session is not enough to remove the second factor
+func (s *Service) Disable(userID user.ID, code string) error {
+	enrollment, err := s.repo.Find(userID)
+	if err != nil {
+		return err
+	}
+	if enrollment.Confirmed {
+		failedAttempts, err := s.repo.AddFailedAttempt(userID)
+		if err != nil {
+			return err
+		}
+		if failedAttempts > maxDisableAttempts {
+			return ErrTooManyAttempts
+		}
+		if err = s.verify(enrollment, code); err != nil {
+			return err
+		}
+	}
+	return s.repo.Remove(userID)
+}
+
+func (s *Service) Enabled(userID user.ID) (bool, error) {
+	enrollment, err := s.repo.Find(userID)
+	if err == ErrNotEnrolled {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return enrollment.Confirmed, nil
+}
+
+// StartChallenge is called after the password is verified
+func (s *Service) StartChallenge(userID user.ID) (*Challenge, error) {
+	id, err := s.challenges.NextID()
+	if err != nil {
+		return nil, err
+	}
+	challenge := &Challenge{
+		ID:        id,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(s.challengeTTL),
+	}
+	return challenge, s.challenges.Store(challenge)
+}
+
+func (s *Service) FindChallenge(id ChallengeID) (*Challenge, error) {
+	challenge, err := s.challenges.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Expired(time.Now()) {
+		return nil, ErrChallengeNotFound
+	}
+	return challenge, nil
+}
+
+// CompleteChallenge accepts code of the authenticator app or one of recovery codes
+func (s *Service) CompleteChallenge(id ChallengeID, code string) (user.ID, error) {
+	challenge, err := s.challenges.Find(id)
+	if err != nil {
+		return "", err
+	}
+	if challenge.Expired(time.Now()) {
+		_ = s.challenges.Remove(id)
+		return "", ErrChallengeNotFound
+	}
+	// attempt is counted before the code is checked
+	attempts, err := s.challenges.AddAttempt(id)
+	if err != nil {
+		return "", err
+	}
+	if attempts > maxChallengeAttempts {
+		_ = s.challenges.Remove(id)
+		return "", ErrChallengeNotFound
+	}
+
+	enrollment, err := s.repo.Find(challenge.UserID)
+	if err != nil {
+		return "", err
+	}
+	if err = s.verify(enrollment, code); err != nil {
+		return "", err
+	}
+
+	return challenge.UserID, s.challenges.Remove(id)
+}
+
+// Verify checks code outside of login challenge, e.g. on the OAuth login form
+func (s *Service) Verify(userID user.ID, code string) error {
+	enrollment, err := s.repo.Find(userID)
+	if err != nil {
+		return err
+	}
+	if !enrollment.Confirmed {
+		return ErrNotEnrolled
+	}
+	return s.verify(enrollment, code)
+}
+
+// verify checks authenticator code first, recovery code is consumed on use
+func (s *Service) verify(enrollment *Enrollment, code string) error {
+	if usedStep, ok := verifyCode(enrollment.Secret, code, time.Now(), enrollment.LastUsedStep); ok {
+		enrollment.LastUsedStep = usedStep
+		enrollment.FailedAttempts = 0
+		return s.repo.Store(enrollment)
+	}
+
+	codeHash := hashRecoveryCode(code)
+	for i, hash := range enrollment.RecoveryCodeHashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(codeHash)) == 1 {
+			enrollment.RecoveryCodeHashes = append(enrollment.RecoveryCodeHashes[:i], enrollment.RecoveryCodeHashes[i+1:]...)
+			enrollment.FailedAttempts = 0
+			return s.repo.Store(enrollment)
+		}
+	}
+	return ErrInvalidCode
+}
+
+func (s *Service) uri(u *user.User, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", s.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(digits))
+	query.Set("period", strconv.Itoa(int(period/time.Second)))
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + s.issuer + ":" + u.Username,
+		RawQuery: query.Encode(),
+	}
+	return uri.String()
+}
+
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(secretEncoding.EncodeToString(b))
+	return code[:4] + "-" + code[4:], nil
+}
+
+func hashRecoveryCode(code string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(hash[:])
+}
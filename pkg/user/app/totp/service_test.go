@@ -0,0 +1,148 @@
+package totp_test
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/totp"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestGenerateCode(t *testing.T) {
+	// test vectors from RFC 6238 appendix B truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	assert.Equal(t, "287082", totp.Code(secret, time.Unix(59, 0)))
+	assert.Equal(t, "081804", totp.Code(secret, time.Unix(1111111109, 0)))
+	assert.Equal(t, "279037", totp.Code(secret, time.Unix(2000000000, 0)))
+}
+
+func TestTOTPService_Enrollment(t *testing.T) {
+	service := totp.NewService(memory.NewTOTPRepository(), memory.NewChallengeRepository(), "arch-course", time.Minute)
+	u := &user.User{ID: "1", Username: "username"}
+
+	secret, uri, err := service.Enroll(u)
+	assert.Nil(t, err)
+	parsed, err := url.Parse(uri)
+	assert.Nil(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, secret, parsed.Query().Get("secret"))
+
+	enabled, err := service.Enabled(u.ID)
+	assert.Nil(t, err)
+	assert.False(t, enabled)
+
+	_, err = service.ConfirmEnrollment(u.ID, "000000")
+	assert.Equal(t, totp.ErrInvalidCode, err)
+	recoveryCodes, err := service.ConfirmEnrollment(u.ID, totp.Code(secret, time.Now()))
+	assert.Nil(t, err)
+	assert.Len(t, recoveryCodes, 10)
+
+	enabled, err = service.Enabled(u.ID)
+	assert.Nil(t, err)
+	assert.True(t, enabled)
+	_, _, err = service.Enroll(u)
+	assert.Equal(t, totp.ErrAlreadyEnrolled, err)
+}
+
+func TestTOTPService_Challenge(t *testing.T) {
+	service := totp.NewService(memory.NewTOTPRepository(), memory.NewChallengeRepository(), "arch-course", time.Minute)
+	u := &user.User{ID: "1", Username: "username"}
+	secret, _, err := service.Enroll(u)
+	assert.Nil(t, err)
+	// confirmation uses the code of the previous step, so the current one is still valid for login
+	recoveryCodes, err := service.ConfirmEnrollment(u.ID, totp.Code(secret, time.Now().Add(-30*time.Second)))
+	assert.Nil(t, err)
+
+	challenge, err := service.StartChallenge(u.ID)
+	assert.Nil(t, err)
+	_, err = service.CompleteChallenge(challenge.ID, "000000")
+	assert.Equal(t, totp.ErrInvalidCode, err)
+	userID, err := service.CompleteChallenge(challenge.ID, totp.Code(secret, time.Now()))
+	assert.Nil(t, err)
+	assert.Equal(t, u.ID, userID)
+	_, err = service.CompleteChallenge(challenge.ID, totp.Code(secret, time.Now()))
+	assert.Equal(t, totp.ErrChallengeNotFound, err)
+
+	// used code can't be replayed, recovery code can be used once
+	challenge, err = service.StartChallenge(u.ID)
+	assert.Nil(t, err)
+	_, err = service.CompleteChallenge(challenge.ID, totp.Code(secret, time.Now()))
+	assert.Equal(t, totp.ErrInvalidCode, err)
+	_, err = service.CompleteChallenge(challenge.ID, recoveryCodes[0])
+	assert.Nil(t, err)
+
+	challenge, err = service.StartChallenge(u.ID)
+	assert.Nil(t, err)
+	_, err = service.CompleteChallenge(challenge.ID, recoveryCodes[0])
+	assert.Equal(t, totp.ErrInvalidCode, err)
+}
+
+func TestTOTPService_ChallengeAttemptsAreLimited(t *testing.T) {
+	service := totp.NewService(memory.NewTOTPRepository(), memory.NewChallengeRepository(), "arch-course", time.Minute)
+	u := &user.User{ID: "1", Username: "username"}
+	secret, _, err := service.Enroll(u)
+	assert.Nil(t, err)
+	_, err = service.ConfirmEnrollment(u.ID, totp.Code(secret, time.Now().Add(-30*time.Second)))
+	assert.Nil(t, err)
+
+	challenge, err := service.StartChallenge(u.ID)
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = service.CompleteChallenge(challenge.ID, "000000")
+		assert.Equal(t, totp.ErrInvalidCode, err)
+	}
+	_, err = service.CompleteChallenge(challenge.ID, totp.Code(secret, time.Now()))
+	assert.Equal(t, totp.ErrChallengeNotFound, err)
+}
+
+func TestTOTPService_ParallelChallengeAttemptsAreLimited(t *testing.T) {
+	service := totp.NewService(memory.NewTOTPRepository(), memory.NewChallengeRepository(), "arch-course", time.Minute)
+	u := &user.User{ID: "1", Username: "username"}
+	secret, _, err := service.Enroll(u)
+	assert.Nil(t, err)
+	_, err = service.ConfirmEnrollment(u.ID, totp.Code(secret, time.Now().Add(-30*time.Second)))
+	assert.Nil(t, err)
+
+	challenge, err := service.StartChallenge(u.ID)
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	var invalid int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.CompleteChallenge(challenge.ID, "000000"); err == totp.ErrInvalidCode {
+				atomic.AddInt32(&invalid, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), invalid)
+}
+
+func TestTOTPService_DisableAttemptsAreLimited(t *testing.T) {
+	service := totp.NewService(memory.NewTOTPRepository(), memory.NewChallengeRepository(), "arch-course", time.Minute)
+	u := &user.User{ID: "1", Username: "username"}
+	secret, _, err := service.Enroll(u)
+	assert.Nil(t, err)
+	_, err = service.ConfirmEnrollment(u.ID, totp.Code(secret, time.Now().Add(-30*time.Second)))
+	assert.Nil(t, err)
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, totp.ErrInvalidCode, service.Disable(u.ID, "000000"))
+	}
+	assert.Equal(t, totp.ErrTooManyAttempts, service.Disable(u.ID, totp.Code(secret, time.Now())))
+
+	// login with the second factor resets the counter
+	challenge, err := service.StartChallenge(u.ID)
+	assert.Nil(t, err)
+	_, err = service.CompleteChallenge(challenge.ID, totp.Code(secret, time.Now()))
+	assert.Nil(t, err)
+	assert.Equal(t, totp.ErrInvalidCode, service.Disable(u.ID, "000000"))
+}
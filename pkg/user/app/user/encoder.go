@@ -1,11 +1,10 @@
 package user
 
 type PassEncoder interface {
-	Encode(string) string
-}
-
-type EncoderFunc func(s string) string
-
-func (f EncoderFunc) Encode(s string) string {
-	return f(s)
+	// Encode returns self-describing hash of the password
+	Encode(pass string) (string, error)
+	// Verify checks password against hash produced by Encode
+	Verify(pass, encodedPass string) (bool, error)
+	// NeedsRehash reports that hash was produced by outdated scheme or parameters
+	NeedsRehash(encodedPass string) bool
 }
@@ -1,23 +1,112 @@
 package user
 
+import "github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
+
 type ID string
 type Email string
 type Phone string
 
+// Role names are defined in common authz package, all services map them to the same permissions
+type Role string
+
+// AuthzRoles converts roles of the user to the common authz ones
+func AuthzRoles(roles []Role) []authz.Role {
+	result := make([]authz.Role, 0, len(roles))
+	for _, role := range roles {
+		result = append(result, authz.Role(role))
+	}
+	return result
+}
+
+// RolesFromAuthz converts common authz roles back to roles of the user
+func RolesFromAuthz(roles []authz.Role) []Role {
+	var result []Role
+	for _, role := range roles {
+		result = append(result, Role(role))
+	}
+	return result
+}
+
+// Action names the change of the user in the audit trail
+type Action string
+
+const (
+	ActionCreated         Action = "user.created"
+	ActionUpdated         Action = "user.updated"
+	ActionDeleted         Action = "user.deleted"
+	ActionPasswordChanged Action = "password.changed"
+	ActionEmailVerified   Action = "email.verified"
+)
+
+// Actor made the change, it differs from the user when admin changes another account.
+// Actor without UserID is a guest, e.g. password reset by emailed token
+type Actor struct {
+	UserID ID
+	IP     string
+}
+
+// Change is appended to the audit trail by the repository in the same transaction as the user itself,
+// Before is nil for created user and is not needed for deleted one
+type Change struct {
+	Actor  Actor
+	Action Action
+	Before *User
+}
+
+// EventType is a routing key of the event in the user domain
+type EventType string
+
+// EventDeleted makes other services erase data of the user
+const EventDeleted EventType = "deleted"
+
+// Event is queued by the repository in the transaction of the change and published to other services later,
+// so the event is neither lost when the broker is unavailable nor sent for the change which is rolled back
+type Event struct {
+	ID     string
+	Type   EventType
+	UserID ID
+}
+
+// EventQueue returns the oldest queued events first, published event is removed from the queue
+type EventQueue interface {
+	Pending(limit int) ([]Event, error)
+	Remove(id string) error
+}
+
+// Repository enforces unique usernames, Store returns ErrDuplicateUsername when username is taken by another user.
+// Store saves the user only when stored version equals user.Version and increments it, otherwise ErrVersionConflict is returned.
+// Store and Remove record the change to the audit trail atomically, nil change is not audited, e.g. password rehash.
+// Remove erases credentials and tokens of the user and queues EventDeleted in the same transaction.
+// Search returns at most query.Limit users ordered by query.SortKey
 type Repository interface {
-	Store(*User) error
+	Store(*User, *Change) error
 	Find(ID) (*User, error)
 	FindByUsername(string) (*User, error)
-	Remove(ID) error
+	Search(SearchQuery) ([]User, error)
+	Remove(ID, *Change) error
 	NextID() (ID, error)
 }
 
 type User struct {
-	ID          ID
-	Username    string
-	FirstName   string
-	LastName    string
-	Email       Email
-	Phone       Phone
-	EncodedPass string
+	ID        ID
+	Username  string
+	FirstName string
+	LastName  string
+	Email     Email
+	// EmailVerified is dropped when email is changed
+	EmailVerified bool
+	Phone         Phone
+	EncodedPass   string
+	Roles         []Role
+	// Version is incremented by each change, new user has zero version until it is stored
+	Version int
+}
+
+// ProfilePatch changes only fields which are not nil
+type ProfilePatch struct {
+	Username  *string
+	FirstName *string
+	LastName  *string
+	Email     *Email
+	Phone     *Phone
 }
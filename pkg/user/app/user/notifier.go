@@ -0,0 +1,6 @@
+package user
+
+// Notifier delivers messages to the user, e.g. by email
+type Notifier interface {
+	Notify(u *User, subject, text string) error
+}
@@ -0,0 +1,91 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type SortField string
+
+const (
+	SortByUsername SortField = "username"
+	SortByEmail    SortField = "email"
+)
+
+// SearchQuery selects users having Text in username, email or phone. Only users after the cursor are selected,
+// so pages don't shift when users are added or removed between requests
+type SearchQuery struct {
+	Text       string
+	SortBy     SortField
+	Descending bool
+	After      *Cursor
+	Limit      int
+}
+
+// Cursor is position of the last user of the previous page, id makes position unique among equal sort values
+type Cursor struct {
+	SortBy SortField `json:"s"`
+	Value  string    `json:"v"`
+	ID     ID        `json:"id"`
+}
+
+// Matches is the search condition for repositories without query language
+func (q SearchQuery) Matches(u User) bool {
+	text := strings.ToLower(q.Text)
+	if !strings.Contains(strings.ToLower(u.Username), text) &&
+		!strings.Contains(strings.ToLower(string(u.Email)), text) &&
+		!strings.Contains(string(u.Phone), text) {
+		return false
+	}
+	return q.After == nil || q.Less(*q.After, q.SortKey(u))
+}
+
+// Less orders positions in the requested direction, SortBy of positions is not compared
+func (q SearchQuery) Less(a, b Cursor) bool {
+	if q.Descending {
+		a, b = b, a
+	}
+	if a.Value == b.Value {
+		return a.ID < b.ID
+	}
+	return a.Value < b.Value
+}
+
+// SortKey is position of the user in results of the query
+func (q SearchQuery) SortKey(u User) Cursor {
+	c := Cursor{SortBy: q.SortBy, Value: u.Username, ID: u.ID}
+	if q.SortBy == SortByEmail {
+		c.Value = string(u.Email)
+	}
+	return c
+}
+
+func encodeCursor(c Cursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrInvalidSearch = errors.New("invalid search query")
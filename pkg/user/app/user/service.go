@@ -2,68 +2,282 @@ package user
 
 import (
 	"errors"
+	"strings"
+	"sync"
 )
 
+// dummyPassword is verified for unknown users, so response time doesn't reveal whether username exists
+const dummyPassword = "dummy password"
+
 func NewService(repo Repository, passEncoder PassEncoder) *Service {
-	return &Service{repo, passEncoder}
+	return &Service{repo: repo, passEncoder: passEncoder}
 }
 
 type Service struct {
 	repo        Repository
 	passEncoder PassEncoder
+
+	dummyPassOnce    sync.Once
+	dummyEncodedPass string
 }
 
-func (s *Service) CreateUser(username, firstName, lastName string, email Email, phone Phone, password string) (userID ID, err error) {
-	if u, err := s.repo.FindByUsername(username); u != nil {
+func (s *Service) CreateUser(actor Actor, username, firstName, lastName string, email Email, phone Phone, password string) (userID ID, err error) {
+	p, err := validateProfile(profile{username, firstName, lastName, email, phone})
+	if err != nil {
+		return userID, err
+	}
+	if u, err := s.repo.FindByUsername(p.username); u != nil {
 		return userID, ErrDuplicateUsername
 	} else if err != ErrUserNotFound {
 		return userID, err
 	}
 
+	encodedPass, err := s.passEncoder.Encode(password)
+	if err != nil {
+		return userID, err
+	}
+
 	userID, err = s.repo.NextID()
 	if err != nil {
 		return "", err
 	}
+	// signup is made by a guest, the new user is the actor
+	if actor.UserID == "" {
+		actor.UserID = userID
+	}
 	err = s.repo.Store(&User{
 		ID:          userID,
-		Username:    username,
-		FirstName:   firstName,
-		LastName:    lastName,
-		Email:       email,
-		Phone:       phone,
-		EncodedPass: s.passEncoder.Encode(password),
-	})
+		Username:    p.username,
+		FirstName:   p.firstName,
+		LastName:    p.lastName,
+		Email:       p.email,
+		Phone:       p.phone,
+		EncodedPass: encodedPass,
+	}, &Change{Actor: actor, Action: ActionCreated})
 
 	return userID, err
 }
 
-func (s *Service) UpdateUser(id ID, username, firstName, lastName string, email Email, phone Phone) error {
+// AnyVersion is passed instead of the user version when the change is not based on a particular version
+const AnyVersion = -1
+
+// UpdateUser replaces all profile fields, version is the user version the change is based on
+func (s *Service) UpdateUser(actor Actor, id ID, version int, username, firstName, lastName string, email Email, phone Phone) (*User, error) {
+	return s.updateProfile(actor, id, version, func(p *profile) {
+		*p = profile{username, firstName, lastName, email, phone}
+	})
+}
+
+// PatchUser replaces only fields set in the patch, the rest of profile is kept as is
+func (s *Service) PatchUser(actor Actor, id ID, version int, patch ProfilePatch) (*User, error) {
+	return s.updateProfile(actor, id, version, func(p *profile) {
+		if patch.Username != nil {
+			p.username = *patch.Username
+		}
+		if patch.FirstName != nil {
+			p.firstName = *patch.FirstName
+		}
+		if patch.LastName != nil {
+			p.lastName = *patch.LastName
+		}
+		if patch.Email != nil {
+			p.email = *patch.Email
+		}
+		if patch.Phone != nil {
+			p.phone = *patch.Phone
+		}
+	})
+}
+
+// updateProfile fails with ErrVersionConflict when the user is changed after the client has read it
+func (s *Service) updateProfile(actor Actor, id ID, version int, change func(*profile)) (*User, error) {
 	user, err := s.repo.Find(id)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if version != AnyVersion && user.Version != version {
+		return nil, ErrVersionConflict
 	}
-	if user2, err := s.repo.FindByUsername(username); user2 != nil && user2.ID != id {
-		return ErrDuplicateUsername
+
+	changed := profile{user.Username, user.FirstName, user.LastName, user.Email, user.Phone}
+	change(&changed)
+	p, err := validateProfile(changed)
+	if err != nil {
+		return nil, err
+	}
+	if user2, err := s.repo.FindByUsername(p.username); user2 != nil && user2.ID != id {
+		return nil, ErrDuplicateUsername
 	} else if err != nil && err != ErrUserNotFound {
-		return err
+		return nil, err
 	}
 
-	user.Username = username
-	user.FirstName = firstName
-	user.LastName = lastName
-	user.Email = email
-	user.Phone = phone
+	before := *user
+	if user.Email != p.email {
+		user.EmailVerified = false
+	}
+	user.Username = p.username
+	user.FirstName = p.firstName
+	user.LastName = p.lastName
+	user.Email = p.email
+	user.Phone = p.phone
 
-	return s.repo.Store(user)
+	return user, s.repo.Store(user, &Change{Actor: actor, Action: ActionUpdated, Before: &before})
 }
 
-func (s *Service) DeleteUser(id ID) error {
-	return s.repo.Remove(id)
+func (s *Service) DeleteUser(actor Actor, id ID) error {
+	return s.repo.Remove(id, &Change{Actor: actor, Action: ActionDeleted})
 }
 
 func (s *Service) ReadUser(id ID) (*User, error) {
 	return s.repo.Find(id)
 }
 
+// Authenticate checks user credentials, hash of outdated scheme is replaced with the current one
+func (s *Service) Authenticate(username, password string) (*User, error) {
+	user, err := s.repo.FindByUsername(username)
+	if err == ErrUserNotFound {
+		s.verifyDummyPassword(password)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.passEncoder.Verify(password, user.EncodedPass)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidPassword
+	}
+
+	if s.passEncoder.NeedsRehash(user.EncodedPass) {
+		if encodedPass, err := s.passEncoder.Encode(password); err == nil {
+			user.EncodedPass = encodedPass
+			// the user is already authenticated, failed rehash will be retried on the next login
+			_ = s.repo.Store(user, nil)
+		}
+	}
+
+	return user, nil
+}
+
+// ChangePassword requires the current password, so stolen session is not enough to take over the account
+func (s *Service) ChangePassword(actor Actor, id ID, oldPassword, newPassword string) error {
+	user, err := s.repo.Find(id)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.passEncoder.Verify(oldPassword, user.EncodedPass)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidPassword
+	}
+	return s.storePassword(actor, user, newPassword)
+}
+
+// SetPassword replaces password without checking the old one, caller must prove user identity in another way
+func (s *Service) SetPassword(actor Actor, id ID, password string) error {
+	user, err := s.repo.Find(id)
+	if err != nil {
+		return err
+	}
+	return s.storePassword(actor, user, password)
+}
+
+// VerifyEmail confirms that user owns the email, verification sent to the previous email is rejected
+func (s *Service) VerifyEmail(actor Actor, id ID, email Email) (*User, error) {
+	user, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email != email {
+		return nil, ErrEmailChanged
+	}
+
+	before := *user
+	user.EmailVerified = true
+	return user, s.repo.Store(user, &Change{Actor: actor, Action: ActionEmailVerified, Before: &before})
+}
+
+// SetRoles replaces all roles of the user
+func (s *Service) SetRoles(actor Actor, id ID, roles []Role) (*User, error) {
+	user, err := s.repo.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *user
+	user.Roles = roles
+	return user, s.repo.Store(user, &Change{Actor: actor, Action: ActionUpdated, Before: &before})
+}
+
+// SearchUsers returns page of users and cursor of the next page, empty cursor is returned for the last page
+func (s *Service) SearchUsers(text string, sortBy SortField, descending bool, cursor string, limit int) ([]User, string, error) {
+	if sortBy == "" {
+		sortBy = SortByUsername
+	}
+	if sortBy != SortByUsername && sortBy != SortByEmail {
+		return nil, "", ErrInvalidSearch
+	}
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	if limit < 0 || limit > maxSearchLimit {
+		return nil, "", ErrInvalidSearch
+	}
+
+	query := SearchQuery{Text: strings.TrimSpace(text), SortBy: sortBy, Descending: descending, Limit: limit + 1}
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		// position in another order points to random place
+		if after.SortBy != sortBy {
+			return nil, "", ErrInvalidCursor
+		}
+		query.After = after
+	}
+
+	users, err := s.repo.Search(query)
+	if err != nil || len(users) <= limit {
+		return users, "", err
+	}
+	users = users[:limit]
+	next, err := encodeCursor(query.SortKey(users[limit-1]))
+	return users, next, err
+}
+
+func (s *Service) FindByUsername(username string) (*User, error) {
+	return s.repo.FindByUsername(username)
+}
+
+func (s *Service) storePassword(actor Actor, user *User, password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+	encodedPass, err := s.passEncoder.Encode(password)
+	if err != nil {
+		return err
+	}
+	before := *user
+	user.EncodedPass = encodedPass
+	return s.repo.Store(user, &Change{Actor: actor, Action: ActionPasswordChanged, Before: &before})
+}
+
+func (s *Service) verifyDummyPassword(password string) {
+	s.dummyPassOnce.Do(func() {
+		s.dummyEncodedPass, _ = s.passEncoder.Encode(dummyPassword)
+	})
+	_, _ = s.passEncoder.Verify(password, s.dummyEncodedPass)
+}
+
 var ErrUserNotFound = errors.New("user not found")
 var ErrDuplicateUsername = errors.New("duplicate username")
+var ErrInvalidPassword = errors.New("invalid password")
+var ErrEmptyPassword = errors.New("new password is empty")
+var ErrEmailChanged = errors.New("email is changed")
+var ErrVersionConflict = errors.New("user is changed by another request")
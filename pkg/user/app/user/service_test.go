@@ -1,6 +1,10 @@
 package user
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/uuid"
@@ -11,14 +15,14 @@ func TestUserService_CreateUser(t *testing.T) {
 	repo := &mockRepo{}
 	service := NewService(repo, mockEncoder())
 
-	userID, err := service.CreateUser("username", "first name", "last name", "some@email.ru", "900", "")
+	userID, err := service.CreateUser(Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "")
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(repo.users))
 	user, err := repo.Find(userID)
 	assert.Nil(t, err)
 	assert.NotNil(t, 1, user)
 
-	_, err = service.CreateUser("username", "first name", "last name", "some@email.ru", "900", "")
+	_, err = service.CreateUser(Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "")
 	assert.Equal(t, ErrDuplicateUsername, err)
 }
 
@@ -26,65 +30,333 @@ func TestUserService_UpdateUser(t *testing.T) {
 	repo := &mockRepo{}
 	service := NewService(repo, mockEncoder())
 
-	userID, err := service.CreateUser("username", "first name", "last name", "some@email.ru", "900", "")
+	userID, err := service.CreateUser(Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "")
 	assert.Nil(t, err)
-	_, err = service.CreateUser("username2", "first name2", "last name2", "some@email.ru", "900", "")
+	_, err = service.CreateUser(Actor{}, "username2", "first name2", "last name2", "some@email.ru", "+79001234567", "")
 	assert.Nil(t, err)
 
-	err = service.UpdateUser(userID, "username2", "first name", "last name", "some@email.ru", "900")
+	_, err = service.UpdateUser(Actor{}, userID, 1, "username2", "first name", "last name", "some@email.ru", "+79001234567")
 	assert.Equal(t, ErrDuplicateUsername, err)
 
 	updatedUserName := "username3"
-	err = service.UpdateUser(userID, updatedUserName, "first name3", "last name3", "some@email.ru", "900")
+	updated, err := service.UpdateUser(Actor{}, userID, 1, updatedUserName, "first name3", "last name3", "some@email.ru", "+79001234567")
 	assert.Nil(t, err)
+	assert.Equal(t, 2, updated.Version)
 	user, err := repo.Find(userID)
 	assert.Nil(t, err)
 	assert.Equal(t, updatedUserName, user.Username)
+	assert.Equal(t, 2, user.Version)
+
+	// the second tab is based on the first version
+	_, err = service.UpdateUser(Actor{}, userID, 1, "username4", "first name", "last name", "some@email.ru", "+79001234567")
+	assert.Equal(t, ErrVersionConflict, err)
+	user, err = repo.Find(userID)
+	assert.Nil(t, err)
+	assert.Equal(t, updatedUserName, user.Username)
+}
+
+func TestUserService_PatchUser(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo, mockEncoder())
+
+	userID, err := service.CreateUser(Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "")
+	assert.Nil(t, err)
+
+	firstName := "new first name"
+	phone := Phone("+7 (901) 123-45-67")
+	u, err := service.PatchUser(Actor{}, userID, 1, ProfilePatch{FirstName: &firstName, Phone: &phone})
+	assert.Nil(t, err)
+	assert.Equal(t, "username", u.Username)
+	assert.Equal(t, firstName, u.FirstName)
+	assert.Equal(t, "last name", u.LastName)
+	assert.Equal(t, Phone("+79011234567"), u.Phone)
+
+	invalid := ""
+	_, err = service.PatchUser(Actor{}, userID, 2, ProfilePatch{Username: &invalid})
+	_, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	_, err = service.PatchUser(Actor{}, userID, 1, ProfilePatch{FirstName: &firstName})
+	assert.Equal(t, ErrVersionConflict, err)
+
+	lastName := "new last name"
+	u, err = service.PatchUser(Actor{}, userID, AnyVersion, ProfilePatch{LastName: &lastName})
+	assert.Nil(t, err)
+	assert.Equal(t, lastName, u.LastName)
+	assert.Equal(t, 3, u.Version)
+}
+
+func TestUserService_StoreDetectsConcurrentChange(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo, mockEncoder())
+
+	userID, err := service.CreateUser(Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "")
+	assert.Nil(t, err)
+	first, _ := repo.Find(userID)
+	second, _ := repo.Find(userID)
+
+	first.FirstName = "first"
+	assert.Nil(t, repo.Store(first, nil))
+	second.FirstName = "second"
+	assert.Equal(t, ErrVersionConflict, repo.Store(second, nil))
+}
+
+func TestUserService_Authenticate(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo, mockEncoder())
+
+	userID, err := service.CreateUser(Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+
+	u, err := service.Authenticate("username", "pass")
+	assert.Nil(t, err)
+	assert.Equal(t, userID, u.ID)
+
+	_, err = service.Authenticate("username", "wrong pass")
+	assert.Equal(t, ErrInvalidPassword, err)
+
+	_, err = service.Authenticate("unknown", "pass")
+	assert.Equal(t, ErrUserNotFound, err)
+}
+
+func TestUserService_AuthenticateRehashesLegacyPassword(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo, mockEncoder())
+	assert.Nil(t, repo.Store(&User{ID: "1", Username: "username", EncodedPass: legacyPrefix + "pass"}, nil))
+
+	_, err := service.Authenticate("username", "wrong pass")
+	assert.Equal(t, ErrInvalidPassword, err)
+	u, _ := repo.Find("1")
+	assert.Equal(t, legacyPrefix+"pass", u.EncodedPass)
+
+	_, err = service.Authenticate("username", "pass")
+	assert.Nil(t, err)
+	u, _ = repo.Find("1")
+	assert.Equal(t, currentPrefix+"pass", u.EncodedPass)
+	assert.Empty(t, repo.changes, "rehash is not a change of the user")
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo, mockEncoder())
+
+	userID, err := service.CreateUser(Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+
+	err = service.ChangePassword(Actor{}, userID, "wrong pass", "new pass")
+	assert.Equal(t, ErrInvalidPassword, err)
+	err = service.ChangePassword(Actor{}, userID, "pass", "")
+	assert.Equal(t, ErrEmptyPassword, err)
+	assert.Equal(t, ErrEmptyPassword, service.SetPassword(Actor{}, userID, ""))
+
+	assert.Nil(t, service.ChangePassword(Actor{}, userID, "pass", "new pass"))
+	_, err = service.Authenticate("username", "pass")
+	assert.Equal(t, ErrInvalidPassword, err)
+	_, err = service.Authenticate("username", "new pass")
+	assert.Nil(t, err)
+
+	assert.Nil(t, service.SetPassword(Actor{}, userID, "reset pass"))
+	_, err = service.Authenticate("username", "reset pass")
+	assert.Nil(t, err)
+}
+
+func TestUserService_VerifyEmail(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo, mockEncoder())
+
+	userID, err := service.CreateUser(Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	u, _ := repo.Find(userID)
+	assert.False(t, u.EmailVerified)
+
+	_, err = service.VerifyEmail(Actor{}, userID, "other@email.ru")
+	assert.Equal(t, ErrEmailChanged, err)
+	u, err = service.VerifyEmail(Actor{}, userID, "some@email.ru")
+	assert.Nil(t, err)
+	assert.True(t, u.EmailVerified)
+
+	_, err = service.UpdateUser(Actor{}, userID, u.Version, "username", "first name", "last name", "some@email.ru", "+79011234567")
+	assert.Nil(t, err)
+	u, _ = repo.Find(userID)
+	assert.True(t, u.EmailVerified)
+	_, err = service.UpdateUser(Actor{}, userID, u.Version, "username", "first name", "last name", "other@email.ru", "+79011234567")
+	assert.Nil(t, err)
+	u, _ = repo.Find(userID)
+	assert.False(t, u.EmailVerified)
+}
+
+func TestUserService_AuditsChanges(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo, mockEncoder())
+	admin := Actor{UserID: "admin", IP: "10.0.0.1"}
+
+	userID, err := service.CreateUser(Actor{IP: "10.0.0.2"}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	u, err := service.VerifyEmail(Actor{IP: "10.0.0.2"}, userID, "some@email.ru")
+	assert.Nil(t, err)
+	_, err = service.SetRoles(admin, userID, []Role{"admin"})
+	assert.Nil(t, err)
+	assert.Nil(t, service.SetPassword(admin, userID, "pass"))
+	assert.Nil(t, service.DeleteUser(admin, userID))
+
+	var actions []Action
+	for _, change := range repo.changes {
+		actions = append(actions, change.Action)
+	}
+	assert.Equal(t, []Action{ActionCreated, ActionEmailVerified, ActionUpdated, ActionPasswordChanged, ActionDeleted}, actions)
+	assert.Nil(t, repo.changes[0].Before)
+	assert.False(t, repo.changes[1].Before.EmailVerified)
+	assert.True(t, u.EmailVerified)
+	assert.Empty(t, repo.changes[2].Before.Roles)
+	assert.Equal(t, admin, repo.changes[4].Actor)
+}
+
+func TestUserService_SearchUsers(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo, mockEncoder())
+	for i, name := range []string{"carol", "alice", "bob", "dave"} {
+		_, err := service.CreateUser(Actor{}, name, "first name", "last name", Email(name+"@corp.com"), Phone(fmt.Sprintf("+7900123456%d", i)), "pass")
+		assert.Nil(t, err)
+	}
+	_, err := service.CreateUser(Actor{}, "eve", "first name", "last name", "eve@other.com", "+79011234567", "pass")
+	assert.Nil(t, err)
+
+	var usernames []string
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		users, next, err := service.SearchUsers("CORP", SortByUsername, false, cursor, 3)
+		assert.Nil(t, err)
+		for _, u := range users {
+			usernames = append(usernames, u.Username)
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"alice", "bob", "carol", "dave"}, usernames)
+
+	users, next, err := service.SearchUsers("@", SortByEmail, true, "", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "eve", users[0].Username)
+	assert.Equal(t, "dave", users[1].Username)
+	users, _, err = service.SearchUsers("@", SortByEmail, true, next, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "carol", users[0].Username)
+
+	users, _, err = service.SearchUsers("9011", "", false, "", 0)
+	assert.Nil(t, err)
+	assert.Len(t, users, 1)
+
+	_, _, err = service.SearchUsers("", SortByUsername, true, next, 2)
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, _, err = service.SearchUsers("", "", false, "garbage", 2)
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, _, err = service.SearchUsers("", "phone", false, "", 2)
+	assert.Equal(t, ErrInvalidSearch, err)
+	_, _, err = service.SearchUsers("", "", false, "", 1000)
+	assert.Equal(t, ErrInvalidSearch, err)
 }
 
 type mockRepo struct {
-	users []*User
+	mu      sync.Mutex
+	users   []*User
+	changes []Change
 }
 
-func (repo *mockRepo) Store(user *User) error {
+func (repo *mockRepo) Store(user *User, change *Change) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
 	for _, u := range repo.users {
+		if u.Username == user.Username && u.ID != user.ID {
+			return ErrDuplicateUsername
+		}
+	}
+	// copies are stored and returned, so failed update doesn't change stored user
+	stored := *user
+	stored.Version++
+	for i, u := range repo.users {
 		if u.ID == user.ID {
+			if u.Version != user.Version {
+				return ErrVersionConflict
+			}
+			repo.users[i] = &stored
+			user.Version++
+			repo.record(change)
 			return nil
 		}
 	}
 
-	repo.users = append(repo.users, user)
+	repo.users = append(repo.users, &stored)
+	user.Version++
+	repo.record(change)
 	return nil
 }
 
 func (repo *mockRepo) Find(id ID) (*User, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
 	for _, u := range repo.users {
 		if u.ID == id {
-			return u, nil
+			found := *u
+			return &found, nil
 		}
 	}
 	return nil, ErrUserNotFound
 }
 
 func (repo *mockRepo) FindByUsername(username string) (*User, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
 	for _, u := range repo.users {
 		if u.Username == username {
-			return u, nil
+			found := *u
+			return &found, nil
 		}
 	}
 	return nil, ErrUserNotFound
 }
 
-func (repo *mockRepo) Remove(id ID) error {
+func (repo *mockRepo) Search(query SearchQuery) ([]User, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var users []User
+	for _, u := range repo.users {
+		if query.Matches(*u) {
+			users = append(users, *u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return query.Less(query.SortKey(users[i]), query.SortKey(users[j]))
+	})
+	if len(users) > query.Limit {
+		users = users[:query.Limit]
+	}
+	return users, nil
+}
+
+func (repo *mockRepo) Remove(id ID, change *Change) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
 	for i, u := range repo.users {
 		if u.ID == id {
 			repo.users = append(repo.users[:i], repo.users[i+1:]...)
+			repo.record(change)
 			return nil
 		}
 	}
 	return ErrUserNotFound
 }
 
+func (repo *mockRepo) record(change *Change) {
+	if change != nil {
+		repo.changes = append(repo.changes, *change)
+	}
+}
+
 func (repo *mockRepo) NextID() (ID, error) {
 	id, err := uuid.NewUUID()
 	if err != nil {
@@ -93,8 +365,25 @@ func (repo *mockRepo) NextID() (ID, error) {
 	return ID(id.String()), nil
 }
 
-func mockEncoder() EncoderFunc {
-	return func(s string) string {
-		return s
-	}
+const (
+	currentPrefix = "current:"
+	legacyPrefix  = "legacy:"
+)
+
+type mockPassEncoder struct{}
+
+func (e mockPassEncoder) Encode(pass string) (string, error) {
+	return currentPrefix + pass, nil
+}
+
+func (e mockPassEncoder) Verify(pass, encodedPass string) (bool, error) {
+	return encodedPass == currentPrefix+pass || encodedPass == legacyPrefix+pass, nil
+}
+
+func (e mockPassEncoder) NeedsRehash(encodedPass string) bool {
+	return !strings.HasPrefix(encodedPass, currentPrefix)
+}
+
+func mockEncoder() PassEncoder {
+	return mockPassEncoder{}
 }
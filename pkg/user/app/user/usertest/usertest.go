@@ -0,0 +1,43 @@
+// Package usertest provides fakes of user dependencies for tests of other user services
+package usertest
+
+import (
+	"strings"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// PlainEncoder stores passwords as is, so tests don't spend time on hashing
+type PlainEncoder struct{}
+
+func (PlainEncoder) Encode(pass string) (string, error) {
+	return pass, nil
+}
+
+func (PlainEncoder) Verify(pass, encodedPass string) (bool, error) {
+	return pass == encodedPass, nil
+}
+
+func (PlainEncoder) NeedsRehash(string) bool {
+	return false
+}
+
+// Notifier keeps texts of sent messages
+type Notifier struct {
+	Texts []string
+}
+
+func (n *Notifier) Notify(_ *user.User, _, text string) error {
+	n.Texts = append(n.Texts, text)
+	return nil
+}
+
+// Token extracts token from the last message, token follows the last colon and ends the line
+func (n *Notifier) Token() string {
+	if len(n.Texts) == 0 {
+		return ""
+	}
+	text := n.Texts[len(n.Texts)-1]
+	text = text[strings.LastIndex(text, ": ")+2:]
+	return text[:strings.Index(text, "\n")]
+}
@@ -0,0 +1,125 @@
+package user
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 32
+	maxNameLength     = 100
+)
+
+// Field names match json fields of the api, so clients can highlight them
+const (
+	FieldUsername  = "username"
+	FieldFirstName = "firstName"
+	FieldLastName  = "lastName"
+	FieldEmail     = "email"
+	FieldPhone     = "phone"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// e164Pattern allows up to 15 digits with country code, which never starts with zero
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError lists all invalid fields at once, not only the first one
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		fields = append(fields, field.Field)
+	}
+	return "invalid fields: " + strings.Join(fields, ", ")
+}
+
+type profile struct {
+	username  string
+	firstName string
+	lastName  string
+	email     Email
+	phone     Phone
+}
+
+// validateProfile returns profile with normalized email and phone
+func validateProfile(p profile) (profile, error) {
+	var fields []FieldError
+	if length := utf8.RuneCountInString(p.username); length < minUsernameLength || length > maxUsernameLength {
+		fields = append(fields, FieldError{FieldUsername, "must be from 3 to 32 characters long"})
+	} else if !usernamePattern.MatchString(p.username) {
+		fields = append(fields, FieldError{FieldUsername, "may contain only latin letters, digits, '.', '_' and '-' and must start with a letter or digit"})
+	}
+	if utf8.RuneCountInString(p.firstName) > maxNameLength {
+		fields = append(fields, FieldError{FieldFirstName, "must be at most 100 characters long"})
+	}
+	if utf8.RuneCountInString(p.lastName) > maxNameLength {
+		fields = append(fields, FieldError{FieldLastName, "must be at most 100 characters long"})
+	}
+
+	email, err := NormalizeEmail(string(p.email))
+	if err != nil {
+		fields = append(fields, FieldError{FieldEmail, err.Error()})
+	}
+	p.email = email
+
+	if p.phone != "" {
+		phone, err := NormalizePhone(string(p.phone))
+		if err != nil {
+			fields = append(fields, FieldError{FieldPhone, err.Error()})
+		}
+		p.phone = phone
+	}
+
+	if len(fields) > 0 {
+		return p, &ValidationError{Fields: fields}
+	}
+	return p, nil
+}
+
+type invalidValue string
+
+func (e invalidValue) Error() string {
+	return string(e)
+}
+
+// NormalizeEmail accepts bare RFC 5322 address, display names are not allowed. Domain is case-insensitive, so it is lowercased
+func NormalizeEmail(email string) (Email, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", invalidValue("is required")
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return "", invalidValue("must be a valid email address")
+	}
+
+	at := strings.LastIndex(email, "@")
+	return Email(email[:at] + strings.ToLower(email[at:])), nil
+}
+
+// NormalizePhone converts phone in international format to E.164, so "+7 (900) 123-45-67" becomes "+79001234567"
+func NormalizePhone(phone string) (Phone, error) {
+	normalized := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+	if !e164Pattern.MatchString(normalized) {
+		return "", invalidValue("must be in international format with country code, e.g. +79001234567")
+	}
+	return Phone(normalized), nil
+}
@@ -0,0 +1,60 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	email, err := NormalizeEmail(" John.Doe@Example.COM ")
+	assert.Nil(t, err)
+	assert.Equal(t, Email("John.Doe@example.com"), email)
+
+	for _, invalid := range []string{"", "john", "john@", "@example.com", "John <john@example.com>", "john@example.com, jane@example.com"} {
+		_, err = NormalizeEmail(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	phone, err := NormalizePhone("+7 (900) 123-45-67")
+	assert.Nil(t, err)
+	assert.Equal(t, Phone("+79001234567"), phone)
+
+	for _, invalid := range []string{"900", "89001234567", "+0 900 123 45 67", "+7 900 CALL ME", "+1234567890123456"} {
+		_, err = NormalizePhone(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestUserService_CreateUserValidation(t *testing.T) {
+	repo := &mockRepo{}
+	service := NewService(repo, mockEncoder())
+
+	_, err := service.CreateUser(Actor{}, "", "first name", "last name", "garbage", "call me", "pass")
+	validationErr, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, []string{FieldUsername, FieldEmail, FieldPhone}, fieldNames(validationErr))
+	assert.Empty(t, repo.users)
+
+	userID, err := service.CreateUser(Actor{}, "john.doe", "first name", "last name", "john@Example.com", "+7 900 123-45-67", "pass")
+	assert.Nil(t, err)
+	u, err := repo.Find(userID)
+	assert.Nil(t, err)
+	assert.Equal(t, Email("john@example.com"), u.Email)
+	assert.Equal(t, Phone("+79001234567"), u.Phone)
+
+	_, err = service.UpdateUser(Actor{}, userID, u.Version, "john doe", "first name", "last name", "john@example.com", "")
+	validationErr, ok = err.(*ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, []string{FieldUsername}, fieldNames(validationErr))
+}
+
+func fieldNames(err *ValidationError) []string {
+	var names []string
+	for _, field := range err.Fields {
+		names = append(names, field.Field)
+	}
+	return names
+}
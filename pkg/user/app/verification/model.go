@@ -0,0 +1,30 @@
+package verification
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// Token confirms the email it was sent to, only hash of the token is stored
+type Token struct {
+	Hash      string
+	UserID    user.ID
+	Email     user.Email
+	ExpiresAt time.Time
+}
+
+func (t Token) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+type Repository interface {
+	Store(*Token) error
+	// Take removes token and returns it, so the token can be used once
+	Take(hash string) (*Token, error)
+	RemoveByUserID(user.ID) error
+}
+
+var ErrInvalidToken = errors.New("invalid or expired email verification token")
+var ErrAlreadyVerified = errors.New("email is already verified")
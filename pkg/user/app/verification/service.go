@@ -0,0 +1,83 @@
+package verification
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const tokenSize = 32
+
+func NewService(repo Repository, users *user.Service, sessions *session.Service, notifier user.Notifier, tokenTTL time.Duration) *Service {
+	return &Service{repo, users, sessions, notifier, tokenTTL}
+}
+
+type Service struct {
+	repo     Repository
+	users    *user.Service
+	sessions *session.Service
+	notifier user.Notifier
+	tokenTTL time.Duration
+}
+
+// SendVerification sends token to the current email of the user
+func (s *Service) SendVerification(userID user.ID) error {
+	u, err := s.users.ReadUser(userID)
+	if err != nil {
+		return err
+	}
+	if u.EmailVerified {
+		return ErrAlreadyVerified
+	}
+
+	secret := make([]byte, tokenSize)
+	if _, err = rand.Read(secret); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	err = s.repo.Store(&Token{
+		Hash:      hashToken(token),
+		UserID:    u.ID,
+		Email:     u.Email,
+		ExpiresAt: time.Now().Add(s.tokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Use this token to confirm your email: %s\nIt expires in %s.", token, s.tokenTTL)
+	return s.notifier.Notify(u, "Email verification", text)
+}
+
+// Confirm marks email as verified, active sessions get verified state immediately
+func (s *Service) Confirm(actor user.Actor, token string) error {
+	t, err := s.repo.Take(hashToken(token))
+	if err != nil {
+		return err
+	}
+	if t.Expired(time.Now()) {
+		return ErrInvalidToken
+	}
+
+	u, err := s.users.VerifyEmail(actor, t.UserID, t.Email)
+	if err == user.ErrEmailChanged || err == user.ErrUserNotFound {
+		return ErrInvalidToken
+	} else if err != nil {
+		return err
+	}
+	if err = s.repo.RemoveByUserID(u.ID); err != nil {
+		return err
+	}
+	return s.sessions.UpdateUser(u)
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
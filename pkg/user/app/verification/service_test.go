@@ -0,0 +1,59 @@
+package verification_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user/usertest"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/verification"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestVerificationService_Confirm(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	sessions := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+	notifier := &usertest.Notifier{}
+	service := verification.NewService(memory.NewVerificationTokenRepository(), users, sessions, notifier, time.Hour)
+
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	u, _ := users.ReadUser(userID)
+	s, _, err := sessions.Start(u, session.Client{})
+	assert.Nil(t, err)
+	assert.False(t, s.EmailVerified)
+
+	assert.Nil(t, service.SendVerification(userID))
+	token := notifier.Token()
+
+	assert.Equal(t, verification.ErrInvalidToken, service.Confirm(user.Actor{}, "invalid"))
+	assert.Nil(t, service.Confirm(user.Actor{}, token))
+	u, _ = users.ReadUser(userID)
+	assert.True(t, u.EmailVerified)
+	s, err = sessions.Find(s.ID)
+	assert.Nil(t, err)
+	assert.True(t, s.EmailVerified)
+
+	assert.Equal(t, verification.ErrInvalidToken, service.Confirm(user.Actor{}, token))
+	assert.Equal(t, verification.ErrAlreadyVerified, service.SendVerification(userID))
+}
+
+func TestVerificationService_TokenForChangedEmailIsRejected(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	sessions := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+	notifier := &usertest.Notifier{}
+	service := verification.NewService(memory.NewVerificationTokenRepository(), users, sessions, notifier, time.Hour)
+
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	assert.Nil(t, service.SendVerification(userID))
+	_, err = users.UpdateUser(user.Actor{}, userID, 1, "username", "first name", "last name", "other@email.ru", "+79001234567")
+	assert.Nil(t, err)
+
+	assert.Equal(t, verification.ErrInvalidToken, service.Confirm(user.Actor{}, notifier.Token()))
+	u, _ := users.ReadUser(userID)
+	assert.False(t, u.EmailVerified)
+}
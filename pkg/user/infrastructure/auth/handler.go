@@ -3,53 +3,166 @@ package auth
 import (
 	"encoding/json"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/apikey"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/attempt"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/oauth"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/token"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/totp"
 	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
 )
 
 type SessionService struct {
-	sessions map[string]session
-	repo     user.Repository
-	encoder  user.PassEncoder
+	sessions *session.Service
+	users    *user.Service
+	tokens   *token.Service
+	attempts *attempt.Service
+	totp     *totp.Service
+	apiKeys  *apikey.Service
+	trail    *audit.Service
+	// failedLogins is partitioned by reason label
+	failedLogins *prometheus.CounterVec
 }
 
-func NewSessionService(repo user.Repository, encoder user.PassEncoder) *SessionService {
-	sessions := make(map[string]session)
-	return &SessionService{sessions: sessions, repo: repo, encoder: encoder}
+func NewSessionService(
+	users *user.Service,
+	sessions *session.Service,
+	tokens *token.Service,
+	attempts *attempt.Service,
+	totp *totp.Service,
+	apiKeys *apikey.Service,
+	trail *audit.Service,
+	failedLogins *prometheus.CounterVec,
+) *SessionService {
+	return &SessionService{
+		sessions:     sessions,
+		users:        users,
+		tokens:       tokens,
+		attempts:     attempts,
+		totp:         totp,
+		apiKeys:      apiKeys,
+		trail:        trail,
+		failedLogins: failedLogins,
+	}
 }
 
-type session struct {
-	id        string
-	login     string
-	email     string
-	firstName string
-	lastName  string
+type challengeResponse struct {
+	ChallengeID   string `json:"challengeId"`
+	ChallengeType string `json:"challengeType"`
+	ExpiresIn     int    `json:"expiresIn"`
 }
 
-const sessionCookie = "sid"
+type tokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
 
+const (
+	sessionCookie      = "sid"
+	refreshTokenCookie = "refresh_token"
+	refreshTokenPath   = "/token/refresh"
+)
+
+// AuthHandler is called by the ingress on every request, so it also keeps active session alive.
+// Without session cookie it accepts bearer access token of OAuth client apps or api key of scripts
 func (service *SessionService) AuthHandler(w http.ResponseWriter, r *http.Request) {
 	sessionID, err := r.Cookie(sessionCookie)
 	if err != nil {
+		service.authorizeBearer(w, r)
+		return
+	}
+
+	s, err := service.sessions.Renew(session.ID(sessionID.Value))
+	if err == session.ErrSessionNotFound {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	session, ok := service.sessions[sessionID.Value]
+	w.Header().Set("X-User-Id", string(s.UserID))
+	w.Header().Set("X-Login", s.Login)
+	w.Header().Set("X-Email", s.Email)
+	w.Header().Set("X-Email-Verified", strconv.FormatBool(s.EmailVerified))
+	w.Header().Set("X-First-Name", s.FirstName)
+	w.Header().Set("X-Last-Name", s.LastName)
+	w.Header().Set("X-User-Roles", authz.FormatRoles(user.AuthzRoles(s.Roles)))
+	w.Header().Set("X-Session-Id", string(s.ID))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (service *SessionService) authorizeBearer(w http.ResponseWriter, r *http.Request) {
+	bearer, ok := bearerToken(r)
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	if strings.HasPrefix(bearer, apikey.Prefix) {
+		service.authorizeAPIKey(w, r, bearer)
+		return
+	}
 
-	w.Header().Set("X-User-Id", session.id)
-	w.Header().Set("X-Login", session.login)
-	w.Header().Set("X-Email", session.email)
-	w.Header().Set("X-First-Name", session.firstName)
-	w.Header().Set("X-Last-Name", session.lastName)
+	claims, err := service.tokens.VerifyAccessToken(bearer)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if claims.Audience != "" {
+		// token of OAuth client app is limited by the scope the user consented to
+		scoped := oauth.ScopedClaims(*claims, claims.Scope)
+		claims = &scoped
+	}
+
+	w.Header().Set("X-User-Id", claims.Subject)
+	w.Header().Set("X-Login", claims.Login)
+	w.Header().Set("X-Email", claims.Email)
+	w.Header().Set("X-Email-Verified", strconv.FormatBool(claims.EmailVerified))
+	w.Header().Set("X-First-Name", claims.FirstName)
+	w.Header().Set("X-Last-Name", claims.LastName)
+	w.Header().Set("X-User-Roles", strings.Join(claims.Roles, ","))
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorizeAPIKey checks key scopes against the original method, the ingress passes it in X-Forwarded-Method.
+// Forward auth request itself is always GET, so the key is rejected when the original method is unknown.
+// Keys don't carry roles of the owner and X-Api-Key-Id keeps them away from credentials management
+func (service *SessionService) authorizeAPIKey(w http.ResponseWriter, r *http.Request, bearer string) {
+	key, u, err := service.apiKeys.Authenticate(bearer)
+	if err == apikey.ErrInvalidKey {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	method := r.Header.Get("X-Forwarded-Method")
+	if method == "" || !key.Allows(method) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("X-User-Id", string(u.ID))
+	w.Header().Set("X-Login", u.Username)
+	w.Header().Set("X-Email", string(u.Email))
+	w.Header().Set("X-Email-Verified", strconv.FormatBool(u.EmailVerified))
+	w.Header().Set("X-First-Name", u.FirstName)
+	w.Header().Set("X-Last-Name", u.LastName)
+	w.Header().Set("X-Api-Key-Id", string(key.ID))
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -67,57 +180,298 @@ func (service *SessionService) LoginHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	u, err := service.repo.FindByUsername(data.Login)
+	ip := ClientIP(r)
+	retryAfter, err := service.attempts.Reserve(data.Login, ip)
+	if err == attempt.ErrTooManyAttempts {
+		service.failedLogins.WithLabelValues("locked").Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = io.WriteString(w, "Too many login attempts")
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	u, err := service.users.Authenticate(data.Login, data.Password)
+	if err == user.ErrInvalidPassword || err == user.ErrUserNotFound {
+		// the same response for both cases, so it is impossible to find out whether username exists,
+		// the attempt is already counted by Reserve
+		service.failedLogins.WithLabelValues("invalid_credentials").Inc()
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, "Invalid login or password")
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+	if err = service.attempts.Release(data.Login, ip); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	secondFactorEnabled, err := service.totp.Enabled(u.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+	if secondFactorEnabled {
+		// attempts counter is not reset until the second factor is verified
+		challenge, err := service.totp.StartChallenge(u.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(challengeResponse{
+			ChallengeID:   string(challenge.ID),
+			ChallengeType: "totp",
+			ExpiresIn:     int(time.Until(challenge.ExpiresAt).Seconds()),
+		})
+		return
+	}
+
+	service.startSession(w, r, u)
+}
+
+// SecondFactorHandler completes login started by LoginHandler, code guesses are limited like passwords
+func (service *SessionService) SecondFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		ChallengeID string `json:"challengeId"`
+		Code        string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	challenge, err := service.totp.FindChallenge(totp.ChallengeID(data.ChallengeID))
+	if err == totp.ErrChallengeNotFound {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+	u, err := service.users.ReadUser(challenge.UserID)
 	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	ip := ClientIP(r)
+	retryAfter, err := service.attempts.Reserve(u.Username, ip)
+	if err == attempt.ErrTooManyAttempts {
+		service.failedLogins.WithLabelValues("locked").Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = io.WriteString(w, "Too many login attempts")
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	_, err = service.totp.CompleteChallenge(challenge.ID, data.Code)
+	switch err {
+	case nil:
+		if err = service.attempts.Release(u.Username, ip); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, err.Error())
+			return
+		}
+		service.startSession(w, r, u)
+	case totp.ErrInvalidCode:
+		service.failedLogins.WithLabelValues("invalid_code").Inc()
 		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, "Invalid code")
+	case totp.ErrChallengeNotFound:
+		// code is not checked for exhausted or expired challenge, so it is not a guess
+		_ = service.attempts.Release(u.Username, ip)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, err.Error())
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+	}
+}
+
+// startSession is the last step of the login, all factors are verified here
+func (service *SessionService) startSession(w http.ResponseWriter, r *http.Request, u *user.User) {
+	if err := service.attempts.Succeeded(u.Username); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		_, _ = io.WriteString(w, err.Error())
 		return
 	}
 
-	if service.encoder.Encode(data.Password) != u.EncodedPass {
+	ip := ClientIP(r)
+	s, refreshToken, err := service.sessions.Start(u, session.Client{
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+	if err = service.trail.Record(audit.Actor{UserID: u.ID, IP: ip}, audit.ActionLogin, u.ID, nil); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	service.writeSession(w, s, refreshToken)
+}
+
+// RefreshHandler accepts refresh token from the cookie or from the body for non-browser clients.
+// Sessions of OAuth clients are refreshed by the token endpoint only, here they would get unscoped tokens and cookies
+func (service *SessionService) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if c, err := r.Cookie(refreshTokenCookie); err == nil {
+		data.RefreshToken = c.Value
+	} else if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		_, _ = io.WriteString(w, "Invalid password")
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	s, refreshToken, err := service.sessions.Refresh(data.RefreshToken, "")
+	switch err {
+	case nil:
+		service.writeSession(w, s, refreshToken)
+	case session.ErrSessionNotFound, session.ErrInvalidRefreshToken, session.ErrRefreshTokenReused, session.ErrWrongClient:
+		clearCookies(w)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, err.Error())
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+	}
+}
+
+// JWKSHandler publishes public keys, so other services can verify access tokens locally
+func (service *SessionService) JWKSHandler(w http.ResponseWriter, _ *http.Request) {
+	keySet, err := service.tokens.KeySet()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
 		return
 	}
 
-	sessionID := generateSessionID()
-	service.sessions[sessionID] = session{
-		id:        string(u.ID),
-		login:     u.Username,
-		email:     string(u.Email),
-		firstName: u.FirstName,
-		lastName:  u.LastName,
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(keySet)
+}
+
+// LogoutHandler records logout only for the active session, expired session is already logged out
+func (service *SessionService) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if sessionID, err := r.Cookie(sessionCookie); err == nil {
+		s, err := service.sessions.Find(session.ID(sessionID.Value))
+		if err != nil && err != session.ErrSessionNotFound {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, err.Error())
+			return
+		}
+		if err = service.sessions.Revoke(session.ID(sessionID.Value)); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, err.Error())
+			return
+		}
+		if s != nil {
+			if err = service.trail.Record(audit.Actor{UserID: s.UserID, IP: ClientIP(r)}, audit.ActionLogout, s.UserID, nil); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = io.WriteString(w, err.Error())
+				return
+			}
+		}
 	}
 
-	c := &http.Cookie{
+	clearCookies(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeSession sets cookies living until the session can't be renewed anymore,
+// server side expiration is controlled by the session itself
+func (service *SessionService) writeSession(w http.ResponseWriter, s *session.Session, refreshToken string) {
+	accessToken, expiresAt, err := service.tokens.IssueAccessToken(token.SessionClaims(s))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	maxExpiresAt := service.sessions.MaxExpiresAt(s)
+	http.SetCookie(w, &http.Cookie{
 		Name:    sessionCookie,
-		Value:   sessionID,
+		Value:   string(s.ID),
 		Path:    "/",
-		Expires: time.Now().Local().Add(time.Minute * 15),
+		Expires: maxExpiresAt,
 
 		HttpOnly: true,
-	}
-	http.SetCookie(w, c)
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:    refreshTokenCookie,
+		Value:   refreshToken,
+		Path:    refreshTokenPath,
+		Expires: maxExpiresAt,
+
+		HttpOnly: true,
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(expiresAt).Seconds()),
+		RefreshToken: refreshToken,
+	})
 }
 
-func (service *SessionService) LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	c := &http.Cookie{
+func clearCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
 		Name:    sessionCookie,
 		Value:   "",
 		Path:    "/",
 		Expires: time.Unix(0, 0),
 
 		HttpOnly: true,
-	}
-	http.SetCookie(w, c)
-	w.WriteHeader(http.StatusOK)
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:    refreshTokenCookie,
+		Value:   "",
+		Path:    refreshTokenPath,
+		Expires: time.Unix(0, 0),
 
-	if sessionID, err := r.Cookie(sessionCookie); err == nil {
-		delete(service.sessions, sessionID.Value)
-	}
+		HttpOnly: true,
+	})
 }
 
-func generateSessionID() string {
-	return uuid.New().String()
+// ClientIP takes the rightmost X-Forwarded-For hop, it is appended by the ingress itself,
+// hops before it come from the client and can be spoofed. RemoteAddr is the ingress itself behind it
+func ClientIP(r *http.Request) string {
+	if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := strings.Split(forwardedFor[len(forwardedFor)-1], ",")
+		if hop := strings.TrimSpace(hops[len(hops)-1]); hop != "" {
+			return hop
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/apikey"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user/usertest"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/login", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "10.0.0.1", ClientIP(r))
+
+	// the client sends its own header, the ingress appends the address it has seen
+	r.Header.Add("X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+	r.Header.Add("X-Forwarded-For", "3.3.3.3, 4.4.4.4")
+	assert.Equal(t, "4.4.4.4", ClientIP(r))
+}
+
+func TestRefreshHandler_RejectsOAuthSession(t *testing.T) {
+	sessions := session.NewService(memory.NewSessionRepository(), time.Minute, time.Hour)
+	service := &SessionService{sessions: sessions}
+	s, refreshToken, err := sessions.Start(&user.User{ID: "1"}, session.Client{OAuthClientID: "mobile", OAuthScope: "openid"})
+	assert.Nil(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(`{"refreshToken":"`+refreshToken+`"}`))
+	w := httptest.NewRecorder()
+	service.RefreshHandler(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	for _, c := range w.Result().Cookies() {
+		assert.Empty(t, c.Value, "no session cookie is issued")
+	}
+
+	// the client keeps its session and refresh token
+	_, err = sessions.Find(s.ID)
+	assert.Nil(t, err)
+	_, _, err = sessions.Refresh(refreshToken, "mobile")
+	assert.Nil(t, err)
+}
+
+func TestAuthorizeAPIKey_ChecksOriginalMethod(t *testing.T) {
+	users := user.NewService(memory.NewUserRepository(memory.NewAuditRepository()), usertest.PlainEncoder{})
+	apiKeys := apikey.NewService(memory.NewAPIKeyRepository(), users)
+	service := &SessionService{apiKeys: apiKeys}
+	userID, err := users.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "pass")
+	assert.Nil(t, err)
+	_, secret, err := apiKeys.Create(userID, "warehouse", []apikey.Scope{apikey.ScopeRead})
+	assert.Nil(t, err)
+
+	for method, code := range map[string]int{
+		http.MethodGet:  http.StatusOK,
+		http.MethodPost: http.StatusForbidden,
+		// forward auth request is GET itself, so it can't stand for the original method
+		"": http.StatusForbidden,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/auth", nil)
+		if method != "" {
+			r.Header.Set("X-Forwarded-Method", method)
+		}
+		w := httptest.NewRecorder()
+		service.authorizeAPIKey(w, r, secret)
+		assert.Equal(t, code, w.Code, method)
+	}
+}
@@ -0,0 +1,453 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/attempt"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/oauth"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/totp"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+
+	consentAllow = "allow"
+)
+
+// scopeDescriptions are shown to the user before the client gets access
+var scopeDescriptions = map[string]string{
+	oauth.ScopeOpenID:  "Your account id",
+	oauth.ScopeProfile: "Your login and name",
+	oauth.ScopeEmail:   "Your email address",
+}
+
+// OAuthService is authorization server for apps which can't use cookie based login.
+// Users log in with the same credentials and limits as in LoginHandler
+type OAuthService struct {
+	*SessionService
+	oauth     *oauth.Service
+	publicURL string
+}
+
+// NewOAuthService publishes endpoints under publicURL, it is the address apps reach the ingress with
+func NewOAuthService(sessionService *SessionService, oauthService *oauth.Service, publicURL string) *OAuthService {
+	return &OAuthService{SessionService: sessionService, oauth: oauthService, publicURL: strings.TrimSuffix(publicURL, "/")}
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type userInfoResponse struct {
+	Subject       string `json:"sub"`
+	Login         string `json:"preferred_username,omitempty"`
+	FirstName     string `json:"given_name,omitempty"`
+	LastName      string `json:"family_name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+type discoveryResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+var loginFormTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.ClientName}}</title></head>
+<body>
+<h1>Sign in to {{.ClientName}}</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Scopes}}<p>By signing in you allow {{.ClientName}} to access:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<p><label>Login <input name="username" autocomplete="username"></label></p>
+<p><label>Password <input name="password" type="password" autocomplete="current-password"></label></p>
+<p><label>Two-factor code, if enabled <input name="otp" autocomplete="one-time-code"></label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body>
+</html>
+`))
+
+var consentFormTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Allow {{.ClientName}}</title></head>
+<body>
+<h1>Allow {{.ClientName}} to access your account {{.Login}}?</h1>
+{{if .Scopes}}<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<p><button type="submit" name="consent" value="allow">Allow</button>
+<button type="submit" name="consent" value="deny">Deny</button></p>
+</form>
+</body>
+</html>
+`))
+
+// AuthorizeHandler shows login form unless the browser already has a session, then asks the user to allow access
+// of the client and redirects back with the code. Submitted login form is the consent itself, it lists requested access
+func (service *OAuthService) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	req := oauth.AuthorizationRequest{
+		ResponseType:        r.Form.Get("response_type"),
+		ClientID:            oauth.ClientID(r.Form.Get("client_id")),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+	}
+	client, err := service.oauth.ValidateAuthorizationRequest(req)
+	switch err {
+	case nil:
+	case oauth.ErrInvalidClient, oauth.ErrInvalidRedirectURI:
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	case oauth.ErrUnsupportedResponseType, oauth.ErrInvalidRequest, oauth.ErrInvalidScope:
+		redirect(w, r, req.RedirectURI, url.Values{"error": {err.Error()}, "state": {req.State}})
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	s, u, err := service.sessionUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+	if u != nil {
+		// consent token binds the form to the session, so other sites can't submit it on behalf of the user
+		if r.Method != http.MethodPost || subtle.ConstantTimeCompare([]byte(r.PostForm.Get("consent_token")), []byte(consentToken(s.ID))) != 1 {
+			renderConsentForm(w, client, req, u, consentToken(s.ID))
+			return
+		}
+		if r.PostForm.Get("consent") != consentAllow {
+			redirect(w, r, req.RedirectURI, url.Values{"error": {oauth.ErrAccessDenied.Error()}, "state": {req.State}})
+			return
+		}
+	} else {
+		if r.Method != http.MethodPost {
+			renderLoginForm(w, http.StatusOK, client, req, "")
+			return
+		}
+		var message string
+		u, message, err = service.authenticateForm(r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, err.Error())
+			return
+		}
+		if u == nil {
+			renderLoginForm(w, http.StatusUnauthorized, client, req, message)
+			return
+		}
+	}
+
+	code, err := service.oauth.IssueCode(req, u.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+	redirect(w, r, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// TokenHandler accepts client credentials in basic auth or in the form
+func (service *OAuthService) TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauth.ErrInvalidRequest)
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	var tokenSet *oauth.TokenSet
+	var err error
+	switch r.PostForm.Get("grant_type") {
+	case grantTypeAuthorizationCode:
+		tokenSet, err = service.oauth.ExchangeCode(
+			oauth.ClientID(clientID),
+			clientSecret,
+			r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"),
+			session.Client{UserAgent: r.UserAgent(), IP: ClientIP(r)},
+		)
+	case grantTypeRefreshToken:
+		tokenSet, err = service.oauth.Refresh(oauth.ClientID(clientID), clientSecret, r.PostForm.Get("refresh_token"))
+	default:
+		err = oauth.ErrUnsupportedGrantType
+	}
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(oauthTokenResponse{
+		AccessToken:  tokenSet.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(tokenSet.ExpiresAt).Seconds()),
+		RefreshToken: tokenSet.RefreshToken,
+		IDToken:      tokenSet.IDToken,
+		Scope:        tokenSet.Scope,
+	})
+}
+
+func (service *OAuthService) UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// deleted user can't be told apart from invalid token for the client
+	claims, err := service.oauth.UserInfo(accessToken)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	response := userInfoResponse{
+		Subject:   claims.Subject,
+		Login:     claims.Login,
+		FirstName: claims.FirstName,
+		LastName:  claims.LastName,
+		Email:     claims.Email,
+	}
+	if claims.Email != "" {
+		response.EmailVerified = &claims.EmailVerified
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (service *OAuthService) DiscoveryHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(discoveryResponse{
+		Issuer:                            service.tokens.Issuer(),
+		AuthorizationEndpoint:             service.publicURL + "/oauth/authorize",
+		TokenEndpoint:                     service.publicURL + "/oauth/token",
+		UserInfoEndpoint:                  service.publicURL + "/oauth/userinfo",
+		JWKSURI:                           service.publicURL + "/.well-known/jwks.json",
+		ScopesSupported:                   oauth.SupportedScopes,
+		ResponseTypesSupported:            []string{oauth.ResponseTypeCode},
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		CodeChallengeMethodsSupported:     []string{oauth.CodeChallengeMethodS256},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+// sessionUser returns the browser session and its user, nil means there is no session
+func (service *OAuthService) sessionUser(r *http.Request) (*session.Session, *user.User, error) {
+	sessionID, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, nil, nil
+	}
+	s, err := service.sessions.Find(session.ID(sessionID.Value))
+	if err == session.ErrSessionNotFound {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	u, err := service.users.ReadUser(s.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, u, nil
+}
+
+// authenticateForm returns nil user and message for the form when credentials are not accepted
+func (service *OAuthService) authenticateForm(r *http.Request) (*user.User, string, error) {
+	username := r.PostForm.Get("username")
+	ip := ClientIP(r)
+	if _, err := service.attempts.Reserve(username, ip); err == attempt.ErrTooManyAttempts {
+		service.failedLogins.WithLabelValues("locked").Inc()
+		return nil, "Too many login attempts, try again later", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	u, err := service.users.Authenticate(username, r.PostForm.Get("password"))
+	if err == user.ErrInvalidPassword || err == user.ErrUserNotFound {
+		service.failedLogins.WithLabelValues("invalid_credentials").Inc()
+		return nil, "Invalid login or password", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	secondFactorEnabled, err := service.totp.Enabled(u.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	if secondFactorEnabled {
+		err = service.totp.Verify(u.ID, r.PostForm.Get("otp"))
+		if err == totp.ErrInvalidCode {
+			service.failedLogins.WithLabelValues("invalid_code").Inc()
+			return nil, "Invalid two-factor code", nil
+		} else if err != nil {
+			return nil, "", err
+		}
+	}
+	if err = service.attempts.Release(username, ip); err != nil {
+		return nil, "", err
+	}
+	if err = service.attempts.Succeeded(username); err != nil {
+		return nil, "", err
+	}
+	return u, "", service.trail.Record(audit.Actor{UserID: u.ID, IP: ip}, audit.ActionLogin, u.ID, nil)
+}
+
+func renderLoginForm(w http.ResponseWriter, status int, client *oauth.Client, req oauth.AuthorizationRequest, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// the form must not be framed by other sites, otherwise credentials could be captured by clickjacking
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	_ = loginFormTemplate.Execute(w, map[string]interface{}{
+		"ClientName": client.Name,
+		"Message":    message,
+		"Scopes":     describeScope(req.Scope),
+		"Params":     authorizationParams(req),
+	})
+}
+
+func renderConsentForm(w http.ResponseWriter, client *oauth.Client, req oauth.AuthorizationRequest, u *user.User, token string) {
+	params := authorizationParams(req)
+	params["consent_token"] = token
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(http.StatusOK)
+	_ = consentFormTemplate.Execute(w, map[string]interface{}{
+		"ClientName": client.Name,
+		"Login":      u.Username,
+		"Scopes":     describeScope(req.Scope),
+		"Params":     params,
+	})
+}
+
+func authorizationParams(req oauth.AuthorizationRequest) map[string]string {
+	return map[string]string{
+		"response_type":         req.ResponseType,
+		"client_id":             string(req.ClientID),
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+	}
+}
+
+func describeScope(scope string) []string {
+	var descriptions []string
+	for _, s := range strings.Fields(scope) {
+		descriptions = append(descriptions, scopeDescriptions[s])
+	}
+	return descriptions
+}
+
+// consentToken can't be computed by other sites, the session id is only in the http only cookie
+func consentToken(id session.ID) string {
+	sum := sha256.Sum256([]byte("consent:" + string(id)))
+	return hex.EncodeToString(sum[:])
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+	query := target.Query()
+	for name, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(name, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func writeOAuthError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch err {
+	case oauth.ErrInvalidClient:
+		status = http.StatusUnauthorized
+	case oauth.ErrInvalidRequest, oauth.ErrInvalidGrant, oauth.ErrUnsupportedGrantType, oauth.ErrInvalidScope:
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimPrefix(authorization, "Bearer "), true
+}
@@ -0,0 +1,47 @@
+package encoding
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const bcryptPrefix = "$2"
+
+// BcryptEncoder uses per-password salt, hash looks like $2a$<cost>$<salt><hash>
+func BcryptEncoder(cost int) Scheme {
+	return &bcryptEncoder{cost: cost}
+}
+
+type bcryptEncoder struct {
+	cost int
+}
+
+func (e *bcryptEncoder) Encode(pass string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), e.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (e *bcryptEncoder) Verify(pass, encodedPass string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedPass), []byte(pass))
+	switch err {
+	case nil:
+		return true, nil
+	case bcrypt.ErrMismatchedHashAndPassword:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (e *bcryptEncoder) NeedsRehash(encodedPass string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedPass))
+	return err != nil || cost != e.cost
+}
+
+func (e *bcryptEncoder) Recognizes(encodedPass string) bool {
+	return strings.HasPrefix(encodedPass, bcryptPrefix)
+}
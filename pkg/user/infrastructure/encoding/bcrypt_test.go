@@ -0,0 +1,31 @@
+package encoding
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptEncoder(t *testing.T) {
+	encoder := BcryptEncoder(bcrypt.MinCost)
+	encodedPass, err := encoder.Encode("pass")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(encodedPass, bcryptPrefix))
+	assert.True(t, encoder.Recognizes(encodedPass))
+
+	otherEncodedPass, err := encoder.Encode("pass")
+	assert.Nil(t, err)
+	assert.NotEqual(t, encodedPass, otherEncodedPass, "each password gets its own salt")
+
+	ok, err := encoder.Verify("pass", encodedPass)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = encoder.Verify("wrong pass", encodedPass)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.False(t, encoder.NeedsRehash(encodedPass))
+	assert.True(t, BcryptEncoder(bcrypt.MinCost+1).NeedsRehash(encodedPass), "hash of another cost is upgraded")
+}
@@ -0,0 +1,52 @@
+package encoding
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// Scheme is a single hashing algorithm which can tell its own hashes apart
+type Scheme interface {
+	user.PassEncoder
+	Recognizes(encodedPass string) bool
+}
+
+// NewPassEncoder encodes new passwords with current scheme and still verifies hashes of legacy schemes,
+// such hashes are reported as needing rehash so they are upgraded on the next successful login
+func NewPassEncoder(current Scheme, legacy ...Scheme) user.PassEncoder {
+	return &passEncoder{current: current, schemes: append([]Scheme{current}, legacy...)}
+}
+
+var errUnknownHashScheme = errors.New("unknown password hash scheme")
+
+type passEncoder struct {
+	current Scheme
+	schemes []Scheme
+}
+
+func (e *passEncoder) Encode(pass string) (string, error) {
+	return e.current.Encode(pass)
+}
+
+func (e *passEncoder) Verify(pass, encodedPass string) (bool, error) {
+	scheme := e.scheme(encodedPass)
+	if scheme == nil {
+		return false, errors.WithStack(errUnknownHashScheme)
+	}
+	return scheme.Verify(pass, encodedPass)
+}
+
+func (e *passEncoder) NeedsRehash(encodedPass string) bool {
+	scheme := e.scheme(encodedPass)
+	return scheme != e.current || scheme.NeedsRehash(encodedPass)
+}
+
+func (e *passEncoder) scheme(encodedPass string) Scheme {
+	for _, scheme := range e.schemes {
+		if scheme.Recognizes(encodedPass) {
+			return scheme
+		}
+	}
+	return nil
+}
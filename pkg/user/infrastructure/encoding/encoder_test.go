@@ -0,0 +1,57 @@
+package encoding
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/memory"
+)
+
+func TestPassEncoder(t *testing.T) {
+	encoder := NewPassEncoder(BcryptEncoder(bcrypt.MinCost), MD5Encoder())
+	encodedPass, err := encoder.Encode("pass")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(encodedPass, bcryptPrefix), "new passwords use the current scheme")
+	assert.False(t, encoder.NeedsRehash(encodedPass))
+	ok, err := encoder.Verify("pass", encodedPass)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	legacyEncodedPass := "098f6bcd4621d373cade4e832627b4f6"
+	ok, err = encoder.Verify("test", legacyEncodedPass)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = encoder.Verify("wrong pass", legacyEncodedPass)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.True(t, encoder.NeedsRehash(legacyEncodedPass))
+
+	_, err = encoder.Verify("pass", "plain text")
+	assert.NotNil(t, err, "unknown scheme is not verified")
+}
+
+func TestPassEncoder_LegacyHashIsRehashedOnLogin(t *testing.T) {
+	repo := memory.NewUserRepository(memory.NewAuditRepository())
+	legacyService := user.NewService(repo, NewPassEncoder(MD5Encoder()))
+	userID, err := legacyService.CreateUser(user.Actor{}, "username", "first name", "last name", "some@email.ru", "+79001234567", "test")
+	assert.Nil(t, err)
+	u, err := repo.Find(userID)
+	assert.Nil(t, err)
+	assert.Equal(t, "098f6bcd4621d373cade4e832627b4f6", u.EncodedPass)
+
+	encoder := NewPassEncoder(BcryptEncoder(bcrypt.MinCost), MD5Encoder())
+	service := user.NewService(repo, encoder)
+	_, err = service.Authenticate("username", "test")
+	assert.Nil(t, err)
+
+	u, err = repo.Find(userID)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(u.EncodedPass, bcryptPrefix))
+	assert.False(t, encoder.NeedsRehash(u.EncodedPass))
+	_, err = service.Authenticate("username", "test")
+	assert.Nil(t, err, "password still works after rehash")
+}
@@ -2,14 +2,33 @@ package encoding
 
 import (
 	"crypto/md5"
+	"crypto/subtle"
 	"fmt"
-
-	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"regexp"
 )
 
-func MD5Encoder() user.EncoderFunc {
-	return func(s string) string {
-		data := []byte(s)
-		return fmt.Sprintf("%x", md5.Sum(data))
-	}
+var md5HashRegexp = regexp.MustCompile("^[0-9a-f]{32}$")
+
+// MD5Encoder is a legacy unsalted scheme, it is kept only to verify passwords stored before bcrypt
+func MD5Encoder() Scheme {
+	return &md5Encoder{}
+}
+
+type md5Encoder struct{}
+
+func (e *md5Encoder) Encode(pass string) (string, error) {
+	return fmt.Sprintf("%x", md5.Sum([]byte(pass))), nil
+}
+
+func (e *md5Encoder) Verify(pass, encodedPass string) (bool, error) {
+	encoded, _ := e.Encode(pass)
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(encodedPass)) == 1, nil
+}
+
+func (e *md5Encoder) NeedsRehash(string) bool {
+	return true
+}
+
+func (e *md5Encoder) Recognizes(encodedPass string) bool {
+	return md5HashRegexp.MatchString(encodedPass)
 }
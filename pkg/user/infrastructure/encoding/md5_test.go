@@ -0,0 +1,31 @@
+package encoding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMD5Encoder(t *testing.T) {
+	encoder := MD5Encoder()
+	encodedPass, err := encoder.Encode("test")
+	assert.Nil(t, err)
+	assert.Equal(t, "098f6bcd4621d373cade4e832627b4f6", encodedPass)
+
+	ok, err := encoder.Verify("test", encodedPass)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = encoder.Verify("wrong pass", encodedPass)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.True(t, encoder.NeedsRehash(encodedPass), "legacy hash is always upgraded")
+}
+
+func TestMD5Encoder_Recognizes(t *testing.T) {
+	encoder := MD5Encoder()
+	assert.True(t, encoder.Recognizes("098f6bcd4621d373cade4e832627b4f6"))
+	assert.False(t, encoder.Recognizes("098F6BCD4621D373CADE4E832627B4F6"))
+	assert.False(t, encoder.Recognizes("098f6bcd4621d373cade4e832627b4f"))
+	assert.False(t, encoder.Recognizes("$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"))
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/address"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewAddressRepository() address.Repository {
+	return &addressRepository{addresses: make(map[address.ID]address.Address)}
+}
+
+type addressRepository struct {
+	mu        sync.Mutex
+	addresses map[address.ID]address.Address
+}
+
+func (repo *addressRepository) Store(a *address.Address) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored := *a
+	if existing, ok := repo.addresses[a.ID]; ok {
+		stored.IsDefault = existing.IsDefault
+	}
+	repo.addresses[a.ID] = stored
+	return nil
+}
+
+func (repo *addressRepository) Find(id address.ID) (*address.Address, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	a, ok := repo.addresses[id]
+	if !ok {
+		return nil, address.ErrAddressNotFound
+	}
+	return &a, nil
+}
+
+func (repo *addressRepository) FindByUserID(userID user.ID) ([]address.Address, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var addresses []address.Address
+	for _, a := range repo.addresses {
+		if a.UserID == userID {
+			addresses = append(addresses, a)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].CreatedAt.Before(addresses[j].CreatedAt)
+	})
+	return addresses, nil
+}
+
+func (repo *addressRepository) SetDefault(userID user.ID, id address.ID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for addressID, a := range repo.addresses {
+		if a.UserID == userID {
+			a.IsDefault = addressID == id
+			repo.addresses[addressID] = a
+		}
+	}
+	return nil
+}
+
+func (repo *addressRepository) Remove(id address.ID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	delete(repo.addresses, id)
+	return nil
+}
+
+func (repo *addressRepository) RemoveByUserID(userID user.ID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for id, a := range repo.addresses {
+		if a.UserID == userID {
+			delete(repo.addresses, id)
+		}
+	}
+	return nil
+}
+
+func (repo *addressRepository) NextID() (address.ID, error) {
+	return address.ID(uuid.New().String()), nil
+}
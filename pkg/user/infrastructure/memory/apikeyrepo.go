@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/apikey"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewAPIKeyRepository() apikey.Repository {
+	return &apiKeyRepository{keys: make(map[apikey.ID]apikey.Key)}
+}
+
+type apiKeyRepository struct {
+	mu   sync.Mutex
+	keys map[apikey.ID]apikey.Key
+}
+
+func (repo *apiKeyRepository) Store(k *apikey.Key) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.keys[k.ID] = copyKey(*k)
+	return nil
+}
+
+func (repo *apiKeyRepository) MarkUsed(id apikey.ID, lastUsedAt time.Time) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	k, ok := repo.keys[id]
+	if !ok {
+		return apikey.ErrKeyNotFound
+	}
+	k.LastUsedAt = &lastUsedAt
+	repo.keys[id] = k
+	return nil
+}
+
+func (repo *apiKeyRepository) Find(id apikey.ID) (*apikey.Key, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	k, ok := repo.keys[id]
+	if !ok {
+		return nil, apikey.ErrKeyNotFound
+	}
+	k = copyKey(k)
+	return &k, nil
+}
+
+func (repo *apiKeyRepository) FindByUserID(userID user.ID) ([]apikey.Key, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var keys []apikey.Key
+	for _, k := range repo.keys {
+		if k.UserID == userID {
+			keys = append(keys, copyKey(k))
+		}
+	}
+	return keys, nil
+}
+
+func (repo *apiKeyRepository) Remove(id apikey.ID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	delete(repo.keys, id)
+	return nil
+}
+
+func (repo *apiKeyRepository) NextID() (apikey.ID, error) {
+	return apikey.ID(uuid.New().String()), nil
+}
+
+func copyKey(k apikey.Key) apikey.Key {
+	k.Scopes = append([]apikey.Scope(nil), k.Scopes...)
+	if k.LastUsedAt != nil {
+		lastUsedAt := *k.LastUsedAt
+		k.LastUsedAt = &lastUsedAt
+	}
+	return k
+}
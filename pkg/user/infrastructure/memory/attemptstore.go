@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/attempt"
+)
+
+// NewAttemptStore keeps login failures in process memory, each replica counts attempts separately
+func NewAttemptStore() attempt.Store {
+	return &attemptStore{failures: make(map[attempt.Key]attempt.Failures)}
+}
+
+type attemptStore struct {
+	mu       sync.Mutex
+	failures map[attempt.Key]attempt.Failures
+}
+
+func (store *attemptStore) Find(key attempt.Key) (attempt.Failures, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.failures[key], nil
+}
+
+func (store *attemptStore) Add(key attempt.Key, at time.Time, ttl time.Duration) (attempt.Failures, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for k, failures := range store.failures {
+		if at.Sub(failures.LastAt) >= ttl {
+			delete(store.failures, k)
+		}
+	}
+	failures := store.failures[key]
+	failures.Count++
+	failures.LastAt = at
+	store.failures[key] = failures
+	return failures, nil
+}
+
+func (store *attemptStore) Release(key attempt.Key) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if failures, ok := store.failures[key]; ok && failures.Count > 0 {
+		failures.Count--
+		store.failures[key] = failures
+	}
+	return nil
+}
+
+func (store *attemptStore) Remove(key attempt.Key) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.failures, key)
+	return nil
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+)
+
+func NewAuditRepository() audit.Repository {
+	return &auditRepository{}
+}
+
+type auditRepository struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (repo *auditRepository) Append(e *audit.Entry) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	entry := *e
+	entry.Changes = append([]audit.Change(nil), e.Changes...)
+	repo.entries = append(repo.entries, entry)
+	return nil
+}
+
+func (repo *auditRepository) Find(filter audit.Filter) ([]audit.Entry, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var entries []audit.Entry
+	for i := len(repo.entries) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		e := repo.entries[i]
+		if filter.UserID != "" && e.UserID != filter.UserID {
+			continue
+		}
+		if !filter.From.IsZero() && e.CreatedAt.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && !e.CreatedAt.Before(filter.To) {
+			continue
+		}
+		e.Changes = append([]audit.Change(nil), e.Changes...)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (repo *auditRepository) NextID() (audit.ID, error) {
+	return audit.ID(uuid.New().String()), nil
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/oauth"
+)
+
+func NewOAuthClientRepository() oauth.ClientRepository {
+	return &oauthClientRepository{clients: make(map[oauth.ClientID]oauth.Client)}
+}
+
+type oauthClientRepository struct {
+	mu      sync.RWMutex
+	clients map[oauth.ClientID]oauth.Client
+}
+
+func (repo *oauthClientRepository) Store(c *oauth.Client) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.clients[c.ID] = *c
+	return nil
+}
+
+func (repo *oauthClientRepository) Find(id oauth.ClientID) (*oauth.Client, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	c, ok := repo.clients[id]
+	if !ok {
+		return nil, oauth.ErrClientNotFound
+	}
+	return &c, nil
+}
+
+func (repo *oauthClientRepository) NextID() (oauth.ClientID, error) {
+	return oauth.ClientID(uuid.New().String()), nil
+}
+
+func NewAuthorizationCodeRepository() oauth.CodeRepository {
+	return &authorizationCodeRepository{codes: make(map[string]oauth.AuthorizationCode)}
+}
+
+type authorizationCodeRepository struct {
+	mu    sync.Mutex
+	codes map[string]oauth.AuthorizationCode
+}
+
+func (repo *authorizationCodeRepository) Store(c *oauth.AuthorizationCode) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.codes[c.Hash] = *c
+	return nil
+}
+
+func (repo *authorizationCodeRepository) Take(hash string) (*oauth.AuthorizationCode, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	c, ok := repo.codes[hash]
+	if !ok {
+		return nil, oauth.ErrInvalidGrant
+	}
+	delete(repo.codes, hash)
+	return &c, nil
+}
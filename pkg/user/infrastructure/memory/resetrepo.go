@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/reset"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewResetTokenRepository() reset.Repository {
+	return &resetTokenRepository{tokens: make(map[string]reset.Token)}
+}
+
+type resetTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]reset.Token
+}
+
+func (repo *resetTokenRepository) Store(t *reset.Token) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.tokens[t.Hash] = *t
+	return nil
+}
+
+func (repo *resetTokenRepository) Take(hash string) (*reset.Token, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	t, ok := repo.tokens[hash]
+	if !ok {
+		return nil, reset.ErrInvalidToken
+	}
+	delete(repo.tokens, hash)
+	return &t, nil
+}
+
+func (repo *resetTokenRepository) RemoveByUserID(userID user.ID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for hash, t := range repo.tokens {
+		if t.UserID == userID {
+			delete(repo.tokens, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// NewSessionRepository keeps sessions in process memory, use it for tests and single replica setups only
+func NewSessionRepository() session.Repository {
+	return &sessionRepository{sessions: make(map[session.ID]session.Session)}
+}
+
+type sessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[session.ID]session.Session
+}
+
+func (repo *sessionRepository) Store(s *session.Session) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	now := time.Now()
+	for id, stored := range repo.sessions {
+		if stored.RefreshExpired(now) {
+			delete(repo.sessions, id)
+		}
+	}
+	repo.sessions[s.ID] = *s
+	return nil
+}
+
+func (repo *sessionRepository) Update(s *session.Session) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	existing, ok := repo.sessions[s.ID]
+	if !ok || existing.RefreshExpired(time.Now()) {
+		return session.ErrSessionNotFound
+	}
+	stored := *s
+	stored.RefreshTokenID = existing.RefreshTokenID
+	stored.RefreshTokenHash = existing.RefreshTokenHash
+	repo.sessions[s.ID] = stored
+	return nil
+}
+
+func (repo *sessionRepository) Find(id session.ID) (*session.Session, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	s, ok := repo.sessions[id]
+	if !ok || s.RefreshExpired(time.Now()) {
+		return nil, session.ErrSessionNotFound
+	}
+	return &s, nil
+}
+
+func (repo *sessionRepository) FindByRefreshTokenID(tokenID string) (*session.Session, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	now := time.Now()
+	for _, s := range repo.sessions {
+		if s.RefreshTokenID == tokenID && !s.RefreshExpired(now) {
+			return &s, nil
+		}
+	}
+	return nil, session.ErrSessionNotFound
+}
+
+func (repo *sessionRepository) RotateRefreshToken(tokenID, oldHash, newHash string, lastSeenAt, expiresAt time.Time) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for id, s := range repo.sessions {
+		if s.RefreshTokenID == tokenID && s.RefreshTokenHash == oldHash {
+			s.RefreshTokenHash = newHash
+			s.LastSeenAt = lastSeenAt
+			s.ExpiresAt = expiresAt
+			repo.sessions[id] = s
+			return nil
+		}
+	}
+	return session.ErrRefreshTokenReused
+}
+
+func (repo *sessionRepository) FindByUserID(userID user.ID) ([]session.Session, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	now := time.Now()
+	var sessions []session.Session
+	for _, s := range repo.sessions {
+		if s.UserID == userID && !s.RefreshExpired(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (repo *sessionRepository) Remove(id session.ID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	delete(repo.sessions, id)
+	return nil
+}
+
+func (repo *sessionRepository) RemoveByUserID(userID user.ID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for id, s := range repo.sessions {
+		if s.UserID == userID {
+			delete(repo.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (repo *sessionRepository) NextID() (session.ID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return session.ID(id.String()), nil
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/totp"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewTOTPRepository() totp.Repository {
+	return &totpRepository{enrollments: make(map[user.ID]totp.Enrollment)}
+}
+
+type totpRepository struct {
+	mu          sync.Mutex
+	enrollments map[user.ID]totp.Enrollment
+}
+
+func (repo *totpRepository) Store(e *totp.Enrollment) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored := *e
+	stored.RecoveryCodeHashes = append([]string(nil), e.RecoveryCodeHashes...)
+	repo.enrollments[e.UserID] = stored
+	return nil
+}
+
+func (repo *totpRepository) Find(userID user.ID) (*totp.Enrollment, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, ok := repo.enrollments[userID]
+	if !ok {
+		return nil, totp.ErrNotEnrolled
+	}
+	e.RecoveryCodeHashes = append([]string(nil), e.RecoveryCodeHashes...)
+	return &e, nil
+}
+
+func (repo *totpRepository) Remove(userID user.ID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	delete(repo.enrollments, userID)
+	return nil
+}
+
+func (repo *totpRepository) AddFailedAttempt(userID user.ID) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	e, ok := repo.enrollments[userID]
+	if !ok {
+		return 0, totp.ErrNotEnrolled
+	}
+	e.FailedAttempts++
+	repo.enrollments[userID] = e
+	return e.FailedAttempts, nil
+}
+
+func NewChallengeRepository() totp.ChallengeRepository {
+	return &challengeRepository{challenges: make(map[totp.ChallengeID]totp.Challenge)}
+}
+
+type challengeRepository struct {
+	mu         sync.Mutex
+	challenges map[totp.ChallengeID]totp.Challenge
+}
+
+func (repo *challengeRepository) Store(c *totp.Challenge) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.challenges[c.ID] = *c
+	return nil
+}
+
+func (repo *challengeRepository) AddAttempt(id totp.ChallengeID) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	c, ok := repo.challenges[id]
+	if !ok {
+		return 0, totp.ErrChallengeNotFound
+	}
+	c.Attempts++
+	repo.challenges[id] = c
+	return c.Attempts, nil
+}
+
+func (repo *challengeRepository) Find(id totp.ChallengeID) (*totp.Challenge, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	c, ok := repo.challenges[id]
+	if !ok {
+		return nil, totp.ErrChallengeNotFound
+	}
+	return &c, nil
+}
+
+func (repo *challengeRepository) Remove(id totp.ChallengeID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	delete(repo.challenges, id)
+	return nil
+}
+
+func (repo *challengeRepository) NextID() (totp.ChallengeID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return totp.ChallengeID(id.String()), nil
+}
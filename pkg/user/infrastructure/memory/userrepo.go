@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// NewUserRepository keeps users in process memory, use it for tests only. Changes are appended to the trail under the same lock
+func NewUserRepository(trail audit.Repository) user.Repository {
+	return &userRepository{users: make(map[user.ID]user.User), trail: trail}
+}
+
+type userRepository struct {
+	mu    sync.RWMutex
+	users map[user.ID]user.User
+	trail audit.Repository
+}
+
+func (repo *userRepository) Store(u *user.User, change *user.Change) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	// the same guarantees as unique index and version condition in postgres
+	for _, stored := range repo.users {
+		if stored.Username == u.Username && stored.ID != u.ID {
+			return user.ErrDuplicateUsername
+		}
+	}
+	if stored, ok := repo.users[u.ID]; ok && stored.Version != u.Version {
+		return user.ErrVersionConflict
+	}
+	if err := repo.record(u.ID, u, change); err != nil {
+		return err
+	}
+	u.Version++
+	repo.users[u.ID] = *u
+	return nil
+}
+
+func (repo *userRepository) Find(id user.ID) (*user.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	u, ok := repo.users[id]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	return &u, nil
+}
+
+func (repo *userRepository) FindByUsername(username string) (*user.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	for _, u := range repo.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return nil, user.ErrUserNotFound
+}
+
+func (repo *userRepository) Remove(id user.ID, change *user.Change) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.users[id]; !ok {
+		return user.ErrUserNotFound
+	}
+	if err := repo.record(id, nil, change); err != nil {
+		return err
+	}
+	delete(repo.users, id)
+	return nil
+}
+
+func (repo *userRepository) record(id user.ID, after *user.User, change *user.Change) error {
+	if change == nil {
+		return nil
+	}
+	entryID, err := repo.trail.NextID()
+	if err != nil {
+		return err
+	}
+	entry := audit.UserEntry(entryID, id, after, *change, time.Now())
+	return repo.trail.Append(&entry)
+}
+
+func (repo *userRepository) NextID() (user.ID, error) {
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	return user.ID(id.String()), nil
+}
+
+func (repo *userRepository) Search(query user.SearchQuery) ([]user.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var users []user.User
+	for _, u := range repo.users {
+		if query.Matches(u) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return query.Less(query.SortKey(users[i]), query.SortKey(users[j]))
+	})
+	if len(users) > query.Limit {
+		users = users[:query.Limit]
+	}
+	return users, nil
+}
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/verification"
+)
+
+func NewVerificationTokenRepository() verification.Repository {
+	return &verificationTokenRepository{tokens: make(map[string]verification.Token)}
+}
+
+type verificationTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]verification.Token
+}
+
+func (repo *verificationTokenRepository) Store(t *verification.Token) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.tokens[t.Hash] = *t
+	return nil
+}
+
+func (repo *verificationTokenRepository) Take(hash string) (*verification.Token, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	t, ok := repo.tokens[hash]
+	if !ok {
+		return nil, verification.ErrInvalidToken
+	}
+	delete(repo.tokens, hash)
+	return &t, nil
+}
+
+func (repo *verificationTokenRepository) RemoveByUserID(userID user.ID) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for hash, t := range repo.tokens {
+		if t.UserID == userID {
+			delete(repo.tokens, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package notification
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// NewDiscardNotifier drops messages, only the fact of notification is logged, because texts carry reset and verification tokens
+func NewDiscardNotifier(logger logrus.FieldLogger) user.Notifier {
+	return &discardNotifier{logger: logger}
+}
+
+type discardNotifier struct {
+	logger logrus.FieldLogger
+}
+
+func (n *discardNotifier) Notify(u *user.User, subject, _ string) error {
+	n.logger.WithFields(logrus.Fields{
+		"user_id": u.ID,
+		"subject": subject,
+	}).Info("notification is discarded")
+	return nil
+}
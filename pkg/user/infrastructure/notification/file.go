@@ -0,0 +1,36 @@
+package notification
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// NewFileNotifier appends messages to the file, it stands in for the mail server locally
+func NewFileNotifier(path string) user.Notifier {
+	return &fileNotifier{path: path}
+}
+
+type fileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (n *fileNotifier) Notify(u *user.User, subject, text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), u.Email, subject, text)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
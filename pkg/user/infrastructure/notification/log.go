@@ -0,0 +1,25 @@
+package notification
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// NewLogNotifier writes messages to the log instead of sending them, use it for local development only
+func NewLogNotifier(logger logrus.FieldLogger) user.Notifier {
+	return &logNotifier{logger: logger}
+}
+
+type logNotifier struct {
+	logger logrus.FieldLogger
+}
+
+func (n *logNotifier) Notify(u *user.User, subject, text string) error {
+	n.logger.WithFields(logrus.Fields{
+		"user_id": u.ID,
+		"email":   u.Email,
+		"subject": subject,
+	}).Info(text)
+	return nil
+}
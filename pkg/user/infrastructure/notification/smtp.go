@@ -0,0 +1,51 @@
+package notification
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+// NewSMTPNotifier sends messages by email, username may be empty for servers without authentication
+func NewSMTPNotifier(addr, from, username, password string) user.Notifier {
+	var auth smtp.Auth
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpNotifier{addr: addr, from: from, auth: auth}
+}
+
+type smtpNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (n *smtpNotifier) Notify(u *user.User, subject, text string) error {
+	if u.Email == "" {
+		return errors.Errorf("user %s has no email", u.ID)
+	}
+
+	msg := strings.Join([]string{
+		fmt.Sprintf("From: %s", headerValue(n.from)),
+		fmt.Sprintf("To: %s", headerValue(string(u.Email))),
+		fmt.Sprintf("Subject: %s", headerValue(subject)),
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		text,
+	}, "\r\n")
+	return errors.WithStack(smtp.SendMail(n.addr, n.auth, n.from, []string{string(u.Email)}, []byte(msg)))
+}
+
+// headerLineBreaks would start new headers or the body, values must not inject them
+var headerLineBreaks = strings.NewReplacer("\r", "", "\n", "")
+
+func headerValue(value string) string {
+	return headerLineBreaks.Replace(value)
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/address"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewAddressRepository(db *sql.DB) address.Repository {
+	return &addressRepository{db: db}
+}
+
+type addressRepository struct {
+	db *sql.DB
+}
+
+func (repo *addressRepository) Store(a *address.Address) error {
+	sqlStatement := `
+		INSERT INTO addresses (id, user_id, recipient, phone, country, region, city, postal_code, line1, line2, is_default, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE SET recipient   = EXCLUDED.recipient,
+									   phone       = EXCLUDED.phone,
+									   country     = EXCLUDED.country,
+									   region      = EXCLUDED.region,
+									   city        = EXCLUDED.city,
+									   postal_code = EXCLUDED.postal_code,
+									   line1       = EXCLUDED.line1,
+									   line2       = EXCLUDED.line2;
+`
+	_, err := repo.db.Exec(sqlStatement, string(a.ID), string(a.UserID), a.Recipient, string(a.Phone), a.Country, a.Region, a.City, a.PostalCode, a.Line1, a.Line2, a.IsDefault, a.CreatedAt)
+	return err
+}
+
+func (repo *addressRepository) Find(id address.ID) (*address.Address, error) {
+	sqlStatement := `SELECT id, user_id, recipient, phone, country, region, city, postal_code, line1, line2, is_default, created_at FROM addresses WHERE id=$1;`
+	var a address.Address
+	row := repo.db.QueryRow(sqlStatement, string(id))
+	switch err := scanAddress(row, &a); err {
+	case sql.ErrNoRows:
+		return nil, address.ErrAddressNotFound
+	case nil:
+		return &a, nil
+	default:
+		return nil, err
+	}
+}
+
+func (repo *addressRepository) FindByUserID(userID user.ID) ([]address.Address, error) {
+	sqlStatement := `SELECT id, user_id, recipient, phone, country, region, city, postal_code, line1, line2, is_default, created_at FROM addresses WHERE user_id=$1 ORDER BY created_at;`
+	rows, err := repo.db.Query(sqlStatement, string(userID))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var addresses []address.Address
+	for rows.Next() {
+		var a address.Address
+		if err = scanAddress(rows, &a); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, errors.WithStack(rows.Err())
+}
+
+// SetDefault is a single statement, so the user never has two default addresses
+func (repo *addressRepository) SetDefault(userID user.ID, id address.ID) error {
+	_, err := repo.db.Exec("UPDATE addresses SET is_default = (id = $2) WHERE user_id = $1;", string(userID), string(id))
+	return err
+}
+
+func (repo *addressRepository) Remove(id address.ID) error {
+	sqlStatement := `
+		DELETE FROM addresses
+		WHERE id = $1;`
+	_, err := repo.db.Exec(sqlStatement, string(id))
+	return err
+}
+
+func (repo *addressRepository) RemoveByUserID(userID user.ID) error {
+	_, err := repo.db.Exec("DELETE FROM addresses WHERE user_id = $1;", string(userID))
+	return err
+}
+
+func (repo *addressRepository) NextID() (address.ID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return address.ID(id.String()), nil
+}
+
+func scanAddress(row scanner, a *address.Address) error {
+	return row.Scan(&a.ID, &a.UserID, &a.Recipient, &a.Phone, &a.Country, &a.Region, &a.City, &a.PostalCode, &a.Line1, &a.Line2, &a.IsDefault, &a.CreatedAt)
+}
@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/apikey"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewAPIKeyRepository(db *sql.DB) apikey.Repository {
+	return &apiKeyRepository{db: db}
+}
+
+type apiKeyRepository struct {
+	db *sql.DB
+}
+
+func (repo *apiKeyRepository) Store(k *apikey.Key) error {
+	sqlStatement := `
+		INSERT INTO api_keys (id, user_id, name, hash, scopes, created_at, last_used_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+`
+	var lastUsedAt sql.NullTime
+	if k.LastUsedAt != nil {
+		lastUsedAt = sql.NullTime{Time: *k.LastUsedAt, Valid: true}
+	}
+	_, err := repo.db.Exec(sqlStatement, string(k.ID), string(k.UserID), k.Name, k.Hash, formatScopes(k.Scopes), k.CreatedAt, lastUsedAt)
+	return err
+}
+
+func (repo *apiKeyRepository) MarkUsed(id apikey.ID, lastUsedAt time.Time) error {
+	result, err := repo.db.Exec(`UPDATE api_keys SET last_used_at = $2 WHERE id = $1;`, string(id), lastUsedAt)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return errors.WithStack(err)
+	} else if affected == 0 {
+		return apikey.ErrKeyNotFound
+	}
+	return nil
+}
+
+func (repo *apiKeyRepository) Find(id apikey.ID) (*apikey.Key, error) {
+	sqlStatement := `SELECT id, user_id, name, hash, scopes, created_at, last_used_at FROM api_keys WHERE id=$1;`
+	var k apikey.Key
+	row := repo.db.QueryRow(sqlStatement, string(id))
+	switch err := scanAPIKey(row, &k); err {
+	case sql.ErrNoRows:
+		return nil, apikey.ErrKeyNotFound
+	case nil:
+		return &k, nil
+	default:
+		return nil, err
+	}
+}
+
+func (repo *apiKeyRepository) FindByUserID(userID user.ID) ([]apikey.Key, error) {
+	sqlStatement := `SELECT id, user_id, name, hash, scopes, created_at, last_used_at FROM api_keys WHERE user_id=$1;`
+	rows, err := repo.db.Query(sqlStatement, string(userID))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var keys []apikey.Key
+	for rows.Next() {
+		var k apikey.Key
+		if err = scanAPIKey(rows, &k); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, errors.WithStack(rows.Err())
+}
+
+func (repo *apiKeyRepository) Remove(id apikey.ID) error {
+	sqlStatement := `
+		DELETE FROM api_keys
+		WHERE id = $1;`
+	_, err := repo.db.Exec(sqlStatement, string(id))
+	return err
+}
+
+func (repo *apiKeyRepository) NextID() (apikey.ID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return apikey.ID(id.String()), nil
+}
+
+func scanAPIKey(row scanner, k *apikey.Key) error {
+	var scopes string
+	var lastUsedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Hash, &scopes, &k.CreatedAt, &lastUsedAt)
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	for _, scope := range strings.Split(scopes, ",") {
+		if scope != "" {
+			k.Scopes = append(k.Scopes, apikey.Scope(scope))
+		}
+	}
+	return err
+}
+
+func formatScopes(scopes []apikey.Scope) string {
+	names := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		names = append(names, string(scope))
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/attempt"
+)
+
+func NewAttemptStore(db *sql.DB) attempt.Store {
+	return &attemptStore{db: db}
+}
+
+type attemptStore struct {
+	db *sql.DB
+}
+
+func (store *attemptStore) Find(key attempt.Key) (attempt.Failures, error) {
+	sqlStatement := `SELECT count, last_at FROM login_failures WHERE key=$1;`
+	var failures attempt.Failures
+	row := store.db.QueryRow(sqlStatement, string(key))
+	switch err := row.Scan(&failures.Count, &failures.LastAt); err {
+	case sql.ErrNoRows:
+		return attempt.Failures{}, nil
+	case nil:
+		return failures, nil
+	default:
+		return attempt.Failures{}, err
+	}
+}
+
+func (store *attemptStore) Add(key attempt.Key, at time.Time, ttl time.Duration) (attempt.Failures, error) {
+	sqlStatement := `
+		INSERT INTO login_failures (key, count, last_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET count   = CASE WHEN login_failures.last_at <= $3 THEN 1 ELSE login_failures.count + 1 END,
+										last_at = EXCLUDED.last_at
+		RETURNING count, last_at;
+`
+	var failures attempt.Failures
+	err := store.db.QueryRow(sqlStatement, string(key), at, at.Add(-ttl)).Scan(&failures.Count, &failures.LastAt)
+	if err != nil {
+		return attempt.Failures{}, err
+	}
+
+	// forgotten failures of other keys are collected here as well as expired sessions
+	_, err = store.db.Exec("DELETE FROM login_failures WHERE last_at <= $1;", at.Add(-ttl))
+	return failures, err
+}
+
+func (store *attemptStore) Release(key attempt.Key) error {
+	sqlStatement := `
+		UPDATE login_failures
+		SET count = count - 1
+		WHERE key = $1 AND count > 0;`
+	_, err := store.db.Exec(sqlStatement, string(key))
+	return err
+}
+
+func (store *attemptStore) Remove(key attempt.Key) error {
+	sqlStatement := `
+		DELETE FROM login_failures
+		WHERE key = $1;`
+	_, err := store.db.Exec(sqlStatement, string(key))
+	return err
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+)
+
+func NewAuditRepository(db *sql.DB) audit.Repository {
+	return &auditRepository{db: db}
+}
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+// auditChange fixes json format of the changes column, it doesn't depend on the model field names
+type auditChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// execer is either db or transaction, user repository appends entries in the transaction of the change
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (repo *auditRepository) Append(e *audit.Entry) error {
+	return appendAuditEntry(repo.db, e)
+}
+
+func appendAuditEntry(db execer, e *audit.Entry) error {
+	changes := make([]auditChange, 0, len(e.Changes))
+	for _, c := range e.Changes {
+		changes = append(changes, auditChange{Field: c.Field, Before: c.Before, After: c.After})
+	}
+	encodedChanges, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `
+		INSERT INTO audit_log (id, user_id, actor_id, actor_ip, action, changes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+`
+	_, err = db.Exec(sqlStatement, string(e.ID), string(e.UserID), string(e.Actor.UserID), e.Actor.IP, string(e.Action), string(encodedChanges), e.CreatedAt)
+	return errors.WithStack(err)
+}
+
+func (repo *auditRepository) Find(filter audit.Filter) ([]audit.Entry, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+	if filter.UserID != "" {
+		addCondition("user_id = ?", string(filter.UserID))
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < ?", filter.To)
+	}
+
+	sqlStatement := `SELECT id, user_id, actor_id, actor_ip, action, changes, created_at FROM audit_log`
+	if len(conditions) > 0 {
+		sqlStatement += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	sqlStatement += ` ORDER BY created_at DESC LIMIT $` + strconv.Itoa(len(args)) + `;`
+
+	rows, err := repo.db.Query(sqlStatement, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var entries []audit.Entry
+	for rows.Next() {
+		var e audit.Entry
+		if err = scanAuditEntry(rows, &e); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, errors.WithStack(rows.Err())
+}
+
+func (repo *auditRepository) NextID() (audit.ID, error) {
+	return nextAuditID()
+}
+
+func nextAuditID() (audit.ID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return audit.ID(id.String()), nil
+}
+
+func scanAuditEntry(row scanner, e *audit.Entry) error {
+	var encodedChanges string
+	if err := row.Scan(&e.ID, &e.UserID, &e.Actor.UserID, &e.Actor.IP, &e.Action, &encodedChanges, &e.CreatedAt); err != nil {
+		return err
+	}
+	var changes []auditChange
+	if err := json.Unmarshal([]byte(encodedChanges), &changes); err != nil {
+		return err
+	}
+	for _, c := range changes {
+		e.Changes = append(e.Changes, audit.Change{Field: c.Field, Before: c.Before, After: c.After})
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewUserEventQueue(db *sql.DB) user.EventQueue {
+	return &userEventQueue{db: db}
+}
+
+type userEventQueue struct {
+	db *sql.DB
+}
+
+func (queue *userEventQueue) Pending(limit int) ([]user.Event, error) {
+	rows, err := queue.db.Query(`SELECT id, type, user_id FROM user_events ORDER BY created_at, id LIMIT $1;`, limit)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var events []user.Event
+	for rows.Next() {
+		var e user.Event
+		if err = rows.Scan(&e.ID, &e.Type, &e.UserID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		events = append(events, e)
+	}
+	return events, errors.WithStack(rows.Err())
+}
+
+func (queue *userEventQueue) Remove(id string) error {
+	_, err := queue.db.Exec(`DELETE FROM user_events WHERE id = $1;`, id)
+	return errors.WithStack(err)
+}
+
+// queueEvent is called in the transaction of the change, the event is published after commit only
+func queueEvent(tx *sql.Tx, eventType user.EventType, userID user.ID) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO user_events (id, type, user_id, created_at) VALUES ($1, $2, $3, $4);`,
+		id.String(), string(eventType), string(userID), time.Now())
+	return errors.WithStack(err)
+}
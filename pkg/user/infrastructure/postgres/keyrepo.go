@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/token"
+)
+
+func NewKeyRepository(db *sql.DB) token.KeyRepository {
+	return &keyRepository{db: db}
+}
+
+const privateKeyPEMType = "RSA PRIVATE KEY"
+
+type keyRepository struct {
+	db *sql.DB
+}
+
+func (repo *keyRepository) FindAll() ([]token.SigningKey, error) {
+	sqlStatement := `SELECT id, private_key, created_at FROM signing_keys;`
+	rows, err := repo.db.Query(sqlStatement)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var keys []token.SigningKey
+	for rows.Next() {
+		var key token.SigningKey
+		var privateKeyPEM string
+		err = rows.Scan(&key.ID, &privateKeyPEM, &key.CreatedAt)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		block, _ := pem.Decode([]byte(privateKeyPEM))
+		if block == nil {
+			return nil, errors.Errorf("invalid private key %s", key.ID)
+		}
+		key.PrivateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, errors.WithStack(rows.Err())
+}
+
+func (repo *keyRepository) Store(key *token.SigningKey) error {
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  privateKeyPEMType,
+		Bytes: x509.MarshalPKCS1PrivateKey(key.PrivateKey),
+	})
+	sqlStatement := `
+		INSERT INTO signing_keys (id, private_key, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO NOTHING;
+`
+	_, err := repo.db.Exec(sqlStatement, string(key.ID), string(privateKeyPEM), key.CreatedAt)
+	return err
+}
+
+func (repo *keyRepository) Remove(id token.KeyID) error {
+	sqlStatement := `
+		DELETE FROM signing_keys
+		WHERE id = $1;`
+	_, err := repo.db.Exec(sqlStatement, string(id))
+	return err
+}
+
+func (repo *keyRepository) NextID() (token.KeyID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return token.KeyID(id.String()), nil
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/oauth"
+)
+
+func NewOAuthClientRepository(db *sql.DB) oauth.ClientRepository {
+	return &oauthClientRepository{db: db}
+}
+
+type oauthClientRepository struct {
+	db *sql.DB
+}
+
+func (repo *oauthClientRepository) Store(c *oauth.Client) error {
+	sqlStatement := `
+		INSERT INTO oauth_clients (id, secret_hash, name, redirect_uris)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET secret_hash   = EXCLUDED.secret_hash,
+									   name          = EXCLUDED.name,
+									   redirect_uris = EXCLUDED.redirect_uris;
+`
+	_, err := repo.db.Exec(sqlStatement, string(c.ID), c.SecretHash, c.Name, strings.Join(c.RedirectURIs, " "))
+	return err
+}
+
+func (repo *oauthClientRepository) Find(id oauth.ClientID) (*oauth.Client, error) {
+	sqlStatement := `SELECT id, secret_hash, name, redirect_uris FROM oauth_clients WHERE id=$1;`
+	var c oauth.Client
+	var redirectURIs string
+	row := repo.db.QueryRow(sqlStatement, string(id))
+	switch err := row.Scan(&c.ID, &c.SecretHash, &c.Name, &redirectURIs); err {
+	case sql.ErrNoRows:
+		return nil, oauth.ErrClientNotFound
+	case nil:
+		// redirect uris can't contain spaces, so they are stored space separated
+		c.RedirectURIs = strings.Fields(redirectURIs)
+		return &c, nil
+	default:
+		return nil, err
+	}
+}
+
+func (repo *oauthClientRepository) NextID() (oauth.ClientID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return oauth.ClientID(id.String()), nil
+}
+
+func NewAuthorizationCodeRepository(db *sql.DB) oauth.CodeRepository {
+	return &authorizationCodeRepository{db: db}
+}
+
+type authorizationCodeRepository struct {
+	db *sql.DB
+}
+
+func (repo *authorizationCodeRepository) Store(c *oauth.AuthorizationCode) error {
+	sqlStatement := `
+		INSERT INTO authorization_codes (hash, client_id, user_id, redirect_uri, scope, code_challenge, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+`
+	_, err := repo.db.Exec(sqlStatement, c.Hash, string(c.ClientID), string(c.UserID), c.RedirectURI, c.Scope, c.CodeChallenge, c.Nonce, c.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.db.Exec("DELETE FROM authorization_codes WHERE expires_at <= now();")
+	return err
+}
+
+func (repo *authorizationCodeRepository) Take(hash string) (*oauth.AuthorizationCode, error) {
+	sqlStatement := `
+		DELETE FROM authorization_codes
+		WHERE hash = $1
+		RETURNING hash, client_id, user_id, redirect_uri, scope, code_challenge, nonce, expires_at;`
+	var c oauth.AuthorizationCode
+	row := repo.db.QueryRow(sqlStatement, hash)
+	switch err := row.Scan(&c.Hash, &c.ClientID, &c.UserID, &c.RedirectURI, &c.Scope, &c.CodeChallenge, &c.Nonce, &c.ExpiresAt); err {
+	case sql.ErrNoRows:
+		return nil, oauth.ErrInvalidGrant
+	case nil:
+		return &c, nil
+	default:
+		return nil, err
+	}
+}
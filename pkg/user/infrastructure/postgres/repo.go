@@ -2,12 +2,22 @@ package postgres
 
 import (
 	"database/sql"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
 	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
 )
 
+const (
+	uniqueViolationCode      = "23505"
+	uniqueUsernameConstraint = "uniq_username"
+)
+
 func NewUserRepository(db *sql.DB) user.Repository {
 	return &userRepository{db: db}
 }
@@ -16,28 +26,103 @@ type userRepository struct {
 	db *sql.DB
 }
 
-func (repo *userRepository) Store(user *user.User) error {
+// Store updates the row only when its version is not changed since the user is read, nothing is updated otherwise
+func (repo *userRepository) Store(u *user.User, change *user.Change) error {
 	sqlStatement := `
-		INSERT INTO users (id, username, firstname, lastname, email, phone, password)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		ON CONFLICT (id) DO UPDATE SET username  = EXCLUDED.username,
-									   firstname = EXCLUDED.firstname,
-									   lastname  = EXCLUDED.lastname,
-									   email     = EXCLUDED.email,
-									   phone     = EXCLUDED.phone;
+		INSERT INTO users (id, username, firstname, lastname, email, email_verified, phone, password, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9 + 1)
+		ON CONFLICT (id) DO UPDATE SET username       = EXCLUDED.username,
+									   firstname      = EXCLUDED.firstname,
+									   lastname       = EXCLUDED.lastname,
+									   email          = EXCLUDED.email,
+									   email_verified = EXCLUDED.email_verified,
+									   phone          = EXCLUDED.phone,
+									   password       = EXCLUDED.password,
+									   version        = EXCLUDED.version
+		WHERE users.version = $9;
 `
-	_, err := repo.db.Exec(sqlStatement, string(user.ID), user.Username, user.FirstName, user.LastName, string(user.Email), string(user.Phone), user.EncodedPass)
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result, err := tx.Exec(sqlStatement, string(u.ID), u.Username, u.FirstName, u.LastName, string(u.Email), u.EmailVerified, string(u.Phone), u.EncodedPass, u.Version)
+	if err != nil {
+		_ = tx.Rollback()
+		return translateStoreError(err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		_ = tx.Rollback()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return user.ErrVersionConflict
+	}
+	if err = storeRoles(tx, u); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = recordChange(tx, u.ID, u, change); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.WithStack(err)
+	}
+	u.Version++
+	return nil
+}
+
+// translateStoreError reports username taken by concurrent request, service check before store can't see it
+func translateStoreError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolationCode && pqErr.Constraint == uniqueUsernameConstraint {
+		return user.ErrDuplicateUsername
+	}
 	return err
 }
 
+func storeRoles(tx *sql.Tx, u *user.User) error {
+	_, err := tx.Exec("DELETE FROM user_roles WHERE user_id = $1;", string(u.ID))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, role := range u.Roles {
+		_, err = tx.Exec("INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT DO NOTHING;", string(u.ID), string(role))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (repo *userRepository) findRoles(u *user.User) error {
+	rows, err := repo.db.Query("SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role;", string(u.ID))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	u.Roles = nil
+	for rows.Next() {
+		var role string
+		if err = rows.Scan(&role); err != nil {
+			return errors.WithStack(err)
+		}
+		u.Roles = append(u.Roles, user.Role(role))
+	}
+	return errors.WithStack(rows.Err())
+}
+
 func (repo *userRepository) Find(id user.ID) (*user.User, error) {
-	sqlStatement := `SELECT id, username, firstname, lastname, email, phone, password FROM users WHERE id=$1;`
+	sqlStatement := `SELECT id, username, firstname, lastname, email, email_verified, phone, password, version FROM users WHERE id=$1;`
 	var u user.User
 	row := repo.db.QueryRow(sqlStatement, string(id))
-	switch err := row.Scan(&u.ID, &u.Username, &u.FirstName, &u.LastName, &u.Email, &u.Phone, &u.EncodedPass); err {
+	switch err := row.Scan(&u.ID, &u.Username, &u.FirstName, &u.LastName, &u.Email, &u.EmailVerified, &u.Phone, &u.EncodedPass, &u.Version); err {
 	case sql.ErrNoRows:
 		return nil, user.ErrUserNotFound
 	case nil:
+		if err = repo.findRoles(&u); err != nil {
+			return nil, err
+		}
 		return &u, nil
 	default:
 		return nil, err
@@ -45,25 +130,135 @@ func (repo *userRepository) Find(id user.ID) (*user.User, error) {
 }
 
 func (repo *userRepository) FindByUsername(username string) (*user.User, error) {
-	sqlStatement := `SELECT id, username, firstname, lastname, email, phone, password FROM users WHERE username=$1;`
+	sqlStatement := `SELECT id, username, firstname, lastname, email, email_verified, phone, password, version FROM users WHERE username=$1;`
 	var u user.User
 	row := repo.db.QueryRow(sqlStatement, username)
-	switch err := row.Scan(&u.ID, &u.Username, &u.FirstName, &u.LastName, &u.Email, &u.Phone, &u.EncodedPass); err {
+	switch err := row.Scan(&u.ID, &u.Username, &u.FirstName, &u.LastName, &u.Email, &u.EmailVerified, &u.Phone, &u.EncodedPass, &u.Version); err {
 	case sql.ErrNoRows:
 		return nil, user.ErrUserNotFound
 	case nil:
+		if err = repo.findRoles(&u); err != nil {
+			return nil, err
+		}
 		return &u, nil
 	default:
 		return nil, err
 	}
 }
 
-func (repo *userRepository) Remove(id user.ID) error {
-	sqlStatement := `
-		DELETE FROM users
-		WHERE id = $1;`
-	_, err := repo.db.Exec(sqlStatement, string(id))
-	return err
+// searchSortColumns maps sort field to the column, sort field is never put into query as is
+var searchSortColumns = map[user.SortField]string{
+	user.SortByUsername: "username",
+	user.SortByEmail:    "email",
+}
+
+func (repo *userRepository) Search(query user.SearchQuery) ([]user.User, error) {
+	column, ok := searchSortColumns[query.SortBy]
+	if !ok {
+		return nil, user.ErrInvalidSearch
+	}
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	args := []interface{}{"%" + escapeLike(query.Text) + "%", query.Limit}
+	sqlStatement := `SELECT id, username, firstname, lastname, email, email_verified, phone, password, version FROM users
+		WHERE (username ILIKE $1 OR email ILIKE $1 OR phone ILIKE $1)`
+	if query.After != nil {
+		args = append(args, query.After.Value, string(query.After.ID))
+		sqlStatement += ` AND (` + column + `, id) ` + comparison + ` ($3, $4)`
+	}
+	sqlStatement += ` ORDER BY ` + column + ` ` + direction + `, id ` + direction + ` LIMIT $2;`
+
+	rows, err := repo.db.Query(sqlStatement, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var users []user.User
+	for rows.Next() {
+		var u user.User
+		if err = rows.Scan(&u.ID, &u.Username, &u.FirstName, &u.LastName, &u.Email, &u.EmailVerified, &u.Phone, &u.EncodedPass, &u.Version); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for i := range users {
+		if err = repo.findRoles(&users[i]); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// escapeLike makes wildcard characters of the search text match literally
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
+
+func (repo *userRepository) Remove(id user.ID, change *user.Change) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	result, err := tx.Exec("DELETE FROM users WHERE id = $1;", string(id))
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.WithStack(err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		_ = tx.Rollback()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return user.ErrUserNotFound
+	}
+	for _, table := range userDataTables {
+		if _, err = tx.Exec("DELETE FROM "+table+" WHERE user_id = $1;", string(id)); err != nil {
+			_ = tx.Rollback()
+			return errors.WithStack(err)
+		}
+	}
+	if err = queueEvent(tx, user.EventDeleted, id); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = recordChange(tx, id, nil, change); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// userDataTables keep credentials and tokens of the user, they are erased with the user.
+// Sessions and addresses are removed by their services
+var userDataTables = []string{
+	"user_roles",
+	"api_keys",
+	"totp_enrollments",
+	"login_challenges",
+	"password_reset_tokens",
+	"email_verification_tokens",
+	"authorization_codes",
+}
+
+// recordChange appends audit entry in the transaction of the change, so the change can't be stored without its entry
+func recordChange(tx *sql.Tx, id user.ID, after *user.User, change *user.Change) error {
+	if change == nil {
+		return nil
+	}
+	entryID, err := nextAuditID()
+	if err != nil {
+		return err
+	}
+	entry := audit.UserEntry(entryID, id, after, *change, time.Now())
+	return appendAuditEntry(tx, &entry)
 }
 
 func (repo *userRepository) NextID() (user.ID, error) {
@@ -0,0 +1,24 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func TestTranslateStoreError(t *testing.T) {
+	err := &pq.Error{Code: "23505", Constraint: "uniq_username"}
+	assert.Equal(t, user.ErrDuplicateUsername, translateStoreError(err))
+
+	// other unique constraints and other errors are returned as is
+	err = &pq.Error{Code: "23505", Constraint: "users_key"}
+	assert.Equal(t, err, translateStoreError(err))
+	err = &pq.Error{Code: "23503", Constraint: "uniq_username"}
+	assert.Equal(t, err, translateStoreError(err))
+	otherErr := errors.New("connection refused")
+	assert.Equal(t, otherErr, translateStoreError(otherErr))
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/reset"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewResetTokenRepository(db *sql.DB) reset.Repository {
+	return &resetTokenRepository{db: db}
+}
+
+type resetTokenRepository struct {
+	db *sql.DB
+}
+
+func (repo *resetTokenRepository) Store(t *reset.Token) error {
+	sqlStatement := `
+		INSERT INTO password_reset_tokens (hash, user_id, expires_at)
+		VALUES ($1, $2, $3);
+`
+	_, err := repo.db.Exec(sqlStatement, t.Hash, string(t.UserID), t.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.db.Exec("DELETE FROM password_reset_tokens WHERE expires_at <= now();")
+	return err
+}
+
+func (repo *resetTokenRepository) Take(hash string) (*reset.Token, error) {
+	sqlStatement := `
+		DELETE FROM password_reset_tokens
+		WHERE hash = $1
+		RETURNING hash, user_id, expires_at;`
+	var t reset.Token
+	row := repo.db.QueryRow(sqlStatement, hash)
+	switch err := row.Scan(&t.Hash, &t.UserID, &t.ExpiresAt); err {
+	case sql.ErrNoRows:
+		return nil, reset.ErrInvalidToken
+	case nil:
+		return &t, nil
+	default:
+		return nil, err
+	}
+}
+
+func (repo *resetTokenRepository) RemoveByUserID(userID user.ID) error {
+	sqlStatement := `
+		DELETE FROM password_reset_tokens
+		WHERE user_id = $1;`
+	_, err := repo.db.Exec(sqlStatement, string(userID))
+	return err
+}
@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewSessionRepository(db *sql.DB) session.Repository {
+	return &sessionRepository{db: db}
+}
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func (repo *sessionRepository) Store(s *session.Session) error {
+	sqlStatement := `
+		INSERT INTO sessions (id, user_id, login, email, email_verified, firstname, lastname, roles, refresh_token_id, refresh_token_hash, refresh_expires_at, user_agent, ip, oauth_client_id, oauth_scope, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18);
+`
+	_, err := repo.db.Exec(sqlStatement, string(s.ID), string(s.UserID), s.Login, s.Email, s.EmailVerified, s.FirstName, s.LastName, authz.FormatRoles(user.AuthzRoles(s.Roles)),
+		s.RefreshTokenID, s.RefreshTokenHash, s.RefreshExpiresAt, s.UserAgent, s.IP, s.OAuthClientID, s.OAuthScope, s.CreatedAt, s.LastSeenAt, s.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	// there is no background job, so expired sessions of the user are collected on each store
+	_, err = repo.db.Exec("DELETE FROM sessions WHERE user_id = $1 AND refresh_expires_at <= now();", string(s.UserID))
+	return err
+}
+
+func (repo *sessionRepository) Update(s *session.Session) error {
+	sqlStatement := `
+		UPDATE sessions SET login = $2, email = $3, email_verified = $4, firstname = $5, lastname = $6, roles = $7, last_seen_at = $8, expires_at = $9
+		WHERE id = $1 AND refresh_expires_at > now();`
+	result, err := repo.db.Exec(sqlStatement, string(s.ID), s.Login, s.Email, s.EmailVerified, s.FirstName, s.LastName, authz.FormatRoles(user.AuthzRoles(s.Roles)),
+		s.LastSeenAt, s.ExpiresAt)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if affected == 0 {
+		return session.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (repo *sessionRepository) Find(id session.ID) (*session.Session, error) {
+	sqlStatement := `SELECT id, user_id, login, email, email_verified, firstname, lastname, roles, refresh_token_id, refresh_token_hash, refresh_expires_at, user_agent, ip, oauth_client_id, oauth_scope, created_at, last_seen_at, expires_at
+						FROM sessions
+						WHERE id=$1 AND refresh_expires_at > now();`
+	var s session.Session
+	row := repo.db.QueryRow(sqlStatement, string(id))
+	switch err := scanSession(row, &s); err {
+	case sql.ErrNoRows:
+		return nil, session.ErrSessionNotFound
+	case nil:
+		return &s, nil
+	default:
+		return nil, err
+	}
+}
+
+func (repo *sessionRepository) FindByRefreshTokenID(tokenID string) (*session.Session, error) {
+	sqlStatement := `SELECT id, user_id, login, email, email_verified, firstname, lastname, roles, refresh_token_id, refresh_token_hash, refresh_expires_at, user_agent, ip, oauth_client_id, oauth_scope, created_at, last_seen_at, expires_at
+						FROM sessions
+						WHERE refresh_token_id=$1 AND refresh_expires_at > now();`
+	var s session.Session
+	row := repo.db.QueryRow(sqlStatement, tokenID)
+	switch err := scanSession(row, &s); err {
+	case sql.ErrNoRows:
+		return nil, session.ErrSessionNotFound
+	case nil:
+		return &s, nil
+	default:
+		return nil, err
+	}
+}
+
+func (repo *sessionRepository) RotateRefreshToken(tokenID, oldHash, newHash string, lastSeenAt, expiresAt time.Time) error {
+	sqlStatement := `
+		UPDATE sessions SET refresh_token_hash = $3, last_seen_at = $4, expires_at = $5
+		WHERE refresh_token_id = $1 AND refresh_token_hash = $2;`
+	result, err := repo.db.Exec(sqlStatement, tokenID, oldHash, newHash, lastSeenAt, expiresAt)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if affected == 0 {
+		return session.ErrRefreshTokenReused
+	}
+	return nil
+}
+
+func (repo *sessionRepository) FindByUserID(userID user.ID) ([]session.Session, error) {
+	sqlStatement := `SELECT id, user_id, login, email, email_verified, firstname, lastname, roles, refresh_token_id, refresh_token_hash, refresh_expires_at, user_agent, ip, oauth_client_id, oauth_scope, created_at, last_seen_at, expires_at
+						FROM sessions
+						WHERE user_id=$1 AND refresh_expires_at > now();`
+	rows, err := repo.db.Query(sqlStatement, string(userID))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var sessions []session.Session
+	for rows.Next() {
+		var s session.Session
+		if err = scanSession(rows, &s); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, errors.WithStack(rows.Err())
+}
+
+func (repo *sessionRepository) Remove(id session.ID) error {
+	sqlStatement := `
+		DELETE FROM sessions
+		WHERE id = $1;`
+	_, err := repo.db.Exec(sqlStatement, string(id))
+	return err
+}
+
+func (repo *sessionRepository) RemoveByUserID(userID user.ID) error {
+	sqlStatement := `
+		DELETE FROM sessions
+		WHERE user_id = $1;`
+	_, err := repo.db.Exec(sqlStatement, string(userID))
+	return err
+}
+
+func (repo *sessionRepository) NextID() (session.ID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return session.ID(id.String()), nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row scanner, s *session.Session) error {
+	var roles string
+	err := row.Scan(&s.ID, &s.UserID, &s.Login, &s.Email, &s.EmailVerified, &s.FirstName, &s.LastName, &roles, &s.RefreshTokenID, &s.RefreshTokenHash, &s.RefreshExpiresAt,
+		&s.UserAgent, &s.IP, &s.OAuthClientID, &s.OAuthScope, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	s.Roles = user.RolesFromAuthz(authz.ParseRoles(roles))
+	return err
+}
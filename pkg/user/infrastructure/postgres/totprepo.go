@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/totp"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewTOTPRepository(db *sql.DB) totp.Repository {
+	return &totpRepository{db: db}
+}
+
+type totpRepository struct {
+	db *sql.DB
+}
+
+func (repo *totpRepository) Store(e *totp.Enrollment) error {
+	sqlStatement := `
+		INSERT INTO totp_enrollments (user_id, secret, confirmed, last_used_step, recovery_codes, failed_attempts)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET secret          = EXCLUDED.secret,
+											confirmed       = EXCLUDED.confirmed,
+											last_used_step  = EXCLUDED.last_used_step,
+											recovery_codes  = EXCLUDED.recovery_codes,
+											failed_attempts = EXCLUDED.failed_attempts;
+`
+	_, err := repo.db.Exec(sqlStatement, string(e.UserID), e.Secret, e.Confirmed, e.LastUsedStep, strings.Join(e.RecoveryCodeHashes, ","), e.FailedAttempts)
+	return err
+}
+
+func (repo *totpRepository) Find(userID user.ID) (*totp.Enrollment, error) {
+	sqlStatement := `SELECT user_id, secret, confirmed, last_used_step, recovery_codes, failed_attempts FROM totp_enrollments WHERE user_id=$1;`
+	var e totp.Enrollment
+	var recoveryCodes string
+	row := repo.db.QueryRow(sqlStatement, string(userID))
+	switch err := row.Scan(&e.UserID, &e.Secret, &e.Confirmed, &e.LastUsedStep, &recoveryCodes, &e.FailedAttempts); err {
+	case sql.ErrNoRows:
+		return nil, totp.ErrNotEnrolled
+	case nil:
+		if recoveryCodes != "" {
+			e.RecoveryCodeHashes = strings.Split(recoveryCodes, ",")
+		}
+		return &e, nil
+	default:
+		return nil, err
+	}
+}
+
+func (repo *totpRepository) Remove(userID user.ID) error {
+	sqlStatement := `
+		DELETE FROM totp_enrollments
+		WHERE user_id = $1;`
+	_, err := repo.db.Exec(sqlStatement, string(userID))
+	return err
+}
+
+func (repo *totpRepository) AddFailedAttempt(userID user.ID) (int, error) {
+	sqlStatement := `
+		UPDATE totp_enrollments
+		SET failed_attempts = failed_attempts + 1
+		WHERE user_id = $1
+		RETURNING failed_attempts;`
+	var failedAttempts int
+	switch err := repo.db.QueryRow(sqlStatement, string(userID)).Scan(&failedAttempts); err {
+	case sql.ErrNoRows:
+		return 0, totp.ErrNotEnrolled
+	case nil:
+		return failedAttempts, nil
+	default:
+		return 0, err
+	}
+}
+
+func NewChallengeRepository(db *sql.DB) totp.ChallengeRepository {
+	return &challengeRepository{db: db}
+}
+
+type challengeRepository struct {
+	db *sql.DB
+}
+
+func (repo *challengeRepository) Store(c *totp.Challenge) error {
+	sqlStatement := `
+		INSERT INTO login_challenges (id, user_id, attempts, expires_at)
+		VALUES ($1, $2, $3, $4);
+`
+	_, err := repo.db.Exec(sqlStatement, string(c.ID), string(c.UserID), c.Attempts, c.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.db.Exec("DELETE FROM login_challenges WHERE expires_at <= now();")
+	return err
+}
+
+func (repo *challengeRepository) AddAttempt(id totp.ChallengeID) (int, error) {
+	sqlStatement := `
+		UPDATE login_challenges
+		SET attempts = attempts + 1
+		WHERE id = $1
+		RETURNING attempts;`
+	var attempts int
+	switch err := repo.db.QueryRow(sqlStatement, string(id)).Scan(&attempts); err {
+	case sql.ErrNoRows:
+		return 0, totp.ErrChallengeNotFound
+	case nil:
+		return attempts, nil
+	default:
+		return 0, err
+	}
+}
+
+func (repo *challengeRepository) Find(id totp.ChallengeID) (*totp.Challenge, error) {
+	sqlStatement := `SELECT id, user_id, attempts, expires_at FROM login_challenges WHERE id=$1;`
+	var c totp.Challenge
+	row := repo.db.QueryRow(sqlStatement, string(id))
+	switch err := row.Scan(&c.ID, &c.UserID, &c.Attempts, &c.ExpiresAt); err {
+	case sql.ErrNoRows:
+		return nil, totp.ErrChallengeNotFound
+	case nil:
+		return &c, nil
+	default:
+		return nil, err
+	}
+}
+
+func (repo *challengeRepository) Remove(id totp.ChallengeID) error {
+	sqlStatement := `
+		DELETE FROM login_challenges
+		WHERE id = $1;`
+	_, err := repo.db.Exec(sqlStatement, string(id))
+	return err
+}
+
+func (repo *challengeRepository) NextID() (totp.ChallengeID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return totp.ChallengeID(id.String()), nil
+}
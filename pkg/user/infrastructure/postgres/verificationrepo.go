@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/verification"
+)
+
+func NewVerificationTokenRepository(db *sql.DB) verification.Repository {
+	return &verificationTokenRepository{db: db}
+}
+
+type verificationTokenRepository struct {
+	db *sql.DB
+}
+
+func (repo *verificationTokenRepository) Store(t *verification.Token) error {
+	sqlStatement := `
+		INSERT INTO email_verification_tokens (hash, user_id, email, expires_at)
+		VALUES ($1, $2, $3, $4);
+`
+	_, err := repo.db.Exec(sqlStatement, t.Hash, string(t.UserID), string(t.Email), t.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.db.Exec("DELETE FROM email_verification_tokens WHERE expires_at <= now();")
+	return err
+}
+
+func (repo *verificationTokenRepository) Take(hash string) (*verification.Token, error) {
+	sqlStatement := `
+		DELETE FROM email_verification_tokens
+		WHERE hash = $1
+		RETURNING hash, user_id, email, expires_at;`
+	var t verification.Token
+	row := repo.db.QueryRow(sqlStatement, hash)
+	switch err := row.Scan(&t.Hash, &t.UserID, &t.Email, &t.ExpiresAt); err {
+	case sql.ErrNoRows:
+		return nil, verification.ErrInvalidToken
+	case nil:
+		return &t, nil
+	default:
+		return nil, err
+	}
+}
+
+func (repo *verificationTokenRepository) RemoveByUserID(userID user.ID) error {
+	sqlStatement := `
+		DELETE FROM email_verification_tokens
+		WHERE user_id = $1;`
+	_, err := repo.db.Exec(sqlStatement, string(userID))
+	return err
+}
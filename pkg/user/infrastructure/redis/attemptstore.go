@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/attempt"
+)
+
+func NewAttemptStore(client *redis.Client) attempt.Store {
+	return &attemptStore{client: client}
+}
+
+const (
+	attemptKeyPrefix = "login_failures:"
+	countField       = "count"
+	lastAtField      = "last_at"
+	// releaseRetries is how many times release is repeated when the counter is changed concurrently
+	releaseRetries = 3
+)
+
+type attemptStore struct {
+	client *redis.Client
+}
+
+func (store *attemptStore) Find(key attempt.Key) (attempt.Failures, error) {
+	values, err := store.client.HGetAll(attemptKey(key)).Result()
+	if err != nil {
+		return attempt.Failures{}, err
+	}
+	return parseFailures(values)
+}
+
+func (store *attemptStore) Add(key attempt.Key, at time.Time, ttl time.Duration) (attempt.Failures, error) {
+	redisKey := attemptKey(key)
+	var count *redis.IntCmd
+	// key expires ttl after the last failure, so the counter is incremented atomically without reading it first
+	_, err := store.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		count = pipe.HIncrBy(redisKey, countField, 1)
+		pipe.HSet(redisKey, lastAtField, at.UnixNano())
+		pipe.Expire(redisKey, ttl)
+		return nil
+	})
+	if err != nil {
+		return attempt.Failures{}, err
+	}
+	return attempt.Failures{Count: int(count.Val()), LastAt: at}, nil
+}
+
+// Release watches the counter, HIncrBy alone would recreate removed or expired key without last_at
+func (store *attemptStore) Release(key attempt.Key) error {
+	redisKey := attemptKey(key)
+	release := func(tx *redis.Tx) error {
+		count, err := tx.HGet(redisKey, countField).Int64()
+		if err == redis.Nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if count <= 0 {
+			return nil
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.HIncrBy(redisKey, countField, -1)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < releaseRetries; i++ {
+		if err = store.client.Watch(release, redisKey); err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return err
+}
+
+func (store *attemptStore) Remove(key attempt.Key) error {
+	return store.client.Del(attemptKey(key)).Err()
+}
+
+func parseFailures(values map[string]string) (attempt.Failures, error) {
+	if len(values) == 0 {
+		return attempt.Failures{}, nil
+	}
+	count, err := strconv.Atoi(values[countField])
+	if err != nil {
+		return attempt.Failures{}, err
+	}
+	lastAt, err := strconv.ParseInt(values[lastAtField], 10, 64)
+	if err != nil {
+		return attempt.Failures{}, err
+	}
+	return attempt.Failures{Count: count, LastAt: time.Unix(0, lastAt)}, nil
+}
+
+func attemptKey(key attempt.Key) string {
+	return attemptKeyPrefix + string(key)
+}
@@ -0,0 +1,258 @@
+package redis
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+func NewSessionRepository(client *redis.Client) session.Repository {
+	return &sessionRepository{client: client}
+}
+
+const (
+	sessionKeyPrefix = "session:"
+	// userSessionsKeyPrefix marks set of session ids of the user, ids of expired sessions are dropped lazily on read
+	userSessionsKeyPrefix = "user_sessions:"
+	// refreshTokenKeyPrefix marks refresh token of the session, it is kept apart from the session,
+	// so the session is updated without races with the rotation. Token of removed session expires lazily
+	refreshTokenKeyPrefix = "refresh_token:"
+)
+
+type refreshToken struct {
+	SessionID session.ID
+	Hash      string
+}
+
+type sessionRepository struct {
+	client *redis.Client
+}
+
+func (repo *sessionRepository) Store(s *session.Session) error {
+	ttl := time.Until(s.RefreshExpiresAt)
+	if ttl <= 0 {
+		return repo.Remove(s.ID)
+	}
+
+	stored := *s
+	stored.RefreshTokenHash = ""
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if err = repo.client.Set(sessionKey(s.ID), string(data), ttl).Err(); err != nil {
+		return err
+	}
+	tokenData, err := json.Marshal(refreshToken{SessionID: s.ID, Hash: s.RefreshTokenHash})
+	if err != nil {
+		return err
+	}
+	// existing token is changed by rotation only
+	if err = repo.client.SetNX(refreshTokenKey(s.RefreshTokenID), string(tokenData), ttl).Err(); err != nil {
+		return err
+	}
+
+	indexKey := userSessionsKey(s.UserID)
+	if err = repo.client.SAdd(indexKey, string(s.ID)).Err(); err != nil {
+		return err
+	}
+	// index must live as long as the longest session of the user
+	indexTTL, err := repo.client.TTL(indexKey).Result()
+	if err != nil {
+		return err
+	}
+	if indexTTL < ttl {
+		return repo.client.Expire(indexKey, ttl).Err()
+	}
+	return nil
+}
+
+// Update overwrites only existing key, so session removed by another replica is not stored again
+func (repo *sessionRepository) Update(s *session.Session) error {
+	ttl := time.Until(s.RefreshExpiresAt)
+	if ttl <= 0 {
+		return session.ErrSessionNotFound
+	}
+
+	stored := *s
+	stored.RefreshTokenHash = ""
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	updated, err := repo.client.SetXX(sessionKey(s.ID), string(data), ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return session.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (repo *sessionRepository) Find(id session.ID) (*session.Session, error) {
+	data, err := repo.client.Get(sessionKey(id)).Result()
+	if err == redis.Nil {
+		return nil, session.ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var s session.Session
+	if err = json.Unmarshal([]byte(data), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (repo *sessionRepository) FindByRefreshTokenID(tokenID string) (*session.Session, error) {
+	token, err := repo.findRefreshToken(repo.client, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	s, err := repo.Find(token.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	s.RefreshTokenHash = token.Hash
+	return s, nil
+}
+
+// RotateRefreshToken watches the token and the session, so nothing is changed if concurrent rotation
+// or revocation has changed them
+func (repo *sessionRepository) RotateRefreshToken(tokenID, oldHash, newHash string, lastSeenAt, expiresAt time.Time) error {
+	tokenKey := refreshTokenKey(tokenID)
+	token, err := repo.findRefreshToken(repo.client, tokenID)
+	if err == session.ErrSessionNotFound {
+		return session.ErrRefreshTokenReused
+	} else if err != nil {
+		return err
+	}
+	key := sessionKey(token.SessionID)
+
+	err = repo.client.Watch(func(tx *redis.Tx) error {
+		current, err := repo.findRefreshToken(tx, tokenID)
+		if err == session.ErrSessionNotFound {
+			return session.ErrRefreshTokenReused
+		} else if err != nil {
+			return err
+		}
+		if current.Hash != oldHash {
+			return session.ErrRefreshTokenReused
+		}
+		data, err := tx.Get(key).Result()
+		if err == redis.Nil {
+			return session.ErrRefreshTokenReused
+		} else if err != nil {
+			return err
+		}
+		var s session.Session
+		if err = json.Unmarshal([]byte(data), &s); err != nil {
+			return err
+		}
+
+		s.LastSeenAt = lastSeenAt
+		s.ExpiresAt = expiresAt
+		sessionData, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		current.Hash = newHash
+		tokenData, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+		ttl := time.Until(s.RefreshExpiresAt)
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, string(sessionData), ttl)
+			pipe.Set(tokenKey, string(tokenData), ttl)
+			return nil
+		})
+		return err
+	}, tokenKey, key)
+	if err == redis.TxFailedErr {
+		return session.ErrRefreshTokenReused
+	}
+	return err
+}
+
+func (repo *sessionRepository) findRefreshToken(client redis.Cmdable, tokenID string) (*refreshToken, error) {
+	data, err := client.Get(refreshTokenKey(tokenID)).Result()
+	if err == redis.Nil {
+		return nil, session.ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var token refreshToken
+	if err = json.Unmarshal([]byte(data), &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (repo *sessionRepository) FindByUserID(userID user.ID) ([]session.Session, error) {
+	indexKey := userSessionsKey(userID)
+	ids, err := repo.client.SMembers(indexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []session.Session
+	for _, id := range ids {
+		s, err := repo.Find(session.ID(id))
+		if err == session.ErrSessionNotFound {
+			if err = repo.client.SRem(indexKey, id).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, nil
+}
+
+func (repo *sessionRepository) Remove(id session.ID) error {
+	return repo.client.Del(sessionKey(id)).Err()
+}
+
+func (repo *sessionRepository) RemoveByUserID(userID user.ID) error {
+	indexKey := userSessionsKey(userID)
+	ids, err := repo.client.SMembers(indexKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{indexKey}
+	for _, id := range ids {
+		keys = append(keys, sessionKey(session.ID(id)))
+	}
+	return repo.client.Del(keys...).Err()
+}
+
+func (repo *sessionRepository) NextID() (session.ID, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return session.ID(id.String()), nil
+}
+
+func sessionKey(id session.ID) string {
+	return sessionKeyPrefix + string(id)
+}
+
+func refreshTokenKey(tokenID string) string {
+	return refreshTokenKeyPrefix + tokenID
+}
+
+func userSessionsKey(userID user.ID) string {
+	return userSessionsKeyPrefix + string(userID)
+}
@@ -0,0 +1,20 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/infrastructure/auth"
+)
+
+// auditActor must run after authz.ServerBefore, the actor is the authenticated caller.
+// User service records it to the audit trail in the same transaction as the change
+func auditActor(ctx context.Context, r *http.Request) context.Context {
+	return audit.WithActor(ctx, audit.Actor{
+		UserID: user.ID(authz.IdentityFrom(ctx).UserID),
+		IP:     auth.ClientIP(r),
+	})
+}
@@ -2,10 +2,23 @@ package transport
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
+	httplog "github.com/go-kit/kit/log"
 
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/address"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/apikey"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/export"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/oauth"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/reset"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/totp"
 	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/verification"
 )
 
 type createUserRequest struct {
@@ -21,11 +34,18 @@ type createUserResponse struct {
 	UserID string `json:"userId,omitempty"`
 }
 
-func makeCreateUserEndpoint(s *user.Service) endpoint.Endpoint {
+func makeCreateUserEndpoint(s *user.Service, verifications *verification.Service, logger httplog.Logger) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(createUserRequest)
-		userID, err := s.CreateUser(req.Username, req.FirstName, req.LastName, user.Email(req.Email), user.Phone(req.Phone), req.Password)
-		return createUserResponse{UserID: string(userID)}, err
+		userID, err := s.CreateUser(audit.ActorFrom(ctx), req.Username, req.FirstName, req.LastName, user.Email(req.Email), user.Phone(req.Phone), req.Password)
+		if err != nil {
+			return createUserResponse{}, err
+		}
+		// the user is already created and can request verification again, so signup doesn't fail here
+		if err = verifications.SendVerification(userID); err != nil {
+			_ = logger.Log("msg", "failed to send email verification", "user", userID, "err", err)
+		}
+		return createUserResponse{UserID: string(userID)}, nil
 	}
 }
 
@@ -34,11 +54,18 @@ type readUserRequest struct {
 }
 
 type readUserResponse struct {
-	Username  string `json:"username,omitempty"`
-	FirstName string `json:"firstName,omitempty"`
-	LastName  string `json:"lastName,omitempty"`
-	Email     string `json:"email,omitempty"`
-	Phone     string `json:"phone,omitempty"`
+	Username  string       `json:"username,omitempty"`
+	FirstName string       `json:"firstName,omitempty"`
+	LastName  string       `json:"lastName,omitempty"`
+	Email     string       `json:"email,omitempty"`
+	Phone     string       `json:"phone,omitempty"`
+	Roles     []authz.Role `json:"roles,omitempty"`
+	version   int
+}
+
+// Headers sends version as ETag, client passes it back in If-Match to update the user
+func (r readUserResponse) Headers() http.Header {
+	return http.Header{"ETag": {formatETag(r.version)}}
 }
 
 func makeReadUserEndpoint(s *user.Service) endpoint.Endpoint {
@@ -53,13 +80,64 @@ func makeReadUserEndpoint(s *user.Service) endpoint.Endpoint {
 				LastName:  u.LastName,
 				Email:     string(u.Email),
 				Phone:     string(u.Phone),
+				Roles:     user.AuthzRoles(u.Roles),
+				version:   u.Version,
 			}, nil
 		}
 	}
 }
 
+type searchUsersRequest struct {
+	Text       string
+	SortBy     user.SortField
+	Descending bool
+	Cursor     string
+	Limit      int
+}
+
+type userListItem struct {
+	ID            string       `json:"id"`
+	Username      string       `json:"username"`
+	FirstName     string       `json:"firstName,omitempty"`
+	LastName      string       `json:"lastName,omitempty"`
+	Email         string       `json:"email,omitempty"`
+	EmailVerified bool         `json:"emailVerified"`
+	Phone         string       `json:"phone,omitempty"`
+	Roles         []authz.Role `json:"roles,omitempty"`
+}
+
+type searchUsersResponse struct {
+	Users      []userListItem `json:"users"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+func makeSearchUsersEndpoint(s *user.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(searchUsersRequest)
+		users, next, err := s.SearchUsers(req.Text, req.SortBy, req.Descending, req.Cursor, req.Limit)
+		if err != nil {
+			return searchUsersResponse{}, err
+		}
+		resp := searchUsersResponse{Users: make([]userListItem, 0, len(users)), NextCursor: next}
+		for _, u := range users {
+			resp.Users = append(resp.Users, userListItem{
+				ID:            string(u.ID),
+				Username:      u.Username,
+				FirstName:     u.FirstName,
+				LastName:      u.LastName,
+				Email:         string(u.Email),
+				EmailVerified: u.EmailVerified,
+				Phone:         string(u.Phone),
+				Roles:         user.AuthzRoles(u.Roles),
+			})
+		}
+		return resp, nil
+	}
+}
+
 type updateUserRequest struct {
 	UserID    string
+	Version   int
 	Username  string
 	FirstName string
 	LastName  string
@@ -67,20 +145,49 @@ type updateUserRequest struct {
 	Phone     string
 }
 
-type updateUserResponse struct{}
+type updateUserResponse struct {
+	version int
+}
+
+func (r updateUserResponse) Headers() http.Header {
+	return http.Header{"ETag": {formatETag(r.version)}}
+}
 
-func makeUpdateUserEndpoint(s *user.Service) endpoint.Endpoint {
+func makeUpdateUserEndpoint(s *user.Service, sessions *session.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(updateUserRequest)
-		err := s.UpdateUser(
+		u, err := s.UpdateUser(
+			audit.ActorFrom(ctx),
 			user.ID(req.UserID),
+			req.Version,
 			req.Username,
 			req.FirstName,
 			req.LastName,
 			user.Email(req.Email),
 			user.Phone(req.Phone),
 		)
-		return updateUserResponse{}, err
+		if err != nil {
+			return updateUserResponse{}, err
+		}
+		// changed email drops verification, active sessions must reflect it
+		return updateUserResponse{version: u.Version}, sessions.UpdateUser(u)
+	}
+}
+
+type patchUserRequest struct {
+	UserID  string
+	Version int
+	Patch   user.ProfilePatch
+}
+
+func makePatchUserEndpoint(s *user.Service, sessions *session.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(patchUserRequest)
+		u, err := s.PatchUser(audit.ActorFrom(ctx), user.ID(req.UserID), req.Version, req.Patch)
+		if err != nil {
+			return updateUserResponse{}, err
+		}
+		return updateUserResponse{version: u.Version}, sessions.UpdateUser(u)
 	}
 }
 
@@ -90,10 +197,551 @@ type deleteUserRequest struct {
 
 type deleteUserResponse struct{}
 
-func makeDeleteUserEndpoint(s *user.Service) endpoint.Endpoint {
+// makeDeleteUserEndpoint erases user data in all services. The user is removed last, so failed request can be repeated,
+// other services get the event queued with the removal
+func makeDeleteUserEndpoint(s *user.Service, sessions *session.Service, addresses *address.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(deleteUserRequest)
-		err := s.DeleteUser(user.ID(req.UserID))
+		if _, err := s.ReadUser(user.ID(req.UserID)); err != nil {
+			return deleteUserResponse{}, err
+		}
+		if err := sessions.RevokeUserSessions(user.ID(req.UserID)); err != nil {
+			return deleteUserResponse{}, err
+		}
+		if err := addresses.RemoveUserAddresses(user.ID(req.UserID)); err != nil {
+			return deleteUserResponse{}, err
+		}
+		err := s.DeleteUser(audit.ActorFrom(ctx), user.ID(req.UserID))
 		return deleteUserResponse{}, err
 	}
 }
+
+type exportRequest struct {
+	UserID string
+	Format string
+}
+
+// exportResponse is encoded as downloadable file, see encodeExportResponse
+type exportResponse struct {
+	Format   string
+	Sections []export.Section
+}
+
+func makeExportEndpoint(s *export.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(exportRequest)
+		sections, err := s.Export(user.ID(req.UserID))
+		if err != nil {
+			return exportResponse{}, err
+		}
+		return exportResponse{Format: req.Format, Sections: sections}, nil
+	}
+}
+
+type listSessionsRequest struct {
+	UserID           string
+	CurrentSessionID string
+}
+
+type sessionInfo struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	Current    bool      `json:"current"`
+}
+
+type listSessionsResponse struct {
+	Sessions []sessionInfo `json:"sessions"`
+}
+
+func makeListSessionsEndpoint(s *session.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listSessionsRequest)
+		sessions, err := s.UserSessions(user.ID(req.UserID))
+		if err != nil {
+			return listSessionsResponse{}, err
+		}
+
+		infos := make([]sessionInfo, 0, len(sessions))
+		for _, userSession := range sessions {
+			infos = append(infos, sessionInfo{
+				ID:         userSession.Handle(),
+				UserAgent:  userSession.UserAgent,
+				IP:         userSession.IP,
+				CreatedAt:  userSession.CreatedAt,
+				LastSeenAt: userSession.LastSeenAt,
+				Current:    string(userSession.ID) == req.CurrentSessionID,
+			})
+		}
+		return listSessionsResponse{Sessions: infos}, nil
+	}
+}
+
+type revokeSessionRequest struct {
+	UserID    string
+	SessionID string
+}
+
+type revokeSessionResponse struct{}
+
+func makeRevokeSessionEndpoint(s *session.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(revokeSessionRequest)
+		err := s.RevokeUserSession(user.ID(req.UserID), req.SessionID)
+		return revokeSessionResponse{}, err
+	}
+}
+
+type revokeAllSessionsRequest struct {
+	UserID string
+}
+
+type revokeAllSessionsResponse struct{}
+
+func makeRevokeAllSessionsEndpoint(s *session.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(revokeAllSessionsRequest)
+		err := s.RevokeUserSessions(user.ID(req.UserID))
+		return revokeAllSessionsResponse{}, err
+	}
+}
+
+type createAPIKeyRequest struct {
+	UserID string
+	Name   string
+	Scopes []string
+}
+
+type apiKeyInfo struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type createAPIKeyResponse struct {
+	apiKeyInfo
+	// Key is shown only once, it is not stored
+	Key string `json:"key"`
+}
+
+func makeCreateAPIKeyEndpoint(s *apikey.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createAPIKeyRequest)
+		scopes := make([]apikey.Scope, 0, len(req.Scopes))
+		for _, scope := range req.Scopes {
+			scopes = append(scopes, apikey.Scope(scope))
+		}
+		key, secret, err := s.Create(user.ID(req.UserID), req.Name, scopes)
+		if err != nil {
+			return createAPIKeyResponse{}, err
+		}
+		return createAPIKeyResponse{apiKeyInfo: makeAPIKeyInfo(key), Key: secret}, nil
+	}
+}
+
+type listAPIKeysRequest struct {
+	UserID string
+}
+
+type listAPIKeysResponse struct {
+	APIKeys []apiKeyInfo `json:"apiKeys"`
+}
+
+func makeListAPIKeysEndpoint(s *apikey.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listAPIKeysRequest)
+		keys, err := s.UserKeys(user.ID(req.UserID))
+		if err != nil {
+			return listAPIKeysResponse{}, err
+		}
+
+		infos := make([]apiKeyInfo, 0, len(keys))
+		for i := range keys {
+			infos = append(infos, makeAPIKeyInfo(&keys[i]))
+		}
+		return listAPIKeysResponse{APIKeys: infos}, nil
+	}
+}
+
+type revokeAPIKeyRequest struct {
+	UserID   string
+	APIKeyID string
+}
+
+type revokeAPIKeyResponse struct{}
+
+func makeRevokeAPIKeyEndpoint(s *apikey.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(revokeAPIKeyRequest)
+		err := s.Revoke(user.ID(req.UserID), apikey.ID(req.APIKeyID))
+		return revokeAPIKeyResponse{}, err
+	}
+}
+
+func makeAPIKeyInfo(key *apikey.Key) apiKeyInfo {
+	scopes := make([]string, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	return apiKeyInfo{
+		ID:         string(key.ID),
+		Name:       key.Name,
+		Scopes:     scopes,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
+
+type addressInfo struct {
+	ID         string    `json:"id"`
+	Recipient  string    `json:"recipient"`
+	Phone      string    `json:"phone,omitempty"`
+	Country    string    `json:"country"`
+	Region     string    `json:"region,omitempty"`
+	City       string    `json:"city"`
+	PostalCode string    `json:"postalCode"`
+	Line1      string    `json:"line1"`
+	Line2      string    `json:"line2,omitempty"`
+	IsDefault  bool      `json:"isDefault"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func makeAddressInfo(a address.Address) addressInfo {
+	return addressInfo{
+		ID:         string(a.ID),
+		Recipient:  a.Recipient,
+		Phone:      string(a.Phone),
+		Country:    a.Country,
+		Region:     a.Region,
+		City:       a.City,
+		PostalCode: a.PostalCode,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		IsDefault:  a.IsDefault,
+		CreatedAt:  a.CreatedAt,
+	}
+}
+
+type createAddressRequest struct {
+	UserID      string
+	Details     address.Details
+	MakeDefault bool
+}
+
+func makeCreateAddressEndpoint(s *address.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createAddressRequest)
+		a, err := s.Create(user.ID(req.UserID), req.Details, req.MakeDefault)
+		if err != nil {
+			return addressInfo{}, err
+		}
+		return makeAddressInfo(*a), nil
+	}
+}
+
+type updateAddressRequest struct {
+	UserID      string
+	AddressID   string
+	Details     address.Details
+	MakeDefault bool
+}
+
+func makeUpdateAddressEndpoint(s *address.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updateAddressRequest)
+		a, err := s.Update(user.ID(req.UserID), address.ID(req.AddressID), req.Details, req.MakeDefault)
+		if err != nil {
+			return addressInfo{}, err
+		}
+		return makeAddressInfo(*a), nil
+	}
+}
+
+type listAddressesRequest struct {
+	UserID string
+}
+
+type listAddressesResponse struct {
+	Addresses []addressInfo `json:"addresses"`
+}
+
+func makeListAddressesEndpoint(s *address.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listAddressesRequest)
+		addresses, err := s.UserAddresses(user.ID(req.UserID))
+		if err != nil {
+			return listAddressesResponse{}, err
+		}
+		resp := listAddressesResponse{Addresses: make([]addressInfo, 0, len(addresses))}
+		for _, a := range addresses {
+			resp.Addresses = append(resp.Addresses, makeAddressInfo(a))
+		}
+		return resp, nil
+	}
+}
+
+type removeAddressRequest struct {
+	UserID    string
+	AddressID string
+}
+
+type removeAddressResponse struct{}
+
+func makeRemoveAddressEndpoint(s *address.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(removeAddressRequest)
+		err := s.Remove(user.ID(req.UserID), address.ID(req.AddressID))
+		return removeAddressResponse{}, err
+	}
+}
+
+// defaultAddressID is accepted by the internal lookup instead of address id
+const defaultAddressID = "default"
+
+type lookupAddressRequest struct {
+	UserID    string
+	AddressID string
+}
+
+// makeLookupAddressEndpoint is called by order service to copy the address into the order
+func makeLookupAddressEndpoint(s *address.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(lookupAddressRequest)
+		var a *address.Address
+		var err error
+		if req.AddressID == defaultAddressID {
+			a, err = s.DefaultAddress(user.ID(req.UserID))
+		} else {
+			a, err = s.Find(user.ID(req.UserID), address.ID(req.AddressID))
+		}
+		if err != nil {
+			return addressInfo{}, err
+		}
+		return makeAddressInfo(*a), nil
+	}
+}
+
+type changePasswordRequest struct {
+	UserID      string
+	OldPassword string
+	NewPassword string
+}
+
+type changePasswordResponse struct{}
+
+func makeChangePasswordEndpoint(s *user.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(changePasswordRequest)
+		err := s.ChangePassword(audit.ActorFrom(ctx), user.ID(req.UserID), req.OldPassword, req.NewPassword)
+		return changePasswordResponse{}, err
+	}
+}
+
+type requestPasswordResetRequest struct {
+	Username string
+}
+
+type requestPasswordResetResponse struct{}
+
+func makeRequestPasswordResetEndpoint(s *reset.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(requestPasswordResetRequest)
+		err := s.RequestReset(req.Username)
+		return requestPasswordResetResponse{}, err
+	}
+}
+
+type confirmPasswordResetRequest struct {
+	Token       string
+	NewPassword string
+}
+
+type confirmPasswordResetResponse struct{}
+
+func makeConfirmPasswordResetEndpoint(s *reset.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(confirmPasswordResetRequest)
+		_, err := s.ConfirmReset(audit.ActorFrom(ctx), req.Token, req.NewPassword)
+		return confirmPasswordResetResponse{}, err
+	}
+}
+
+type sendEmailVerificationRequest struct {
+	UserID string
+}
+
+type sendEmailVerificationResponse struct{}
+
+func makeSendEmailVerificationEndpoint(s *verification.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(sendEmailVerificationRequest)
+		err := s.SendVerification(user.ID(req.UserID))
+		return sendEmailVerificationResponse{}, err
+	}
+}
+
+type confirmEmailRequest struct {
+	Token string
+}
+
+type confirmEmailResponse struct{}
+
+func makeConfirmEmailEndpoint(s *verification.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(confirmEmailRequest)
+		err := s.Confirm(audit.ActorFrom(ctx), req.Token)
+		return confirmEmailResponse{}, err
+	}
+}
+
+type setRolesRequest struct {
+	UserID string
+	Roles  []user.Role
+}
+
+type setRolesResponse struct{}
+
+func makeSetRolesEndpoint(s *user.Service, sessions *session.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setRolesRequest)
+		u, err := s.SetRoles(audit.ActorFrom(ctx), user.ID(req.UserID), req.Roles)
+		if err != nil {
+			return setRolesResponse{}, err
+		}
+		// roles are taken from the session on each request, so they apply without login
+		return setRolesResponse{}, sessions.UpdateUser(u)
+	}
+}
+
+type createOAuthClientRequest struct {
+	Name         string
+	RedirectURIs []string
+	Confidential bool
+}
+
+type createOAuthClientResponse struct {
+	ClientID     string   `json:"clientId"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirectUris"`
+	// ClientSecret is shown only once, public client has no secret
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
+
+func makeCreateOAuthClientEndpoint(s *oauth.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createOAuthClientRequest)
+		client, secret, err := s.CreateClient(req.Name, req.RedirectURIs, req.Confidential)
+		if err != nil {
+			return createOAuthClientResponse{}, err
+		}
+		return createOAuthClientResponse{
+			ClientID:     string(client.ID),
+			Name:         client.Name,
+			RedirectURIs: client.RedirectURIs,
+			ClientSecret: secret,
+		}, nil
+	}
+}
+
+type listAuditEntriesRequest struct {
+	Filter audit.Filter
+}
+
+type auditChangeInfo struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+type auditEntryInfo struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"userId"`
+	ActorID   string            `json:"actorId,omitempty"`
+	ActorIP   string            `json:"actorIp,omitempty"`
+	Action    string            `json:"action"`
+	Changes   []auditChangeInfo `json:"changes,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+type listAuditEntriesResponse struct {
+	Entries []auditEntryInfo `json:"entries"`
+}
+
+func makeListAuditEntriesEndpoint(trail *audit.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listAuditEntriesRequest)
+		entries, err := trail.Entries(req.Filter)
+		if err != nil {
+			return listAuditEntriesResponse{}, err
+		}
+		resp := listAuditEntriesResponse{Entries: make([]auditEntryInfo, 0, len(entries))}
+		for _, e := range entries {
+			changes := make([]auditChangeInfo, 0, len(e.Changes))
+			for _, c := range e.Changes {
+				changes = append(changes, auditChangeInfo{Field: c.Field, Before: c.Before, After: c.After})
+			}
+			resp.Entries = append(resp.Entries, auditEntryInfo{
+				ID:        string(e.ID),
+				UserID:    string(e.UserID),
+				ActorID:   string(e.Actor.UserID),
+				ActorIP:   e.Actor.IP,
+				Action:    string(e.Action),
+				Changes:   changes,
+				CreatedAt: e.CreatedAt,
+			})
+		}
+		return resp, nil
+	}
+}
+
+type enrollTOTPRequest struct {
+	UserID string
+}
+
+type enrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func makeEnrollTOTPEndpoint(s *user.Service, totpService *totp.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(enrollTOTPRequest)
+		u, err := s.ReadUser(user.ID(req.UserID))
+		if err != nil {
+			return enrollTOTPResponse{}, err
+		}
+		secret, uri, err := totpService.Enroll(u)
+		return enrollTOTPResponse{Secret: secret, URI: uri}, err
+	}
+}
+
+type totpCodeRequest struct {
+	UserID string
+	Code   string
+}
+
+type confirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func makeConfirmTOTPEndpoint(s *totp.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(totpCodeRequest)
+		recoveryCodes, err := s.ConfirmEnrollment(user.ID(req.UserID), req.Code)
+		return confirmTOTPResponse{RecoveryCodes: recoveryCodes}, err
+	}
+}
+
+type disableTOTPResponse struct{}
+
+func makeDisableTOTPEndpoint(s *totp.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(totpCodeRequest)
+		err := s.Disable(user.ID(req.UserID), req.Code)
+		return disableTOTPResponse{}, err
+	}
+}
@@ -0,0 +1,49 @@
+package transport
+
+import (
+	"encoding/json"
+	"time"
+
+	httplog "github.com/go-kit/kit/log"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/amqp"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const userEventsBatchSize = 100
+
+type userEvent struct {
+	UserID string `json:"userId"`
+}
+
+// RelayUserEvents publishes events queued by user repository, event is removed from the queue after it is sent.
+// Event can be sent twice when removal fails, consumers handle repeated events
+func RelayUserEvents(queue user.EventQueue, events amqp.Channel, interval time.Duration, logger httplog.Logger) {
+	for {
+		if err := publishUserEvents(queue, events); err != nil {
+			_ = logger.Log("msg", "failed to publish user events", "err", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func publishUserEvents(queue user.EventQueue, events amqp.Channel) error {
+	for {
+		pending, err := queue.Pending(userEventsBatchSize)
+		if err != nil || len(pending) == 0 {
+			return err
+		}
+		for _, e := range pending {
+			body, err := json.Marshal(userEvent{UserID: string(e.UserID)})
+			if err != nil {
+				return err
+			}
+			if err = events.Send(string(body), string(e.Type)); err != nil {
+				return err
+			}
+			if err = queue.Remove(e.ID); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/address"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/export"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+)
+
+const exportSourceTimeout = 10 * time.Second
+
+// NewAddressExportSource exports the address book in the same format as the addresses api
+func NewAddressExportSource(addresses *address.Service) export.Source {
+	return addressExportSource{addresses}
+}
+
+type addressExportSource struct {
+	addresses *address.Service
+}
+
+func (s addressExportSource) Name() string {
+	return "addresses"
+}
+
+func (s addressExportSource) Export(userID user.ID) (interface{}, error) {
+	addresses, err := s.addresses.UserAddresses(userID)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]addressInfo, 0, len(addresses))
+	for _, a := range addresses {
+		infos = append(infos, makeAddressInfo(a))
+	}
+	return infos, nil
+}
+
+// NewServiceExportSource reads user data with the internal export api of another service,
+// urlFormat gets escaped user id in place of %s
+func NewServiceExportSource(name, urlFormat string) export.Source {
+	return &serviceExportSource{name: name, urlFormat: urlFormat, client: &http.Client{Timeout: exportSourceTimeout}}
+}
+
+type serviceExportSource struct {
+	name      string
+	urlFormat string
+	client    *http.Client
+}
+
+func (s *serviceExportSource) Name() string {
+	return s.name
+}
+
+func (s *serviceExportSource) Export(userID user.ID) (interface{}, error) {
+	exportURL := fmt.Sprintf(s.urlFormat, url.PathEscape(string(userID)))
+	resp, err := s.client.Get(exportURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, exportURL)
+	}
+
+	var data json.RawMessage
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
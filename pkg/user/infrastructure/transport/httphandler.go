@@ -1,10 +1,14 @@
 package transport
 
 import (
+	"archive/zip"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	httplog "github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
@@ -12,7 +16,17 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 
+	"github.com/ilya-shikhaleev/arch-course/pkg/common/authz"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/address"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/apikey"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/audit"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/export"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/oauth"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/reset"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/session"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/totp"
 	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/user"
+	"github.com/ilya-shikhaleev/arch-course/pkg/user/app/verification"
 )
 
 type userInfo struct {
@@ -25,15 +39,35 @@ type userInfo struct {
 	Password  string `json:"password"`
 }
 
-func MakeHandler(s *user.Service, logger httplog.Logger) http.Handler {
+type passwordInfo struct {
+	Username    string `json:"username"`
+	OldPassword string `json:"oldPassword"`
+	NewPassword string `json:"newPassword"`
+	Token       string `json:"token"`
+}
+
+func MakeHandler(
+	s *user.Service,
+	sessions *session.Service,
+	resets *reset.Service,
+	verifications *verification.Service,
+	totpService *totp.Service,
+	apiKeys *apikey.Service,
+	exports *export.Service,
+	trail *audit.Service,
+	addresses *address.Service,
+	oauthClients *oauth.Service,
+	logger httplog.Logger,
+) http.Handler {
 	r := mux.NewRouter()
 	opts := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(authz.ServerBefore, auditActor),
 	}
 
 	createUserHandler := httptransport.NewServer(
-		makeCreateUserEndpoint(s),
+		makeCreateUserEndpoint(s, verifications, logger),
 		decodeCreateUserRequest,
 		encodeResponse,
 		opts...,
@@ -46,24 +80,225 @@ func MakeHandler(s *user.Service, logger httplog.Logger) http.Handler {
 		opts...,
 	)
 
+	patchUserHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(makePatchUserEndpoint(s, sessions)),
+		decodePatchUserRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	searchUsersHandler := httptransport.NewServer(
+		authz.Require(authz.ReadAnyUser)(makeSearchUsersEndpoint(s)),
+		decodeSearchUsersRequest,
+		encodeResponse,
+		opts...,
+	)
+
 	updateUserHandler := httptransport.NewServer(
-		makeUpdateUserEndpoint(s),
+		authz.RejectAPIKeys(makeUpdateUserEndpoint(s, sessions)),
 		decodeUpdateUserRequest,
 		encodeResponse,
 		opts...,
 	)
 
 	deleteUserHandler := httptransport.NewServer(
-		makeDeleteUserEndpoint(s),
+		authz.RejectAPIKeys(makeDeleteUserEndpoint(s, sessions, addresses)),
 		decodeRemoveUserRequest,
 		encodeResponse,
 		opts...,
 	)
 
+	listSessionsHandler := httptransport.NewServer(
+		makeListSessionsEndpoint(sessions),
+		decodeListSessionsRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	revokeSessionHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(makeRevokeSessionEndpoint(sessions)),
+		decodeRevokeSessionRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	revokeAllSessionsHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(makeRevokeAllSessionsEndpoint(sessions)),
+		decodeRevokeAllSessionsRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	changePasswordHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(makeChangePasswordEndpoint(s)),
+		decodeChangePasswordRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	requestPasswordResetHandler := httptransport.NewServer(
+		makeRequestPasswordResetEndpoint(resets),
+		decodeRequestPasswordResetRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	confirmPasswordResetHandler := httptransport.NewServer(
+		makeConfirmPasswordResetEndpoint(resets),
+		decodeConfirmPasswordResetRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	sendEmailVerificationHandler := httptransport.NewServer(
+		makeSendEmailVerificationEndpoint(verifications),
+		decodeSendEmailVerificationRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	confirmEmailHandler := httptransport.NewServer(
+		makeConfirmEmailEndpoint(verifications),
+		decodeConfirmEmailRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	setRolesHandler := httptransport.NewServer(
+		authz.Require(authz.ManageRoles)(makeSetRolesEndpoint(s, sessions)),
+		decodeSetRolesRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	createOAuthClientHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(authz.Require(authz.ManageOAuthClients)(makeCreateOAuthClientEndpoint(oauthClients))),
+		decodeCreateOAuthClientRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	enrollTOTPHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(makeEnrollTOTPEndpoint(s, totpService)),
+		decodeEnrollTOTPRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	confirmTOTPHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(makeConfirmTOTPEndpoint(totpService)),
+		decodeTOTPCodeRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	disableTOTPHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(makeDisableTOTPEndpoint(totpService)),
+		decodeTOTPCodeRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	createAPIKeyHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(makeCreateAPIKeyEndpoint(apiKeys)),
+		decodeCreateAPIKeyRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	listAPIKeysHandler := httptransport.NewServer(
+		makeListAPIKeysEndpoint(apiKeys),
+		decodeListAPIKeysRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	revokeAPIKeyHandler := httptransport.NewServer(
+		authz.RejectAPIKeys(makeRevokeAPIKeyEndpoint(apiKeys)),
+		decodeRevokeAPIKeyRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	listAuditEntriesHandler := httptransport.NewServer(
+		authz.Require(authz.ReadAuditLog)(makeListAuditEntriesEndpoint(trail)),
+		decodeListAuditEntriesRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	createAddressHandler := httptransport.NewServer(
+		makeCreateAddressEndpoint(addresses),
+		decodeCreateAddressRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	updateAddressHandler := httptransport.NewServer(
+		makeUpdateAddressEndpoint(addresses),
+		decodeUpdateAddressRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	listAddressesHandler := httptransport.NewServer(
+		makeListAddressesEndpoint(addresses),
+		decodeListAddressesRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	removeAddressHandler := httptransport.NewServer(
+		makeRemoveAddressEndpoint(addresses),
+		decodeRemoveAddressRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	lookupAddressHandler := httptransport.NewServer(
+		makeLookupAddressEndpoint(addresses),
+		decodeLookupAddressRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	exportHandler := httptransport.NewServer(
+		makeExportEndpoint(exports),
+		decodeExportRequest,
+		encodeExportResponse,
+		opts...,
+	)
+
 	r.Handle("/api/v1/users/signup", createUserHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/users/me/2fa", enrollTOTPHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/users/me/2fa", disableTOTPHandler).Methods(http.MethodDelete)
+	r.Handle("/api/v1/users/me/2fa/confirm", confirmTOTPHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/users/{id}/roles", setRolesHandler).Methods(http.MethodPut)
+	r.Handle("/api/v1/users/me/email/verification", sendEmailVerificationHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/users/email/confirm", confirmEmailHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/users/me/password", changePasswordHandler).Methods(http.MethodPut)
+	r.Handle("/api/v1/users/password/reset", requestPasswordResetHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/users/password/reset/confirm", confirmPasswordResetHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/users/me/sessions", listSessionsHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/users/me/sessions", revokeAllSessionsHandler).Methods(http.MethodDelete)
+	r.Handle("/api/v1/users/me/sessions/{id}", revokeSessionHandler).Methods(http.MethodDelete)
+	r.Handle("/api/v1/users/me/api-keys", createAPIKeyHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/users/me/api-keys", listAPIKeysHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/users/me/api-keys/{id}", revokeAPIKeyHandler).Methods(http.MethodDelete)
+	r.Handle("/api/v1/users/me/addresses", createAddressHandler).Methods(http.MethodPost)
+	r.Handle("/api/v1/users/me/addresses", listAddressesHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/users/me/addresses/{id}", updateAddressHandler).Methods(http.MethodPut)
+	r.Handle("/api/v1/users/me/addresses/{id}", removeAddressHandler).Methods(http.MethodDelete)
+	r.Handle("/api/v1/internal/users/{userId}/addresses/{id}", lookupAddressHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/users/me/export", exportHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/users/audit", listAuditEntriesHandler).Methods(http.MethodGet)
 	r.Handle("/api/v1/users/{id}", readUserHandler).Methods(http.MethodGet)
 	r.Handle("/api/v1/users/{id}", updateUserHandler).Methods(http.MethodPut)
 	r.Handle("/api/v1/users", updateUserHandler).Methods(http.MethodPut)
+	r.Handle("/api/v1/users/{id}", patchUserHandler).Methods(http.MethodPatch)
+	r.Handle("/api/v1/users", patchUserHandler).Methods(http.MethodPatch)
+	r.Handle("/api/v1/admin/users", searchUsersHandler).Methods(http.MethodGet)
+	r.Handle("/api/v1/admin/oauth-clients", createOAuthClientHandler).Methods(http.MethodPost)
 	r.Handle("/api/v1/users/{id}", deleteUserHandler).Methods(http.MethodDelete)
 
 	return r
@@ -87,14 +322,14 @@ func decodeCreateUserRequest(_ context.Context, r *http.Request) (interface{}, e
 	return req, nil
 }
 
-func decodeReadUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+func decodeReadUserRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
 	if !ok {
 		return nil, newErrInvalidRequest(nil, "id required for read user request")
 	}
 
-	if r.Header.Get("X-User-Id") != id {
+	if r.Header.Get("X-User-Id") != id && !authz.HasPermission(ctx, authz.ReadAnyUser) {
 		return nil, newErrUnauthorized(fmt.Sprintf("can read only self user data (%s != %s)", id, r.Header.Get("X-User-Id")))
 	}
 
@@ -102,18 +337,111 @@ func decodeReadUserRequest(_ context.Context, r *http.Request) (interface{}, err
 	return req, nil
 }
 
-func decodeUpdateUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	vars := mux.Vars(r)
-	id, ok := vars["id"]
+// decodePatchUserRequest changes only fields present in the body, null is the same as absent field
+func decodePatchUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := updatedUserID(r)
+	if err != nil {
+		return nil, err
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info struct {
+		Username  *string `json:"username"`
+		FirstName *string `json:"firstName"`
+		LastName  *string `json:"lastName"`
+		Email     *string `json:"email"`
+		Phone     *string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid patch user request")
+	}
+
+	patch := user.ProfilePatch{Username: info.Username, FirstName: info.FirstName, LastName: info.LastName}
+	if info.Email != nil {
+		email := user.Email(*info.Email)
+		patch.Email = &email
+	}
+	if info.Phone != nil {
+		phone := user.Phone(*info.Phone)
+		patch.Phone = &phone
+	}
+	req := patchUserRequest{UserID: id, Version: version, Patch: patch}
+	return req, nil
+}
+
+// updatedUserID allows to change only self, id in the path is optional
+func updatedUserID(r *http.Request) (string, error) {
+	id, ok := mux.Vars(r)["id"]
 	if !ok {
 		if r.Header.Get("X-User-Id") == "" {
-			return nil, newErrInvalidRequest(nil, "id required for update user request")
-		} else {
-			id = r.Header.Get("X-User-Id")
+			return "", newErrInvalidRequest(nil, "id required for update user request")
 		}
+		id = r.Header.Get("X-User-Id")
 	}
 	if r.Header.Get("X-User-Id") != id {
-		return nil, newErrUnauthorized(fmt.Sprintf("can read only self user data (%s != %s)", id, r.Header.Get("X-User-Id")))
+		return "", newErrUnauthorized(fmt.Sprintf("can read only self user data (%s != %s)", id, r.Header.Get("X-User-Id")))
+	}
+	return id, nil
+}
+
+var errPreconditionRequired = errors.New("If-Match header with ETag of the user is required")
+
+// ifMatchVersion reads version from ETag in If-Match header, * matches any version and unknown ETag matches no version
+func ifMatchVersion(r *http.Request) (int, error) {
+	etag := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch etag {
+	case "":
+		return 0, errPreconditionRequired
+	case "*":
+		return user.AnyVersion, nil
+	}
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`))
+	if err != nil || version < 0 {
+		return 0, user.ErrVersionConflict
+	}
+	return version, nil
+}
+
+func formatETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// decodeSearchUsersRequest reads query params q, sort (username or email), order (asc or desc), cursor and limit
+func decodeSearchUsersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	req := searchUsersRequest{
+		Text:   query.Get("q"),
+		SortBy: user.SortField(query.Get("sort")),
+		Cursor: query.Get("cursor"),
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		req.Descending = true
+	default:
+		return nil, newErrInvalidRequest(nil, fmt.Sprintf("unknown order %s", order))
+	}
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if req.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, newErrInvalidRequest(err, "invalid limit")
+		}
+	}
+	return req, nil
+}
+
+func decodeUpdateUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := updatedUserID(r)
+	if err != nil {
+		return nil, err
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		return nil, err
 	}
 
 	var info userInfo
@@ -123,6 +451,7 @@ func decodeUpdateUserRequest(_ context.Context, r *http.Request) (interface{}, e
 
 	req := updateUserRequest{
 		UserID:    id,
+		Version:   version,
 		Username:  info.Username,
 		FirstName: info.FirstName,
 		LastName:  info.LastName,
@@ -147,19 +476,446 @@ func decodeRemoveUserRequest(_ context.Context, r *http.Request) (interface{}, e
 	return req, nil
 }
 
+func decodeListSessionsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for list sessions request")
+	}
+
+	req := listSessionsRequest{
+		UserID:           userID,
+		CurrentSessionID: r.Header.Get("X-Session-Id"),
+	}
+	return req, nil
+}
+
+func decodeRevokeSessionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for revoke session request")
+	}
+
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for revoke session request")
+	}
+
+	req := revokeSessionRequest{UserID: userID, SessionID: id}
+	return req, nil
+}
+
+func decodeRevokeAllSessionsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for revoke sessions request")
+	}
+
+	req := revokeAllSessionsRequest{UserID: userID}
+	return req, nil
+}
+
+func decodeCreateAPIKeyRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for create api key request")
+	}
+
+	var info struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid create api key request")
+	}
+	if info.Name == "" {
+		return nil, newErrInvalidRequest(nil, "name required for create api key request")
+	}
+
+	req := createAPIKeyRequest{UserID: userID, Name: info.Name, Scopes: info.Scopes}
+	return req, nil
+}
+
+func decodeListAPIKeysRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for list api keys request")
+	}
+
+	req := listAPIKeysRequest{UserID: userID}
+	return req, nil
+}
+
+func decodeRevokeAPIKeyRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for revoke api key request")
+	}
+
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for revoke api key request")
+	}
+
+	req := revokeAPIKeyRequest{UserID: userID, APIKeyID: id}
+	return req, nil
+}
+
+// addressBody is the same for create and update, isDefault false doesn't drop the default flag
+type addressBody struct {
+	Recipient  string `json:"recipient"`
+	Phone      string `json:"phone"`
+	Country    string `json:"country"`
+	Region     string `json:"region"`
+	City       string `json:"city"`
+	PostalCode string `json:"postalCode"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	IsDefault  bool   `json:"isDefault"`
+}
+
+func (b addressBody) details() address.Details {
+	return address.Details{
+		Recipient:  b.Recipient,
+		Phone:      user.Phone(b.Phone),
+		Country:    b.Country,
+		Region:     b.Region,
+		City:       b.City,
+		PostalCode: b.PostalCode,
+		Line1:      b.Line1,
+		Line2:      b.Line2,
+	}
+}
+
+func decodeCreateAddressRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for create address request")
+	}
+
+	var body addressBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid create address request")
+	}
+
+	req := createAddressRequest{UserID: userID, Details: body.details(), MakeDefault: body.IsDefault}
+	return req, nil
+}
+
+func decodeUpdateAddressRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for update address request")
+	}
+
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for update address request")
+	}
+
+	var body addressBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid update address request")
+	}
+
+	req := updateAddressRequest{UserID: userID, AddressID: id, Details: body.details(), MakeDefault: body.IsDefault}
+	return req, nil
+}
+
+func decodeListAddressesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for list addresses request")
+	}
+
+	req := listAddressesRequest{UserID: userID}
+	return req, nil
+}
+
+func decodeRemoveAddressRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for remove address request")
+	}
+
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for remove address request")
+	}
+
+	req := removeAddressRequest{UserID: userID, AddressID: id}
+	return req, nil
+}
+
+// decodeLookupAddressRequest takes user from the path, the route is not published by the ingress
+func decodeLookupAddressRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	userID, ok := vars["userId"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "user id required for lookup address request")
+	}
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for lookup address request")
+	}
+
+	req := lookupAddressRequest{UserID: userID, AddressID: id}
+	return req, nil
+}
+
+func decodeExportRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for export request")
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatJSON
+	}
+	if format != exportFormatJSON && format != exportFormatZIP {
+		return nil, newErrInvalidRequest(nil, "format must be json or zip")
+	}
+
+	req := exportRequest{UserID: userID, Format: format}
+	return req, nil
+}
+
+// decodeListAuditEntriesRequest accepts time range in RFC 3339 format, both bounds are optional
+func decodeListAuditEntriesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{UserID: user.ID(query.Get("userId"))}
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, newErrInvalidRequest(err, "invalid from")
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, newErrInvalidRequest(err, "invalid to")
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, newErrInvalidRequest(err, "invalid limit")
+		}
+	}
+
+	req := listAuditEntriesRequest{Filter: filter}
+	return req, nil
+}
+
+func decodeChangePasswordRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for change password request")
+	}
+
+	var info passwordInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid change password request")
+	}
+
+	req := changePasswordRequest{
+		UserID:      userID,
+		OldPassword: info.OldPassword,
+		NewPassword: info.NewPassword,
+	}
+	return req, nil
+}
+
+func decodeRequestPasswordResetRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var info passwordInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid password reset request")
+	}
+	if info.Username == "" {
+		return nil, newErrInvalidRequest(nil, "username required for password reset request")
+	}
+
+	req := requestPasswordResetRequest{Username: info.Username}
+	return req, nil
+}
+
+func decodeConfirmPasswordResetRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var info passwordInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid confirm password reset request")
+	}
+	if info.Token == "" {
+		return nil, newErrInvalidRequest(nil, "token required for confirm password reset request")
+	}
+
+	req := confirmPasswordResetRequest{
+		Token:       info.Token,
+		NewPassword: info.NewPassword,
+	}
+	return req, nil
+}
+
+func decodeSendEmailVerificationRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for send email verification request")
+	}
+
+	req := sendEmailVerificationRequest{UserID: userID}
+	return req, nil
+}
+
+func decodeConfirmEmailRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var info struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid confirm email request")
+	}
+	if info.Token == "" {
+		return nil, newErrInvalidRequest(nil, "token required for confirm email request")
+	}
+
+	req := confirmEmailRequest{Token: info.Token}
+	return req, nil
+}
+
+func decodeSetRolesRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, newErrInvalidRequest(nil, "id required for set roles request")
+	}
+
+	var info struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid set roles request")
+	}
+	roles := make([]user.Role, 0, len(info.Roles))
+	for _, role := range info.Roles {
+		if !authz.KnownRole(authz.Role(role)) {
+			return nil, newErrInvalidRequest(nil, fmt.Sprintf("unknown role %s", role))
+		}
+		roles = append(roles, user.Role(role))
+	}
+
+	req := setRolesRequest{UserID: id, Roles: roles}
+	return req, nil
+}
+
+func decodeCreateOAuthClientRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var info struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirectUris"`
+		Confidential bool     `json:"confidential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid create oauth client request")
+	}
+
+	req := createOAuthClientRequest{Name: info.Name, RedirectURIs: info.RedirectURIs, Confidential: info.Confidential}
+	return req, nil
+}
+
+func decodeEnrollTOTPRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for enroll 2fa request")
+	}
+
+	req := enrollTOTPRequest{UserID: userID}
+	return req, nil
+}
+
+func decodeTOTPCodeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	userID := r.Header.Get("X-User-Id")
+	if userID == "" {
+		return nil, newErrUnauthorized("user id required for 2fa request")
+	}
+
+	var info struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		return nil, newErrInvalidRequest(err, "invalid 2fa request")
+	}
+	if info.Code == "" {
+		return nil, newErrInvalidRequest(nil, "code required for 2fa request")
+	}
+
+	req := totpCodeRequest{UserID: userID, Code: info.Code}
+	return req, nil
+}
+
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if e, ok := response.(errorer); ok && e.error() != nil {
 		encodeError(ctx, e.error(), w)
 		return nil
 	}
+	if h, ok := response.(httptransport.Headerer); ok {
+		for key, values := range h.Headers() {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	return json.NewEncoder(w).Encode(response)
 }
 
+const (
+	exportFormatJSON = "json"
+	exportFormatZIP  = "zip"
+)
+
+// encodeExportResponse writes all sections into one json file or a zip archive with file per section
+func encodeExportResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(exportResponse)
+	filename := "export-" + time.Now().UTC().Format("2006-01-02")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if resp.Format == exportFormatZIP {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		archive := zip.NewWriter(w)
+		for _, section := range resp.Sections {
+			file, err := archive.Create(section.Name + ".json")
+			if err != nil {
+				return err
+			}
+			encoder := json.NewEncoder(file)
+			encoder.SetIndent("", "  ")
+			if err = encoder.Encode(section.Data); err != nil {
+				return err
+			}
+		}
+		return archive.Close()
+	}
+
+	data := make(map[string]interface{}, len(resp.Sections))
+	for _, section := range resp.Sections {
+		data[section.Name] = section.Data
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
 // encode errors from business-logic
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
+	if validationErr, ok := err.(*user.ValidationError); ok {
+		encodeValidationError(validationErr, w)
+		return
+	}
+
 	if invalidRequestErr, ok := err.(*errInvalidRequest); ok {
 		w.WriteHeader(http.StatusBadRequest)
 		err = errors.New(invalidRequestErr.message)
@@ -172,6 +928,27 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 			w.WriteHeader(http.StatusNotFound)
 		case user.ErrDuplicateUsername:
 			w.WriteHeader(http.StatusBadRequest)
+		case user.ErrVersionConflict:
+			w.WriteHeader(http.StatusPreconditionFailed)
+		case errPreconditionRequired:
+			w.WriteHeader(http.StatusPreconditionRequired)
+		case session.ErrSessionNotFound, totp.ErrNotEnrolled, apikey.ErrKeyNotFound, address.ErrAddressNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		case totp.ErrInvalidCode, apikey.ErrInvalidScope, audit.ErrInvalidFilter,
+			user.ErrInvalidSearch, user.ErrInvalidCursor:
+			w.WriteHeader(http.StatusBadRequest)
+		case totp.ErrAlreadyEnrolled, address.ErrTooManyAddresses:
+			w.WriteHeader(http.StatusConflict)
+		case oauth.ErrInvalidClientInfo:
+			w.WriteHeader(http.StatusBadRequest)
+		case user.ErrInvalidPassword, user.ErrEmptyPassword, reset.ErrInvalidToken, verification.ErrInvalidToken:
+			w.WriteHeader(http.StatusBadRequest)
+		case authz.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+		case verification.ErrAlreadyVerified:
+			w.WriteHeader(http.StatusConflict)
+		case totp.ErrTooManyAttempts:
+			w.WriteHeader(http.StatusTooManyRequests)
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -182,6 +959,24 @@ func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	})
 }
 
+type fieldErrorInfo struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// encodeValidationError lists all invalid fields, so client can show errors next to them
+func encodeValidationError(err *user.ValidationError, w http.ResponseWriter) {
+	fields := make([]fieldErrorInfo, 0, len(err.Fields))
+	for _, field := range err.Fields {
+		fields = append(fields, fieldErrorInfo{Field: field.Field, Message: field.Message})
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  err.Error(),
+		"fields": fields,
+	})
+}
+
 type errorer interface {
 	error() error
 }